@@ -0,0 +1,163 @@
+package restconf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/freeconf/restconf/audit"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// auditResponse captures outcome of request for audit record
+type auditResponse struct {
+	http.ResponseWriter
+	log    *audit.Log
+	rec    audit.Record
+	before map[string]interface{}
+	err    error
+	done   bool
+}
+
+func newAuditResponse(log *audit.Log, ctx context.Context, w http.ResponseWriter, r *http.Request, deviceId string, module string) *auditResponse {
+	remoteIp, _ := ctx.Value(RemoteIpAddressKey).(string)
+	return &auditResponse{
+		ResponseWriter: w,
+		log:            log,
+		rec: audit.Record{
+			User:     secure.User(ctx),
+			RemoteIp: remoteIp,
+			Device:   deviceId,
+			Method:   r.Method,
+			Path:     module + ":" + r.URL.Path,
+		},
+	}
+}
+
+func (a *auditResponse) WriteHeader(code int) {
+	if a.rec.Status == 0 {
+		a.rec.Status = code
+	}
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *auditResponse) Write(data []byte) (int, error) {
+	if a.rec.Status == 0 {
+		a.rec.Status = http.StatusOK
+	}
+	return a.ResponseWriter.Write(data)
+}
+
+func (a *auditResponse) Flush() {
+	if f, valid := a.ResponseWriter.(http.Flusher); valid {
+		f.Flush()
+	}
+}
+
+// snapshot keeps copy of config before edit so changes can be recorded
+func (a *auditResponse) snapshot(sel *node.Selection) {
+	a.before = auditSnapshot(sel)
+}
+
+func (a *auditResponse) diff(sel *node.Selection) {
+	if a.before == nil {
+		return
+	}
+	after := auditSnapshot(sel)
+	if after == nil {
+		return
+	}
+	changes, _ := jsonDiff(a.before, after)
+	if changes == nil {
+		return
+	}
+	// audit records are read by others so secrets are never revealed
+	redactJson(sel.Meta(), changes)
+	data, err := json.Marshal(changes)
+	if err != nil {
+		fc.Debug.Printf("could not diff %s for audit. %s", sel.Path, err)
+		return
+	}
+	a.rec.Diff = string(data)
+}
+
+func auditSnapshot(sel *node.Selection) map[string]interface{} {
+	cfg, err := sel.Constrain("content=config")
+	if err != nil {
+		return nil
+	}
+	data, err := nodeutil.WriteJSON(cfg)
+	if err != nil {
+		fc.Debug.Printf("could not snapshot %s for audit. %s", sel.Path, err)
+		return nil
+	}
+	var snapshot map[string]interface{}
+	if err = json.Unmarshal([]byte(data), &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// jsonDiff returns values in b that are different from a.  Values removed from
+// a are null. Lists that changed are included in full.
+func jsonDiff(a map[string]interface{}, b map[string]interface{}) (map[string]interface{}, bool) {
+	var changes map[string]interface{}
+	add := func(k string, v interface{}) {
+		if changes == nil {
+			changes = make(map[string]interface{})
+		}
+		changes[k] = v
+	}
+	for k, bVal := range b {
+		aVal, found := a[k]
+		if !found {
+			add(k, bVal)
+			continue
+		}
+		aMap, aIsMap := aVal.(map[string]interface{})
+		bMap, bIsMap := bVal.(map[string]interface{})
+		if aIsMap && bIsMap {
+			if d, changed := jsonDiff(aMap, bMap); changed {
+				add(k, d)
+			}
+		} else if !reflect.DeepEqual(aVal, bVal) {
+			add(k, bVal)
+		}
+	}
+	for k := range a {
+		if _, found := b[k]; !found {
+			add(k, nil)
+		}
+	}
+	return changes, changes != nil
+}
+
+func (a *auditResponse) record() {
+	if a.done {
+		return
+	}
+	a.done = true
+	if a.err != nil {
+		a.rec.Error = a.err.Error()
+	}
+	if a.rec.Status == 0 {
+		a.rec.Status = http.StatusOK
+	}
+	a.log.Record(a.rec)
+}
+
+// only changes and rpcs are audited when they finish, not reads.
+// Subscriptions are recorded when they start.
+func isAudited(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "OPTIONS", "HEAD":
+		return false
+	}
+	// dry runs change nothing
+	_, dryRun := r.URL.Query()[DryRunParam]
+	return !dryRun
+}
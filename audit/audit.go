@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// Record is a single management operation
+type Record struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	RemoteIp string    `json:"remoteIp,omitempty"`
+	Device   string    `json:"device,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Status   int       `json:"status"`
+
+	// Compact JSON of config values changed by edit
+	Diff string `json:"diff,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Sink receives every audit record
+type Sink interface {
+	Write(r Record) error
+}
+
+// SinkFunc allows a function to be a sink
+type SinkFunc func(r Record) error
+
+func (f SinkFunc) Write(r Record) error {
+	return f(r)
+}
+
+type Listener func(r Record)
+
+// DefaultRecentMax is number of recent records kept in memory when there is
+// no other maximum set
+var DefaultRecentMax = 100
+
+// Log sends records to all sinks and listeners and keeps recent records in
+// memory
+type Log struct {
+	// Maximum number of recent records to keep in memory
+	RecentMax int
+
+	sinks     []Sink
+	file      *FileSink
+	recent    []Record
+	listeners *list.List
+	mu        sync.Mutex
+}
+
+func NewLog() *Log {
+	return &Log{
+		RecentMax: DefaultRecentMax,
+		listeners: list.New(),
+	}
+}
+
+func (l *Log) AddSink(s Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append(l.sinks, s)
+}
+
+// SetFile writes records to file in addition to any other sinks. Empty file
+// name stops writing to file.
+func (l *Log) SetFile(fname string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		if l.file.Fname == fname {
+			return nil
+		}
+		l.file.Close()
+		l.file = nil
+	}
+	if fname == "" {
+		return nil
+	}
+	var err error
+	l.file, err = NewFileSink(fname)
+	return err
+}
+
+func (l *Log) File() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return ""
+	}
+	return l.file.Fname
+}
+
+// OnRecord is called for each new record. Useful for sending records to an
+// event stream.
+func (l *Log) OnRecord(listener Listener) nodeutil.Subscription {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return nodeutil.NewSubscription(l.listeners, l.listeners.PushBack(listener))
+}
+
+func (l *Log) Record(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	l.mu.Lock()
+	l.recent = append(l.recent, r)
+	if max := l.RecentMax; max >= 0 && len(l.recent) > max {
+		l.recent = append(l.recent[:0:0], l.recent[len(l.recent)-max:]...)
+	}
+	sinks := l.sinks
+	if l.file != nil {
+		sinks = append(sinks[:len(sinks):len(sinks)], l.file)
+	}
+	var listeners []Listener
+	for e := l.listeners.Front(); e != nil; e = e.Next() {
+		listeners = append(listeners, e.Value.(Listener))
+	}
+	l.mu.Unlock()
+
+	for _, s := range sinks {
+		if err := s.Write(r); err != nil {
+			fc.Err.Printf("could not write audit record. %s", err)
+		}
+	}
+	for _, listener := range listeners {
+		listener(r)
+	}
+}
+
+// Recent records, oldest first
+func (l *Log) Recent() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Record{}, l.recent...)
+}
+
+// FileSink appends each record as a line of JSON
+type FileSink struct {
+	Fname string
+	f     *os.File
+	mu    sync.Mutex
+}
+
+func NewFileSink(fname string) (*FileSink, error) {
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{Fname: fname, f: f}, nil
+}
+
+func (s *FileSink) Write(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
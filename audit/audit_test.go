@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/yang/fc"
+)
+
+func TestLog(t *testing.T) {
+	l := NewLog()
+	l.RecentMax = 2
+	var sunk []Record
+	l.AddSink(SinkFunc(func(r Record) error {
+		sunk = append(sunk, r)
+		return nil
+	}))
+	var heard int
+	sub := l.OnRecord(func(Record) {
+		heard++
+	})
+	fname := filepath.Join(t.TempDir(), "audit.log")
+	fc.RequireEqual(t, nil, l.SetFile(fname))
+
+	l.Record(Record{Method: "PUT", Path: "a:x", Status: 200})
+	l.Record(Record{Method: "POST", Path: "a:y", Status: 204})
+	sub.Close()
+	l.Record(Record{Method: "DELETE", Path: "a:z", Status: 404, Error: "not found"})
+
+	recent := l.Recent()
+	fc.AssertEqual(t, 2, len(recent))
+	fc.AssertEqual(t, "a:y", recent[0].Path)
+	fc.AssertEqual(t, false, recent[0].Time.IsZero())
+	fc.AssertEqual(t, 3, len(sunk))
+	fc.AssertEqual(t, 2, heard)
+
+	fc.RequireEqual(t, nil, l.SetFile(""))
+	data, err := os.ReadFile(fname)
+	fc.RequireEqual(t, nil, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	fc.AssertEqual(t, 3, len(lines))
+	fc.AssertEqual(t, true, strings.Contains(lines[2], `"error":"not found"`), lines[2])
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// Manage is management of audit log and uses the audit container in
+// fc-restconf.yang
+func Manage(l *Log) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "recent":
+				return recentNode(l.Recent()), nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "file":
+				if r.Write {
+					return l.SetFile(hnd.Val.String())
+				}
+				if fname := l.File(); fname != "" {
+					hnd.Val = val.String(fname)
+				}
+			case "recentMax":
+				if r.Write {
+					l.RecentMax = hnd.Val.Value().(int)
+				} else {
+					hnd.Val = val.Int32(l.RecentMax)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func recentNode(recent []Record) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			// newest first
+			if r.Row < len(recent) {
+				return RecordNode(recent[len(recent)-r.Row-1]), nil, nil
+			}
+			return nil, nil, nil
+		},
+	}
+}
+
+// RecordNode uses auditRecord grouping in fc-restconf.yang
+func RecordNode(rec Record) node.Node {
+	return &nodeutil.Extend{
+		Base: nodeutil.ReflectChild(&rec),
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "time":
+				hnd.Val = val.String(rec.Time.Format(time.RFC3339Nano))
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+	}
+}
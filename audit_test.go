@@ -0,0 +1,97 @@
+package restconf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestAudit(t *testing.T) {
+	ypath := source.Path("./testdata:./yang")
+	m := parser.RequireModule(ypath, "car")
+	car := testdata.New()
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(m, testdata.Manage(car)))
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfig(strings.NewReader(`{
+		"fc-restconf" : {
+			"audit" : {
+				"recentMax" : 2
+			}
+		}
+	}`)))
+	s.Filters = append(s.Filters, func(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, error) {
+		return secure.WithUser(ctx, "joe"), nil
+	})
+	request := func(method string, url string, body string) int {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/car:", `{"speed":10}`))
+	fc.AssertEqual(t, 200, request("GET", "/restconf/data/car:", ""))
+	fc.AssertEqual(t, 204, request("POST", "/restconf/operations/car:rotateTires", ""))
+	fc.AssertEqual(t, 500, request("PATCH", "/restconf/data/car:", `{"speed":"x"}`))
+
+	recent := s.Audit.Recent()
+	fc.RequireEqual(t, 2, len(recent))
+	fc.AssertEqual(t, "joe", recent[0].User)
+	fc.AssertEqual(t, "192.0.2.1", recent[0].RemoteIp)
+	fc.AssertEqual(t, "POST", recent[0].Method)
+	fc.AssertEqual(t, "car:rotateTires", recent[0].Path)
+	fc.AssertEqual(t, 204, recent[0].Status)
+	fc.AssertEqual(t, 500, recent[1].Status)
+	fc.AssertEqual(t, true, recent[1].Error != "")
+
+	t.Run("diff", func(t *testing.T) {
+		s.Audit.RecentMax = 1
+		fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/car:", `{"speed":20}`))
+		fc.AssertEqual(t, `{"speed":20}`, s.Audit.Recent()[0].Diff)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/car:?fc.dry-run", `{"speed":30}`))
+		fc.AssertEqual(t, `{"speed":20}`, s.Audit.Recent()[0].Diff)
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest("GET", "/restconf/data/car:update", nil).WithContext(ctx)
+		r.Header.Set("Accept", "text/event-stream")
+		done := make(chan struct{})
+		go func() {
+			s.ServeHTTP(httptest.NewRecorder(), r)
+			close(done)
+		}()
+		for i := 0; s.Audit.Recent()[0].Path != "car:update" && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		rec := s.Audit.Recent()[0]
+		fc.AssertEqual(t, "GET", rec.Method)
+		fc.AssertEqual(t, "car:update", rec.Path)
+		fc.AssertEqual(t, 200, rec.Status)
+		cancel()
+		<-done
+	})
+
+	t.Run("operational", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/restconf/data/fc-restconf:audit/recent", nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		fc.AssertEqual(t, 200, w.Code)
+		fc.AssertEqual(t, true, strings.Contains(w.Body.String(), `"user":"joe"`), w.Body.String())
+	})
+}
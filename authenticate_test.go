@@ -0,0 +1,106 @@
+package restconf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/restconf/stock"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestCertAuthentication(t *testing.T) {
+	ca, caKey := testCert(t, nil, nil, "ca")
+	client, _ := testCert(t, ca, caKey, "joe")
+	other, otherKey := testCert(t, nil, nil, "other")
+	stranger, _ := testCert(t, other, otherKey, "joe")
+	caPrint, err := secure.Fingerprint(ca, crypto.SHA256)
+	fc.RequireEqual(t, nil, err)
+
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin"},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	s.Web = stock.NewHttpServer(s)
+	s.Web.ApplyOptions(stock.HttpServerOptions{
+		Port: "127.0.0.1:0",
+		Tls: &stock.Tls{
+			CertFile:  "./stock/testdata/test.crt",
+			KeyFile:   "./stock/testdata/test.key",
+			CaCertPem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		},
+	})
+	defer s.Close()
+	rbac := secure.NewRbac()
+	role := secure.NewRole()
+	role.Access["bird"] = &secure.AccessControl{Path: "bird", Permissions: secure.Full}
+	rbac.Roles["joe"] = role
+	rbac.Authentication = &secure.CertHandler{
+		CertToName: secure.CertToNameMap{
+			{Id: 1, Fingerprint: caPrint, MapType: "common-name"},
+		},
+	}
+	s.Auth = rbac
+
+	request := func(cert *x509.Certificate) (int, string) {
+		r := httptest.NewRequest("GET", "/restconf/data/bird:bird=robin?fields=name", nil)
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	code, body := request(client)
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"name":"robin"}`, body)
+
+	code, _ = request(stranger)
+	fc.AssertEqual(t, 401, code)
+
+	code, _ = request(nil)
+	fc.AssertEqual(t, 404, code)
+}
+
+func testCert(t *testing.T, parent *x509.Certificate, parentKey crypto.Signer, cn string) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fc.RequireEqual(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	fc.RequireEqual(t, nil, err)
+	cert, err := x509.ParseCertificate(der)
+	fc.RequireEqual(t, nil, err)
+	return cert, key
+}
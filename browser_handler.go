@@ -10,6 +10,9 @@ import (
 
 	"context"
 
+	"github.com/freeconf/restconf/audit"
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/meta"
 	"github.com/freeconf/yang/node"
@@ -17,7 +20,23 @@ import (
 )
 
 type browserHandler struct {
-	browser *node.Browser
+	browser  *node.Browser
+	auth     secure.Auth
+	audit    *audit.Log
+	deviceId string
+
+	// Optional: path to mount point browser is mounted at e.g. /fleet:device=abc
+	mount string
+
+	// Optional: called after successful edit
+	onEdit func(ctx context.Context)
+
+	// Optional: edits are denied when someone else holds a lock
+	locks *device.Locks
+
+	// Optional: see Server.PreCommit and Server.PostCommit
+	preCommit  []EditHook
+	postCommit []EditHook
 }
 
 var subscribeCount int
@@ -51,31 +70,69 @@ var ComplianceContextKey = ComplianceContextKeyType("RESTCONF_COMPLIANCE")
 
 func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context.Context, w http.ResponseWriter, r *http.Request, endpointId int) {
 	var err error
-	var payload node.Node
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
 	if r.RemoteAddr != "" {
 		host, _ := ipAddrSplitHostPort(r.RemoteAddr)
 		ctx = context.WithValue(ctx, RemoteIpAddressKey, host)
+		ctx = context.WithValue(ctx, SessionKey, r.RemoteAddr)
+	}
+	var aud *auditResponse
+	if hndlr.audit != nil {
+		aud = newAuditResponse(hndlr.audit, ctx, w, r, hndlr.deviceId, hndlr.browser.Meta.Ident())
+		w = aud
+		if isAudited(r) {
+			defer aud.record()
+		}
+	}
+	_, dryRun := r.URL.Query()[DryRunParam]
+	dryRun = dryRun && r.Method != "GET"
+	if dryRun {
+		ctx = context.WithValue(ctx, DryRunContextKey, true)
+	}
+	insert := readInsert(r)
+	if insert != nil {
+		ctx = context.WithValue(ctx, InsertContextKey, insert)
 	}
 	sel := hndlr.browser.RootWithContext(ctx)
+	if dryRun {
+		sel.Node = dryRunNode(sel.Node)
+	}
+	var canSee func(m meta.Meta) bool
+	if hndlr.auth != nil {
+		// user name is put into context by request filters like secure.CertHandler
+		hndlr.auth.ConstrainRoot(secure.User(ctx), sel.Constraints)
+		sel.Context = sel.Constraints.ContextConstraint(sel)
+		canSee = reveal(hndlr.auth, secure.User(ctx))
+	}
 	var target *node.Selection
+	var edited bool
+	var status int
+	var created meta.Definition
+	var createdAt string
+	var edit *Edit
 	defer sel.Release()
 	acceptType := MimeType(r.Header.Get("Accept"))
 	contentType := MimeType(r.Header.Get("Content-Type"))
 	if target, err = sel.Find(r.URL.EscapedPath()); err == nil {
-		if err = node.BuildConstraints(target, r.URL.Query()); err != nil {
-			if handleErr(compliance, err, r, w, acceptType) {
+		if target == nil && r.Method == "PUT" {
+			// PUT creates target under its parent
+			if target, created, err = findCreateParent(sel, r.URL.EscapedPath()); handleErr(compliance, err, r, w, acceptType) {
 				return
 			}
 		}
-		wireFmt := getWireFormatter(acceptType)
-		hdr := w.Header()
 		if target == nil {
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
+		if err = node.BuildConstraints(target, r.URL.Query()); err != nil {
+			if handleErr(compliance, err, r, w, acceptType) {
+				return
+			}
+		}
+		wireFmt := getWireFormatter(acceptType)
+		hdr := w.Header()
 		defer target.Release()
 		if handleErr(compliance, err, r, w, acceptType) {
 			return
@@ -90,10 +147,62 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 				return
 			}
 		}
+		isEdit := r.Method == "PUT" || r.Method == "PATCH" || r.Method == "DELETE" || (r.Method == "POST" && !isRpcOrAction)
+		if r.Method == "POST" && !isRpcOrAction {
+			// 201 requires location of what is created, RFC8040 4.4.1
+			var body []byte
+			if body, err = previewBody(r); err == nil && createdPath(target, body) == "" {
+				err = fmt.Errorf("%w. body must be one resource to create with its keys", fc.BadRequestError)
+			}
+			if handleErr(compliance, err, r, w, acceptType) {
+				return
+			}
+		}
+		if insert != nil {
+			if isRpcOrAction {
+				err = fmt.Errorf("%w only allowed on edits", errBadInsert)
+			} else {
+				insertMeta := target.Meta()
+				if created != nil {
+					insertMeta = created
+				} else if r.Method == "POST" {
+					// entry may go into list or leaf-list under target
+					var body []byte
+					if body, err = previewBody(r); err == nil {
+						if m, _ := postedData(target, body); m != nil {
+							insertMeta = m
+						}
+					}
+				}
+				if err == nil {
+					err = hndlr.checkInsert(r, target.Context, insertMeta, insert)
+				}
+			}
+			if handleErr(compliance, err, r, w, acceptType) {
+				return
+			}
+		}
+		if isEdit && hndlr.locks != nil {
+			resource := hndlr.mount + "/" + hndlr.browser.Meta.Ident() + ":" + r.URL.EscapedPath()
+			if handleErr(compliance, hndlr.locks.CheckEdit(lockOwner(ctx), resource), r, w, acceptType) {
+				return
+			}
+		}
+		if isEdit && (len(hndlr.preCommit) > 0 || len(hndlr.postCommit) > 0) {
+			existing := target
+			if created != nil {
+				existing = nil
+			}
+			if edit, err = hndlr.runPreCommit(ctx, r, existing); handleErr(compliance, err, r, w, acceptType) {
+				return
+			}
+		}
 		switch r.Method {
 		case "DELETE":
 			// CRUD - Delete
 			err = target.Delete()
+			edited = true
+			status = http.StatusNoContent
 		case "GET":
 			if meta.IsNotification(target.Meta()) {
 				hdr.Set("Content-Type", string(TextStreamMimeType)+"; charset=utf-8")
@@ -140,7 +249,7 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 						etime := n.EventTime.Format(EventTimeFormat)
 						wireFmt.writeNotificationStart(&buf, origMod, etime)
 					}
-					err := n.Event.InsertInto(nodeWtr(acceptType, compliance, &buf))
+					err := n.Event.InsertInto(nodeWtr(acceptType, compliance, &buf, canSee))
 					if err != nil {
 						errOnSend <- err
 						return
@@ -156,6 +265,10 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 					flusher.Flush()
 					fc.Debug.Printf("sent %d bytes in notif", buf.Len())
 				})
+				if aud != nil {
+					aud.err = err
+					aud.record()
+				}
 				if err != nil {
 					fc.Err.Print(err)
 					return
@@ -171,7 +284,7 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 			} else {
 				// CRUD - Read
 				setContentType(compliance, w.Header(), acceptType)
-				err = target.InsertInto(nodeWtr(acceptType, compliance, w))
+				err = target.InsertInto(nodeWtr(acceptType, compliance, w, canSee))
 			}
 		case "PATCH":
 			// CRUD - Upsert
@@ -182,7 +295,14 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 				return
 			}
 			editable, _ := target.Constrain("content=config")
-			err = editable.UpsertFrom(input)
+			if aud != nil {
+				aud.snapshot(editable)
+			}
+			if err = editable.UpsertFrom(input); err == nil && aud != nil {
+				aud.diff(editable)
+			}
+			edited = true
+			status = http.StatusNoContent
 		case "PUT":
 			// CRUD - Remove and replace
 			var input node.Node
@@ -192,10 +312,31 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 				return
 			}
 			editable, _ := target.Constrain("content=config")
-			err = editable.ReplaceFrom(input)
+			if aud != nil {
+				aud.snapshot(editable)
+			}
+			if created != nil {
+				err = editable.InsertFrom(input)
+				status = http.StatusCreated
+				createdAt = location(r, "")
+			} else {
+				err = editable.ReplaceFrom(input)
+				status = http.StatusNoContent
+			}
+			if err == nil && insert != nil && !dryRun {
+				err = checkPlaced(sel, r.URL.EscapedPath(), insert, created != nil)
+			}
+			if err == nil && aud != nil {
+				aud.diff(editable)
+			}
+			edited = true
 		case "POST":
 			if meta.IsAction(target.Meta()) {
 				// RPC
+				if dryRun {
+					handleErr(compliance, fmt.Errorf("%w. %s not supported on rpcs", fc.BadRequestError, DryRunParam), r, w, acceptType)
+					return
+				}
 				a := target.Meta().(*meta.Rpc)
 				var input node.Node
 				if a.Input() != nil && r.ContentLength > 0 {
@@ -211,7 +352,7 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 				}
 				if outputSel != nil && a.Output() != nil {
 					setContentType(compliance, w.Header(), acceptType)
-					if err = sendActionOutput(acceptType, compliance, wireFmt, w, outputSel, a); err != nil {
+					if err = sendActionOutput(acceptType, compliance, wireFmt, w, outputSel, a, canSee); err != nil {
 						handleErr(compliance, err, r, w, acceptType)
 						return
 					}
@@ -221,10 +362,23 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 				}
 			} else {
 				// CRUD - Insert
-				payload, err = nodeutil.ReadJSONIO(r.Body)
-				if err == nil {
+				var body []byte
+				if body, err = io.ReadAll(r.Body); err == nil {
+					relPath := createdPath(target, body)
 					editable, _ := target.Constrain("content=config")
-					err = editable.InsertFrom(payload)
+					if aud != nil {
+						aud.snapshot(editable)
+					}
+					err = postInsert(editable, body)
+					if err == nil && insert != nil && !dryRun {
+						err = checkPlaced(sel, r.URL.EscapedPath()+relPath, insert, true)
+					}
+					if err == nil && aud != nil {
+						aud.diff(editable)
+					}
+					edited = true
+					status = http.StatusCreated
+					createdAt = location(r, relPath)
 				}
 			}
 		case "OPTIONS":
@@ -236,6 +390,23 @@ func (hndlr *browserHandler) ServeHTTP(compliance ComplianceOptions, ctx context
 
 	if err != nil {
 		handleErr(compliance, err, r, w, acceptType)
+	} else if edited {
+		if !dryRun {
+			if hndlr.onEdit != nil {
+				hndlr.onEdit(ctx)
+			}
+			if edit != nil {
+				// before response is written so client hears of failures
+				if err = runPostCommit(hndlr.postCommit, *edit); err != nil {
+					handleErr(compliance, err, r, w, acceptType)
+					return
+				}
+			}
+		}
+		if createdAt != "" {
+			w.Header().Set("Location", createdAt)
+		}
+		w.WriteHeader(status)
 	}
 }
 
@@ -247,7 +418,7 @@ func setContentType(compliance ComplianceOptions, h http.Header, contentType Mim
 	}
 }
 
-func sendActionOutput(acceptType MimeType, compliance ComplianceOptions, wireFormat wireFormat, out io.Writer, output *node.Selection, a *meta.Rpc) error {
+func sendActionOutput(acceptType MimeType, compliance ComplianceOptions, wireFormat wireFormat, out io.Writer, output *node.Selection, a *meta.Rpc, reveal func(m meta.Meta) bool) error {
 	if !compliance.DisableActionWrapper {
 		// IETF formated output
 		// https://datatracker.ietf.org/doc/html/rfc8040#section-3.6.2
@@ -256,7 +427,7 @@ func sendActionOutput(acceptType MimeType, compliance ComplianceOptions, wireFor
 			return err
 		}
 	}
-	err := output.InsertInto(nodeWtr(acceptType, compliance, out))
+	err := output.InsertInto(nodeWtr(acceptType, compliance, out, reveal))
 
 	if !compliance.DisableActionWrapper {
 		if _, err := wireFormat.writeRpcOutputEnd(out); err != nil {
@@ -266,18 +437,19 @@ func sendActionOutput(acceptType MimeType, compliance ComplianceOptions, wireFor
 	return err
 }
 
-func nodeWtr(mime MimeType, compliance ComplianceOptions, out io.Writer) node.Node {
+// nodeWtr masks sensitive values unless reveal allows them. See redactWtr
+func nodeWtr(mime MimeType, compliance ComplianceOptions, out io.Writer, reveal func(m meta.Meta) bool) node.Node {
 	if mime.IsXml() {
 		wtr := &nodeutil.XMLWtr{
 			Out: out,
 		}
-		return wtr.Node()
+		return redactWtr(wtr.Node(), reveal)
 	}
 	wtr := &nodeutil.JSONWtr{
 		Out:              out,
 		QualifyNamespace: !compliance.QualifyNamespaceDisabled,
 	}
-	return wtr.Node()
+	return redactWtr(wtr.Node(), reveal)
 }
 
 func nodeRdr(mime MimeType, in io.Reader) (node.Node, error) {
@@ -2,12 +2,17 @@ package callhome
 
 import (
 	"container/list"
+	"context"
 	"fmt"
+	"math/rand"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/freeconf/restconf/client"
 	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/stock"
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
@@ -17,25 +22,77 @@ import (
 //
 //	https://www.rfc-editor.org/rfc/rfc8071.html
 type CallHome struct {
-	options    Options
-	proto      device.ProtocolHandler
-	Registered bool
-	registrar  device.Device // handle to the remote controller
-	LastErr    string
-	listeners  *list.List
+	options   Options
+	proto     device.ProtocolHandler
+	listeners *list.List
+
+	// Required for RFC 8071 call home connections, typically restconf.Server
+	Handler http.Handler
+	dialer  *Dialer
+
+	mu        sync.Mutex
+	status    Status
+	registrar device.Device // handle to the remote controller
+	cancel    context.CancelFunc
+	done      chan struct{}
 }
 
 type Options struct {
 	DeviceId     string
 	Address      string
 	LocalAddress string
-	RetryRateMs  int
+
+	// Wait before first retry, doubles on each failure up to MaxRetryRateMs
+	RetryRateMs    int
+	MaxRetryRateMs int
+
+	// Register again this often to keep registration from expiring
+	HeartbeatMs int
+
+	// RFC 8071 call home where this device connects to controller
+	Reverse ReverseOptions
+}
+
+type ReverseOptions struct {
+	// host:port of controller's call home listener
+	Address string
+
+	Tls *stock.Tls
+}
+
+type State int
+
+const (
+	StateIdle State = iota
+	StateRegistering
+	StateRegistered
+	StateRetrying
+)
+
+var stateNames = []string{"idle", "registering", "registered", "retrying"}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+type Status struct {
+	State       State
+	LastAttempt time.Time
+	NextAttempt time.Time
+	LastErr     string
+}
+
+func (s Status) Registered() bool {
+	return s.State == StateRegistered
 }
 
 func DefaultOptions() Options {
 	return Options{
-		DeviceId: os.Getenv("DEVICE_ID"),
-		Address:  os.Getenv("CALLHOME_ADDR"),
+		DeviceId:       os.Getenv("DEVICE_ID"),
+		Address:        os.Getenv("CALLHOME_ADDR"),
+		RetryRateMs:    10000,
+		MaxRetryRateMs: 300000,
+		HeartbeatMs:    60000,
 	}
 }
 
@@ -53,6 +110,14 @@ func Install(d *device.Local) error {
 	return d.Add("fc-call-home-client", CallHomeNode(ch))
 }
 
+// InstallWithHandler also supports RFC 8071 call home where controller sends
+// requests to handler over connection this device makes.
+func InstallWithHandler(d *device.Local, handler http.Handler) error {
+	ch := New(client.ProtocolHandler(d.SchemaSource()))
+	ch.Handler = handler
+	return d.Add("fc-call-home-client", CallHomeNode(ch))
+}
+
 type RegisterUpdate int
 
 const (
@@ -62,58 +127,254 @@ const (
 
 type RegisterListener func(d device.Device, update RegisterUpdate)
 
+type StatusListener func(s Status)
+
 func (callh *CallHome) OnRegister(l RegisterListener) nodeutil.Subscription {
-	if callh.Registered {
+	callh.mu.Lock()
+	defer callh.mu.Unlock()
+	if callh.status.Registered() {
 		l(callh.registrar, Register)
 	}
 	return nodeutil.NewSubscription(callh.listeners, callh.listeners.PushBack(l))
 }
 
+// OnStatus is called when registration state changes
+func (callh *CallHome) OnStatus(l StatusListener) nodeutil.Subscription {
+	callh.mu.Lock()
+	defer callh.mu.Unlock()
+	return nodeutil.NewSubscription(callh.listeners, callh.listeners.PushBack(l))
+}
+
 func (callh *CallHome) Options() Options {
+	callh.mu.Lock()
+	defer callh.mu.Unlock()
 	return callh.options
 }
 
+func (callh *CallHome) Status() Status {
+	callh.mu.Lock()
+	defer callh.mu.Unlock()
+	return callh.status
+}
+
+// ApplyOptions unregisters using previous options and registers in the
+// background with new options.
 func (callh *CallHome) ApplyOptions(options Options) error {
-	if nonfatal := callh.unregister(); nonfatal != nil {
-		fc.Err.Printf("could not unregister. %s", nonfatal)
-	}
+	callh.Stop()
+	callh.mu.Lock()
 	callh.options = options
-	callh.Registered = false
-	if callh.options.Address == "" {
+	callh.mu.Unlock()
+	if err := callh.applyReverse(options.Reverse); err != nil {
+		return err
+	}
+	if options.Address == "" {
 		fc.Debug.Print("no call home address configured")
 		return nil
 	}
-	fc.Debug.Print("connecting to ", callh.options.Address)
-	callh.Register()
+	return callh.Start()
+}
+
+// Start registering in the background, restarting if already started.
+// Fails when there is no address to register with.
+func (callh *CallHome) Start() error {
+	callh.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	callh.mu.Lock()
+	options := callh.options
+	if options.Address == "" {
+		callh.mu.Unlock()
+		cancel()
+		return fmt.Errorf("%w. no call home address configured", fc.BadRequestError)
+	}
+	callh.cancel = cancel
+	callh.done = done
+	callh.mu.Unlock()
+	fc.Debug.Print("connecting to ", options.Address)
+	go func() {
+		defer close(done)
+		callh.run(ctx, options)
+	}()
 	return nil
 }
 
-func (callh *CallHome) updateListeners(registrar device.Device, update RegisterUpdate) {
-	callh.registrar = registrar
-	p := callh.listeners.Front()
-	for p != nil {
-		p.Value.(RegisterListener)(callh.registrar, update)
-		p = p.Next()
+// Stop registering and unregister if registered.  Blocks until unregistered.
+func (callh *CallHome) Stop() {
+	callh.mu.Lock()
+	cancel, done := callh.cancel, callh.done
+	callh.cancel, callh.done = nil, nil
+	callh.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
 	}
 }
 
-func (callh *CallHome) Register() {
-retry:
-	registrar, err := callh.proto(callh.options.Address)
-	if err != nil {
-		fc.Err.Printf("failed to build device with address %s. %s", callh.options.Address, err)
-	} else {
-		if err = callh.register(registrar); err != nil {
-			fc.Err.Printf("failed to register %s", err)
+func (callh *CallHome) run(ctx context.Context, options Options) {
+	initial := time.Duration(options.RetryRateMs) * time.Millisecond
+	if initial <= 0 {
+		initial = 10 * time.Second
+	}
+	max := time.Duration(options.MaxRetryRateMs) * time.Millisecond
+	if max < initial {
+		max = initial
+	}
+	heartbeat := time.Duration(options.HeartbeatMs) * time.Millisecond
+	backoff := initial
+	var registrar device.Device
+	for {
+		callh.update(func(s *Status) {
+			if s.State != StateRegistered {
+				s.State = StateRegistering
+			}
+			s.LastAttempt = time.Now()
+		}, nil, Register)
+		var err error
+		var lease time.Duration
+		if registrar == nil {
+			registrar, err = callh.proto(options.Address)
+		}
+		if err == nil {
+			lease, err = callh.register(registrar, options)
+		}
+		var wait time.Duration
+		if err != nil {
+			fc.Err.Printf("failed to register with %s. %s", options.Address, err)
+			registrar = nil
+			wait = jitter(backoff)
+			backoff *= 2
+			if backoff > max {
+				backoff = max
+			}
 		} else {
-			return
+			backoff = initial
+			wait = heartbeat
+			if lease > 0 && (wait <= 0 || wait > lease/2) {
+				// renew well before lease expires
+				wait = lease / 2
+			}
 		}
+		next := time.Now().Add(wait)
+		update := Register
+		if err != nil {
+			update = Unregister
+		}
+		callh.update(func(s *Status) {
+			if err != nil {
+				s.State = StateRetrying
+				s.LastErr = err.Error()
+			} else {
+				s.State = StateRegistered
+				s.LastErr = ""
+			}
+			s.NextAttempt = next
+		}, registrar, update)
+		if wait <= 0 && err == nil {
+			// no heartbeat
+			<-ctx.Done()
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+				continue
+			}
+		}
+		if callh.Status().Registered() {
+			if nonfatal := callh.unregister(registrar, options); nonfatal != nil {
+				fc.Err.Printf("could not unregister. %s", nonfatal)
+			}
+		}
+		callh.update(func(s *Status) {
+			*s = Status{State: StateIdle, LastAttempt: s.LastAttempt, LastErr: s.LastErr}
+		}, registrar, Unregister)
+		return
+	}
+}
+
+// Connected is true when RFC 8071 call home connection is established
+func (callh *CallHome) Connected() bool {
+	callh.mu.Lock()
+	dialer := callh.dialer
+	callh.mu.Unlock()
+	return dialer != nil && dialer.Connected()
+}
+
+func (callh *CallHome) applyReverse(reverse ReverseOptions) error {
+	callh.mu.Lock()
+	dialer := callh.dialer
+	callh.dialer = nil
+	callh.mu.Unlock()
+	if dialer != nil {
+		dialer.Stop()
+	}
+	if reverse.Address == "" {
+		return nil
 	}
-	if callh.options.RetryRateMs == 0 {
-		panic("failed to register and no retry rate configured")
+	if callh.Handler == nil {
+		return fmt.Errorf("%w. no handler for call home requests", fc.BadRequestError)
+	}
+	if reverse.Tls == nil {
+		return fmt.Errorf("%w. tls required for call home", fc.BadRequestError)
+	}
+	if !reverse.Tls.Loaded() {
+		if err := reverse.Tls.Load(); err != nil {
+			return err
+		}
+	}
+	cfg := reverse.Tls.NewConfig()
+	if _, err := serverTls(cfg); err != nil {
+		return fmt.Errorf("%w. %s", fc.BadRequestError, err)
+	}
+	dialer = &Dialer{
+		Address:   reverse.Address,
+		Tls:       cfg,
+		Handler:   callh.Handler,
+		RetryRate: time.Duration(callh.Options().RetryRateMs) * time.Millisecond,
+	}
+	callh.mu.Lock()
+	callh.dialer = dialer
+	callh.mu.Unlock()
+	dialer.Start()
+	return nil
+}
+
+// jitter spreads out retries from many devices between half and all of wait
+func jitter(wait time.Duration) time.Duration {
+	half := int64(wait / 2)
+	if half <= 0 {
+		return wait
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// update status and notify listeners when state changes
+func (callh *CallHome) update(change func(s *Status), registrar device.Device, update RegisterUpdate) {
+	callh.mu.Lock()
+	before := callh.status
+	change(&callh.status)
+	after := callh.status
+	if registrar != nil {
+		callh.registrar = registrar
+	}
+	var listeners []interface{}
+	if before.State != after.State || before.LastErr != after.LastErr {
+		for p := callh.listeners.Front(); p != nil; p = p.Next() {
+			listeners = append(listeners, p.Value)
+		}
+	}
+	registrar = callh.registrar
+	callh.mu.Unlock()
+	registeredChanged := before.Registered() != after.Registered()
+	for _, l := range listeners {
+		switch x := l.(type) {
+		case StatusListener:
+			x(after)
+		case RegisterListener:
+			if registeredChanged {
+				x(registrar, update)
+			}
+		}
 	}
-	<-time.After(time.Duration(callh.options.RetryRateMs) * time.Millisecond)
-	goto retry
 }
 
 func (callh *CallHome) serverApi(registrar device.Device) (*node.Browser, error) {
@@ -128,47 +389,48 @@ func (callh *CallHome) serverApi(registrar device.Device) (*node.Browser, error)
 	return reg, nil
 }
 
-func (callh *CallHome) unregister() error {
-	if !callh.Registered {
+func (callh *CallHome) unregister(registrar device.Device, options Options) error {
+	if registrar == nil {
 		return nil
 	}
-	registrar, err := callh.proto(callh.options.Address)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		callh.updateListeners(registrar, Unregister)
-		callh.Registered = false
-	}()
 	reg, err := callh.serverApi(registrar)
 	if err != nil {
 		return err
 	}
-	sel, err := reg.Root().Find("register")
+	sel, err := reg.Root().Find("unregister")
 	if err != nil {
 		return err
 	}
-	_, err = sel.Action(nil)
+	r := map[string]interface{}{
+		"deviceId": options.DeviceId,
+	}
+	_, err = sel.Action(nodeutil.ReflectChild(r))
 	return err
 }
 
-func (callh *CallHome) register(registrar device.Device) error {
+// register returns lease if registrar reported one
+func (callh *CallHome) register(registrar device.Device, options Options) (time.Duration, error) {
 	reg, err := callh.serverApi(registrar)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	r := map[string]interface{}{
-		"deviceId": callh.options.DeviceId,
-		"address":  callh.options.LocalAddress,
+		"deviceId": options.DeviceId,
+		"address":  options.LocalAddress,
 	}
 	sel, err := reg.Root().Find("register")
 	if err != nil {
-		return err
+		return 0, err
 	}
-	_, err = sel.Action(nodeutil.ReflectChild(r))
-	if err == nil {
-		callh.updateListeners(registrar, Register)
-		callh.Registered = true
+	out, err := sel.Action(nodeutil.ReflectChild(r))
+	if err != nil || out == nil {
+		return 0, err
 	}
-	return err
+	var resp struct {
+		LeaseMs int
+	}
+	if err = out.UpsertInto(&nodeutil.Node{Object: &resp}); err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseMs) * time.Millisecond, nil
 }
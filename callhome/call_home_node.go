@@ -1,6 +1,9 @@
 package callhome
 
 import (
+	"time"
+
+	"github.com/freeconf/restconf/stock"
 	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
 	"github.com/freeconf/yang/val"
@@ -13,14 +16,39 @@ func CallHomeNode(ch *CallHome) node.Node {
 			return ch
 		},
 		Base: nodeutil.ReflectChild(&options),
+		OnChild: func(p node.Node, r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "reverse":
+				return reverseNode(ch, &options.Reverse), nil
+			}
+			return p.Child(r)
+		},
 		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
 			switch r.Meta.Ident() {
-			case "registered":
-				hnd.Val = val.Bool(ch.Registered)
+			case "registered", "state", "lastAttempt", "nextAttempt", "lastErr":
+				return statusField(ch.Status(), r, hnd)
 			default:
 				return p.Field(r, hnd)
 			}
-			return nil
+		},
+		OnAction: func(p node.Node, r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "register":
+				return nil, ch.Start()
+			case "unregister":
+				ch.Stop()
+			}
+			return nil, nil
+		},
+		OnNotify: func(p node.Node, r node.NotifyRequest) (node.NotifyCloser, error) {
+			switch r.Meta.Ident() {
+			case "update":
+				sub := ch.OnStatus(func(s Status) {
+					r.Send(statusNode(s))
+				})
+				return sub.Close, nil
+			}
+			return nil, nil
 		},
 		OnEndEdit: func(p node.Node, r node.NodeRequest) error {
 			if err := p.EndEdit(r); err != nil {
@@ -30,3 +58,61 @@ func CallHomeNode(ch *CallHome) node.Node {
 		},
 	}
 }
+
+func statusNode(s Status) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			return statusField(s, r, hnd)
+		},
+	}
+}
+
+func statusField(s Status, r node.FieldRequest, hnd *node.ValueHandle) error {
+	switch r.Meta.Ident() {
+	case "registered":
+		hnd.Val = val.Bool(s.Registered())
+	case "state":
+		hnd.Val, _ = r.Meta.Type().Enum().ByLabel(s.State.String())
+	case "lastAttempt":
+		if !s.LastAttempt.IsZero() {
+			hnd.Val = val.String(s.LastAttempt.Format(time.RFC3339))
+		}
+	case "nextAttempt":
+		if !s.NextAttempt.IsZero() {
+			hnd.Val = val.String(s.NextAttempt.Format(time.RFC3339))
+		}
+	case "lastErr", "err":
+		if s.LastErr != "" {
+			hnd.Val = val.String(s.LastErr)
+		}
+	}
+	return nil
+}
+
+func reverseNode(ch *CallHome, options *ReverseOptions) node.Node {
+	return &nodeutil.Extend{
+		Base: nodeutil.ReflectChild(options),
+		OnChild: func(p node.Node, r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "tls":
+				if r.New {
+					options.Tls = &stock.Tls{}
+				}
+				if options.Tls != nil {
+					return stock.TlsNode(options.Tls), nil
+				}
+				return nil, nil
+			}
+			return p.Child(r)
+		},
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "connected":
+				hnd.Val = val.Bool(ch.Connected())
+			default:
+				return p.Field(r, hnd)
+			}
+			return nil
+		},
+	}
+}
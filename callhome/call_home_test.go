@@ -0,0 +1,81 @@
+package callhome
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/source"
+)
+
+func TestCallHome(t *testing.T) {
+	ypath := source.Path("../yang")
+	controller := device.New(ypath)
+	reg := NewRegistrar(nil)
+	reg.Lease = 50 * time.Millisecond
+	fc.RequireEqual(t, nil, controller.Add("fc-call-home-server", RegistrarNode(reg)))
+	var attempts int
+	ch := New(func(addr string) (device.Device, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("unreachable")
+		}
+		return controller, nil
+	})
+	states := make(chan State, 10)
+	ch.OnStatus(func(s Status) {
+		states <- s.State
+	})
+	updates := make(chan RegisterUpdate, 10)
+	ch.OnRegister(func(d device.Device, update RegisterUpdate) {
+		updates <- update
+	})
+	fc.RequireEqual(t, nil, ch.ApplyOptions(Options{
+		DeviceId:       "car1",
+		Address:        "http://controller/restconf",
+		LocalAddress:   "http://car1/restconf",
+		RetryRateMs:    1,
+		MaxRetryRateMs: 2,
+		HeartbeatMs:    60000,
+	}))
+	fc.AssertEqual(t, StateRegistering, <-states)
+	fc.AssertEqual(t, StateRetrying, <-states)
+	fc.AssertEqual(t, StateRegistering, <-states)
+	fc.AssertEqual(t, StateRetrying, <-states)
+	fc.AssertEqual(t, StateRegistering, <-states)
+	fc.AssertEqual(t, StateRegistered, <-states)
+	fc.AssertEqual(t, "", ch.Status().LastErr)
+	fc.AssertEqual(t, Register, <-updates)
+
+	// heartbeat follows lease from registrar
+	time.Sleep(4 * reg.Lease)
+	fc.AssertEqual(t, 1, len(reg.Registrations()))
+
+	ch.Stop()
+	fc.AssertEqual(t, StateIdle, <-states)
+	fc.AssertEqual(t, 0, len(reg.Registrations()))
+	fc.AssertEqual(t, Unregister, <-updates)
+}
+
+func TestCallHomeRegisterAction(t *testing.T) {
+	d := device.New(source.Path("../yang"))
+	ch := New(nil)
+	fc.RequireEqual(t, nil, ch.ApplyOptions(Options{}))
+	fc.RequireEqual(t, nil, d.Add("fc-call-home-client", CallHomeNode(ch)))
+	b, err := d.Browser("fc-call-home-client")
+	fc.RequireEqual(t, nil, err)
+	sel, err := b.Root().Find("register")
+	fc.RequireEqual(t, nil, err)
+	_, err = sel.Action(nil)
+	fc.AssertEqual(t, true, errors.Is(err, fc.BadRequestError))
+	fc.AssertEqual(t, StateIdle, ch.Status().State)
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		wait := jitter(time.Second)
+		fc.AssertEqual(t, true, wait >= time.Second/2 && wait < time.Second)
+	}
+}
@@ -0,0 +1,249 @@
+package callhome
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freeconf/restconf"
+	"github.com/freeconf/restconf/client"
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+)
+
+const DefaultLease = 5 * time.Minute
+
+// RegAddrPlaceholder in a registration address is replaced with the IP address
+// the registration came from
+const RegAddrPlaceholder = "{REG_ADDR}"
+
+// Registrar is the controller side of fc-call-home-server. Devices register
+// their address and registrar connects to them using protocol handler. As a
+// device.Map, server can proxy requests to registered devices.
+type Registrar struct {
+	// How long registrations last unless renewed. Change with SetLease once
+	// registrar is in use.
+	Lease time.Duration
+
+	proto device.ProtocolHandler
+	mu    sync.Mutex
+	regs  map[string]*Registration
+}
+
+type Registration struct {
+	DeviceId string
+	Address  string
+	RemoteIp string
+	Expires  time.Time
+
+	// Identity from client certificate of device that registered, if any
+	User string
+
+	device device.Device
+}
+
+func NewRegistrar(proto device.ProtocolHandler) *Registrar {
+	return &Registrar{
+		Lease: DefaultLease,
+		proto: proto,
+		regs:  make(map[string]*Registration),
+	}
+}
+
+// SetLease changes how long new and renewed registrations last
+func (r *Registrar) SetLease(lease time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Lease = lease
+}
+
+// LeaseDuration is how long new and renewed registrations last
+func (r *Registrar) LeaseDuration() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Lease
+}
+
+// InstallRegistrar adds fc-call-home-server to local device and serves
+// registered devices from server
+func InstallRegistrar(d *device.Local, srv *restconf.Server) (*Registrar, error) {
+	r := NewRegistrar(client.ProtocolHandler(d.SchemaSource()))
+	if err := d.Add("fc-call-home-server", RegistrarNode(r)); err != nil {
+		return nil, err
+	}
+	if err := srv.ServeDevices(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds or renews registration. Device is not contacted until it
+// is first used. Only the remote ip or user that registered device can
+// change registration until it expires.
+func (r *Registrar) Register(deviceId string, address string, remoteIp string, user string) (*Registration, error) {
+	if deviceId == "" {
+		return nil, fmt.Errorf("%w. device id required", fc.BadRequestError)
+	}
+	remoteIp = unbracket(remoteIp)
+	if strings.Contains(address, RegAddrPlaceholder) {
+		if remoteIp == "" {
+			return nil, fmt.Errorf("%w. could not determine address for %s", fc.BadRequestError, RegAddrPlaceholder)
+		}
+		host := remoteIp
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		address = strings.ReplaceAll(address, RegAddrPlaceholder, host)
+	}
+	var closing []device.Device
+	defer func() { closeDevices(closing) }()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	closing = r.purge()
+	reg, found := r.regs[deviceId]
+	if found && !reg.ownedBy(remoteIp, user) {
+		return nil, fmt.Errorf("%w. %s is registered from another address", fc.UnauthorizedError, deviceId)
+	}
+	if !found || reg.Address != address {
+		if found {
+			closing = append(closing, reg.detach()...)
+		}
+		reg = &Registration{
+			DeviceId: deviceId,
+			Address:  address,
+		}
+		r.regs[deviceId] = reg
+		fc.Debug.Printf("registered %s at %s", deviceId, address)
+	}
+	reg.RemoteIp = remoteIp
+	if user != "" {
+		reg.User = user
+	}
+	reg.Expires = time.Now().Add(r.Lease)
+	copy := *reg
+	return &copy, nil
+}
+
+// Unregister device by id, or when id is empty, all devices registered from
+// remote ip or by user.  Returns number of devices removed.
+func (r *Registrar) Unregister(deviceId string, remoteIp string, user string) (int, error) {
+	remoteIp = unbracket(remoteIp)
+	var closing []device.Device
+	defer func() { closeDevices(closing) }()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reg, found := r.regs[deviceId]; found && !reg.ownedBy(remoteIp, user) {
+		return 0, fmt.Errorf("%w. %s is registered from another address", fc.UnauthorizedError, deviceId)
+	}
+	var removed int
+	for id, reg := range r.regs {
+		mine := (remoteIp != "" && reg.RemoteIp == remoteIp) || (user != "" && reg.User == user)
+		if id == deviceId || (deviceId == "" && mine) {
+			closing = append(closing, reg.detach()...)
+			delete(r.regs, id)
+			fc.Debug.Printf("unregistered %s", id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Device implements device.Map.  Expired or unknown devices are nil
+func (r *Registrar) Device(deviceId string) (device.Device, error) {
+	r.mu.Lock()
+	closing := r.purge()
+	reg, found := r.regs[deviceId]
+	if !found || reg.device != nil {
+		r.mu.Unlock()
+		closeDevices(closing)
+		if !found {
+			return nil, nil
+		}
+		return reg.device, nil
+	}
+	address := reg.Address
+	r.mu.Unlock()
+	closeDevices(closing)
+
+	// others are not held up while connecting
+	d, err := r.proto(address)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s at %s. %w", deviceId, address, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.regs[deviceId] != reg {
+		// unregistered or moved while connecting
+		d.Close()
+		return nil, nil
+	}
+	if reg.device != nil {
+		// someone else connected first
+		d.Close()
+		return reg.device, nil
+	}
+	reg.device = d
+	return d, nil
+}
+
+// Registrations that have not expired sorted by device id
+func (r *Registrar) Registrations() []Registration {
+	var closing []device.Device
+	defer func() { closeDevices(closing) }()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	closing = r.purge()
+	regs := make([]Registration, 0, len(r.regs))
+	for _, reg := range r.regs {
+		regs = append(regs, *reg)
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		return regs[i].DeviceId < regs[j].DeviceId
+	})
+	return regs
+}
+
+// purge removes expired registrations and returns their devices to be
+// closed once lock is released
+func (r *Registrar) purge() []device.Device {
+	var closing []device.Device
+	now := time.Now()
+	for id, reg := range r.regs {
+		if now.After(reg.Expires) {
+			fc.Debug.Printf("registration for %s expired", id)
+			closing = append(closing, reg.detach()...)
+			delete(r.regs, id)
+		}
+	}
+	return closing
+}
+
+// ownedBy is true when caller is who registered device. Registrations made
+// w/o remote ip are owned by callers w/o one too.
+func (reg *Registration) ownedBy(remoteIp string, user string) bool {
+	return (user != "" && reg.User == user) || reg.RemoteIp == remoteIp
+}
+
+// unbracket is IPv6 address w/o brackets as found in host of URLs
+func unbracket(ip string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+}
+
+// detach connected device, if any, from registration so it can be closed
+// once lock is released as closing can wait on device
+func (reg *Registration) detach() []device.Device {
+	d := reg.device
+	reg.device = nil
+	if d == nil {
+		return nil
+	}
+	return []device.Device{d}
+}
+
+func closeDevices(devices []device.Device) {
+	for _, d := range devices {
+		d.Close()
+	}
+}
@@ -0,0 +1,102 @@
+package callhome
+
+import (
+	"time"
+
+	"github.com/freeconf/restconf"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// RegistrarNode is management of registrar and uses fc-call-home-server.yang
+func RegistrarNode(reg *Registrar) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "registration":
+				return registrationsNode(reg.Registrations()), nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "leaseMs":
+				if r.Write {
+					reg.SetLease(time.Duration(hnd.Val.Value().(int)) * time.Millisecond)
+				} else {
+					hnd.Val = val.Int32(reg.LeaseDuration().Milliseconds())
+				}
+			}
+			return nil
+		},
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			remoteIp, _ := r.Selection.Context.Value(restconf.RemoteIpAddressKey).(string)
+			user := secure.User(r.Selection.Context)
+			var req struct {
+				DeviceId string
+				Address  string
+			}
+			if r.Input != nil {
+				if err := r.Input.UpsertInto(&nodeutil.Node{Object: &req}); err != nil {
+					return nil, err
+				}
+			}
+			switch r.Meta.Ident() {
+			case "register":
+				if _, err := reg.Register(req.DeviceId, req.Address, remoteIp, user); err != nil {
+					return nil, err
+				}
+				resp := struct {
+					LeaseMs int
+				}{
+					LeaseMs: int(reg.LeaseDuration().Milliseconds()),
+				}
+				return &nodeutil.Node{Object: &resp}, nil
+			case "unregister":
+				if _, err := reg.Unregister(req.DeviceId, remoteIp, user); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+func registrationsNode(regs []Registration) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var found *Registration
+			if r.Key != nil {
+				id := r.Key[0].String()
+				for i := range regs {
+					if regs[i].DeviceId == id {
+						found = &regs[i]
+						break
+					}
+				}
+			} else if r.Row < len(regs) {
+				found = &regs[r.Row]
+			}
+			if found == nil {
+				return nil, nil, nil
+			}
+			return registrationNode(*found), []val.Value{val.String(found.DeviceId)}, nil
+		},
+	}
+}
+
+func registrationNode(reg Registration) node.Node {
+	return &nodeutil.Extend{
+		Base: nodeutil.ReflectChild(&reg),
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "expires":
+				hnd.Val = val.String(reg.Expires.Format(time.RFC3339))
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+	}
+}
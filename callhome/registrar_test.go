@@ -0,0 +1,111 @@
+package callhome
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf"
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/source"
+)
+
+func TestRegistrar(t *testing.T) {
+	ypath := source.Path("../yang:../testdata")
+	car := testdata.New()
+	car.Speed = 30
+	remote := device.New(ypath)
+	remote.Add("car", testdata.Manage(car))
+	var connected []string
+	proto := func(addr string) (device.Device, error) {
+		connected = append(connected, addr)
+		return remote, nil
+	}
+
+	local := device.New(ypath)
+	srv := restconf.NewServer(local)
+	defer srv.Close()
+	reg := NewRegistrar(proto)
+	fc.RequireEqual(t, nil, local.Add("fc-call-home-server", RegistrarNode(reg)))
+	fc.RequireEqual(t, nil, srv.ServeDevices(reg))
+
+	requestFrom := func(addr string, method string, url string, body string) (int, string) {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+	request := func(method string, url string, body string) (int, string) {
+		return requestFrom("10.0.0.5:40000", method, url, body)
+	}
+
+	code, body := request("POST", "/restconf/data/fc-call-home-server:register",
+		`{"deviceId":"car1","address":"http://{REG_ADDR}:8080/restconf"}`)
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"leaseMs":300000}`, body)
+
+	code, body = request("GET", "/restconf=car1/data/car:speed", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"speed":30}`, body)
+	fc.AssertEqual(t, []string{"http://10.0.0.5:8080/restconf"}, connected)
+
+	code, body = request("GET", "/restconf/data/fc-call-home-server:registration=car1/address", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"address":"http://10.0.0.5:8080/restconf"}`, body)
+
+	// only who registered can move or remove registration
+	code, _ = requestFrom("10.0.0.6:40000", "POST", "/restconf/data/fc-call-home-server:register",
+		`{"deviceId":"car1","address":"http://evil/restconf"}`)
+	fc.AssertEqual(t, 401, code)
+	code, _ = requestFrom("10.0.0.6:40000", "POST", "/restconf/data/fc-call-home-server:unregister", `{"deviceId":"car1"}`)
+	fc.AssertEqual(t, 401, code)
+	code, _ = requestFrom("10.0.0.6:40000", "POST", "/restconf/data/fc-call-home-server:unregister", "")
+	fc.AssertEqual(t, 204, code)
+	code, body = request("GET", "/restconf/data/fc-call-home-server:registration=car1/address", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"address":"http://10.0.0.5:8080/restconf"}`, body)
+
+	code, _ = requestFrom("[::1]:40000", "POST", "/restconf/data/fc-call-home-server:register",
+		`{"deviceId":"car3","address":"http://{REG_ADDR}:8080/restconf"}`)
+	fc.AssertEqual(t, 200, code)
+	code, body = request("GET", "/restconf/data/fc-call-home-server:registration=car3/address", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"address":"http://[::1]:8080/restconf"}`, body)
+	code, _ = requestFrom("[::1]:40000", "POST", "/restconf/data/fc-call-home-server:unregister", `{"deviceId":"car3"}`)
+	fc.AssertEqual(t, 204, code)
+
+	// unregister w/o id removes devices from same address
+	code, _ = request("POST", "/restconf/data/fc-call-home-server:unregister", "")
+	fc.AssertEqual(t, 204, code)
+	code, _ = request("GET", "/restconf=car1/data/car:speed", "")
+	fc.AssertEqual(t, 404, code)
+
+	t.Run("identity", func(t *testing.T) {
+		_, err := reg.Register("car4", "http://car4/restconf", "10.0.0.7", "car4")
+		fc.RequireEqual(t, nil, err)
+		moved, err := reg.Register("car4", "http://car4b/restconf", "10.0.0.8", "car4")
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, "http://car4b/restconf", moved.Address)
+		_, err = reg.Register("car4", "http://car4c/restconf", "10.0.0.9", "other")
+		fc.AssertEqual(t, true, errors.Is(err, fc.UnauthorizedError))
+		removed, err := reg.Unregister("", "", "car4")
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, 1, removed)
+	})
+
+	t.Run("lease", func(t *testing.T) {
+		reg.Lease = time.Millisecond
+		_, err := reg.Register("car2", "http://car2/restconf", "", "")
+		fc.RequireEqual(t, nil, err)
+		time.Sleep(5 * time.Millisecond)
+		d, err := reg.Device("car2")
+		fc.AssertEqual(t, nil, err)
+		fc.AssertEqual(t, nil, d)
+		fc.AssertEqual(t, 0, len(reg.Registrations()))
+	})
+}
@@ -0,0 +1,396 @@
+package callhome
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/freeconf/restconf"
+	"github.com/freeconf/restconf/client"
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/source"
+)
+
+// DefaultPort is IANA assigned port for RESTCONF call home
+const DefaultPort = "4336"
+
+const DefaultRetryRate = 10 * time.Second
+
+// HTTP/2 lets controller send concurrent requests and hold subscriptions
+// open over the single connection
+var nextProtos = []string{"h2", "http/1.1"}
+
+// Dialer is the device side of RFC 8071 call home.  Device connects to
+// controller then acts as TLS server and answers RESTCONF requests that come
+// over that connection.  When connection is lost, device calls home again.
+//
+//	https://www.rfc-editor.org/rfc/rfc8071.html
+type Dialer struct {
+	// host:port of controller's call home listener. Port defaults to 4336
+	Address string
+
+	// Must have certificate for device and ClientCAs to verify controller.
+	// Controllers must present a certificate signed by ClientCAs as
+	// ClientAuth is always tls.RequireAndVerifyClientCert.
+	Tls *tls.Config
+
+	// Typically restconf.Server
+	Handler http.Handler
+
+	RetryRate time.Duration
+
+	mu        sync.Mutex
+	connected bool
+	stop      chan struct{}
+	conn      net.Conn
+}
+
+func (d *Dialer) Connected() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.connected
+}
+
+// Start calling home in background until Stop is called
+func (d *Dialer) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		return
+	}
+	d.stop = make(chan struct{})
+	go d.run(d.stop)
+}
+
+func (d *Dialer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	d.stop = nil
+	if d.conn != nil {
+		d.conn.Close()
+	}
+}
+
+func (d *Dialer) run(stop chan struct{}) {
+	retry := d.RetryRate
+	if retry == 0 {
+		retry = DefaultRetryRate
+	}
+	for {
+		if err := d.serve(stop); err != nil {
+			fc.Err.Printf("call home to %s failed. %s", d.Address, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// serve blocks until connection is closed
+func (d *Dialer) serve(stop chan struct{}) error {
+	cfg, err := serverTls(d.Tls)
+	if err != nil {
+		return err
+	}
+	raw, err := net.Dial("tcp", withDefaultPort(d.Address))
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	select {
+	case <-stop:
+		d.mu.Unlock()
+		raw.Close()
+		return nil
+	default:
+	}
+	d.conn = raw
+	d.connected = true
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.conn = nil
+		d.connected = false
+		d.mu.Unlock()
+	}()
+	fc.Debug.Printf("called home to %s", d.Address)
+	conn := tls.Server(raw, cfg)
+	l := newConnListener(conn)
+	srv := &http.Server{
+		Handler: d.Handler,
+		ConnState: func(c net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				l.Close()
+			}
+		},
+	}
+	err = srv.Serve(l)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// serverTls only answers controllers with certificates signed by ClientCAs
+// otherwise any host the device calls, or that intercepts the call, could
+// manage the device
+func serverTls(cfg *tls.Config) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, errors.New("call home requires tls config with device certificate")
+	}
+	copy := cfg.Clone()
+	if get := copy.GetConfigForClient; get != nil {
+		copy.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := get(hello)
+			if c == nil || err != nil {
+				return c, err
+			}
+			return verifyController(c.Clone())
+		}
+		if copy.ClientCAs == nil {
+			// settings come from GetConfigForClient
+			return copy, nil
+		}
+	}
+	return verifyController(copy)
+}
+
+func verifyController(cfg *tls.Config) (*tls.Config, error) {
+	if cfg.ClientCAs == nil {
+		// otherwise system roots would vouch for any controller
+		return nil, errors.New("call home requires ClientCAs to verify controller")
+	}
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = nextProtos
+	}
+	return cfg, nil
+}
+
+func withDefaultPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, DefaultPort)
+	}
+	return address
+}
+
+// connListener hands out single connection to http.Server
+type connListener struct {
+	conn   chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+	addr   net.Addr
+}
+
+func newConnListener(c net.Conn) *connListener {
+	l := &connListener{
+		conn:   make(chan net.Conn, 1),
+		closed: make(chan struct{}),
+		addr:   c.LocalAddr(),
+	}
+	l.conn <- c
+	return l
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conn:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// Listener is the controller side of RFC 8071 call home.  Each device that
+// calls home is yielded from Accept as a device.Device that sends requests
+// over the connection the device made.
+type Listener struct {
+	// Root CAs verify devices and certificates are presented to devices
+	// that verify controller. When ServerName is empty, device certificate
+	// is verified but not its name as device address is not known ahead of
+	// time so RootCAs are required.
+	Tls *tls.Config
+
+	YangPath   source.Opener
+	Compliance restconf.ComplianceOptions
+
+	// How long to wait for device to complete TLS handshake
+	HandshakeTimeout time.Duration
+
+	l net.Listener
+}
+
+const DefaultHandshakeTimeout = 30 * time.Second
+
+// Listen for devices calling home.  Address defaults to port 4336
+func Listen(address string, tlsConfig *tls.Config, ypath source.Opener) (*Listener, error) {
+	if address == "" {
+		address = ":" + DefaultPort
+	}
+	if _, err := clientTls(tlsConfig); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{
+		Tls:              tlsConfig,
+		YangPath:         ypath,
+		HandshakeTimeout: DefaultHandshakeTimeout,
+		l:                l,
+	}, nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+func (l *Listener) Close() error {
+	return l.l.Close()
+}
+
+// Accept blocks until next device calls home. Devices that fail to connect
+// are logged and skipped.
+func (l *Listener) Accept() (*Reverse, error) {
+	for {
+		raw, err := l.l.Accept()
+		if err != nil {
+			return nil, err
+		}
+		d, err := l.connect(raw)
+		if err != nil {
+			fc.Err.Printf("call home from %s failed. %s", raw.RemoteAddr(), err)
+			raw.Close()
+			continue
+		}
+		return d, nil
+	}
+}
+
+func (l *Listener) connect(raw net.Conn) (*Reverse, error) {
+	cfg, err := clientTls(l.Tls)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), l.HandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "h2" {
+		// one connection cannot carry concurrent requests otherwise
+		return nil, fmt.Errorf("device must negotiate h2 not '%s'", proto)
+	}
+	r := &Reverse{
+		DeviceId: raw.RemoteAddr().String(),
+		conn:     conn,
+	}
+	if peers := conn.ConnectionState().PeerCertificates; len(peers) > 0 && peers[0].Subject.CommonName != "" {
+		r.DeviceId = peers[0].Subject.CommonName
+	}
+	var dialed bool
+	var mu sync.Mutex
+	r.transport = &http.Transport{
+		ForceAttemptHTTP2: true,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if dialed {
+				return nil, fmt.Errorf("call home connection from %s %w", r.DeviceId, net.ErrClosed)
+			}
+			dialed = true
+			return conn, nil
+		},
+	}
+	c := client.Client{
+		YangPath:   l.YangPath,
+		Complance:  l.Compliance,
+		HttpClient: &http.Client{Transport: r.transport},
+	}
+	if r.Device, err = c.NewDevice(fmt.Sprintf("https://%s/restconf", raw.RemoteAddr())); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func clientTls(cfg *tls.Config) (*tls.Config, error) {
+	var copy *tls.Config
+	if cfg == nil {
+		copy = &tls.Config{}
+	} else {
+		copy = cfg.Clone()
+	}
+	if len(copy.NextProtos) == 0 {
+		copy.NextProtos = []string{"h2"}
+	}
+	if copy.ServerName == "" && !copy.InsecureSkipVerify {
+		if copy.RootCAs == nil {
+			// otherwise system roots would vouch for any device
+			return nil, errors.New("call home requires RootCAs to verify devices when there is no ServerName")
+		}
+		roots := copy.RootCAs
+		copy.InsecureSkipVerify = true
+		copy.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("device did not present certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		}
+	}
+	return copy, nil
+}
+
+// Reverse is a device that called home.
+type Reverse struct {
+	device.Device
+
+	// Common name of device certificate or remote address when there is none
+	DeviceId string
+
+	conn      *tls.Conn
+	transport *http.Transport
+}
+
+func (r *Reverse) RemoteAddr() net.Addr {
+	return r.conn.RemoteAddr()
+}
+
+func (r *Reverse) Close() {
+	r.transport.CloseIdleConnections()
+	r.conn.Close()
+}
@@ -0,0 +1,146 @@
+package callhome
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf"
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/source"
+	"github.com/freeconf/yang/val"
+)
+
+func TestReverse(t *testing.T) {
+	ypath := source.Path("../yang:../testdata")
+	ca, err := (&secure.Generator{CommonName: "ca"}).CA()
+	fc.RequireEqual(t, nil, err)
+	issue := func(name string) tls.Certificate {
+		c, err := (&secure.Generator{CommonName: name, DNSNames: []string{name}}).Cert(ca)
+		fc.RequireEqual(t, nil, err)
+		return tls.Certificate{Certificate: [][]byte{c.Raw}, PrivateKey: c.PrivateKey}
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	// controller
+	l, err := Listen("127.0.0.1:0", &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{issue("controller")},
+	}, ypath)
+	fc.RequireEqual(t, nil, err)
+	defer l.Close()
+
+	// device behind a firewall
+	car := testdata.New()
+	car.Speed = 30
+	local := device.New(ypath)
+	local.Add("car", testdata.Manage(car))
+	srv := restconf.NewServer(local)
+	defer srv.Close()
+	dialer := &Dialer{
+		Address: l.Addr().String(),
+		Tls: &tls.Config{
+			Certificates: []tls.Certificate{issue("car1")},
+			ClientCAs:    roots,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		},
+		Handler:   srv,
+		RetryRate: 10 * time.Millisecond,
+	}
+	dialer.Start()
+	defer dialer.Stop()
+
+	d, err := l.Accept()
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "car1", d.DeviceId)
+	b, err := d.Browser("car")
+	fc.RequireEqual(t, nil, err)
+	speed, err := b.Root().Find("speed")
+	fc.RequireEqual(t, nil, err)
+	actual, err := speed.Get()
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, val.Int32(30), actual)
+	fc.AssertEqual(t, nil, b.Root().UpsertFrom(readJson(`{"speed":40}`)))
+	fc.AssertEqual(t, 40, car.Speed)
+
+	// device calls home again when connection is lost
+	d.Close()
+	d, err = l.Accept()
+	fc.RequireEqual(t, nil, err)
+	defer d.Close()
+	fc.AssertEqual(t, "car1", d.DeviceId)
+}
+
+func TestReverseRequirements(t *testing.T) {
+	ypath := source.Path("../yang:../testdata")
+	ca, err := (&secure.Generator{CommonName: "ca"}).CA()
+	fc.RequireEqual(t, nil, err)
+	c, err := (&secure.Generator{CommonName: "car1", DNSNames: []string{"car1"}}).Cert(ca)
+	fc.RequireEqual(t, nil, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	t.Run("roots", func(t *testing.T) {
+		_, err := Listen("127.0.0.1:0", &tls.Config{}, ypath)
+		fc.AssertEqual(t, true, err != nil)
+	})
+
+	t.Run("h2", func(t *testing.T) {
+		l := &Listener{Tls: &tls.Config{RootCAs: roots}, HandshakeTimeout: time.Second}
+		controller, device := net.Pipe()
+		defer controller.Close()
+		go func() {
+			// device that does not negotiate any protocol
+			conn := tls.Server(device, &tls.Config{
+				Certificates: []tls.Certificate{{Certificate: [][]byte{c.Raw}, PrivateKey: c.PrivateKey}},
+			})
+			conn.Handshake()
+		}()
+		_, err := l.connect(controller)
+		fc.RequireEqual(t, true, err != nil)
+		fc.AssertEqual(t, true, strings.Contains(err.Error(), "h2"))
+	})
+
+	t.Run("clientCAs", func(t *testing.T) {
+		_, err := serverTls(&tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{c.Raw}, PrivateKey: c.PrivateKey}},
+		})
+		fc.AssertEqual(t, true, err != nil)
+	})
+
+	t.Run("controller cert", func(t *testing.T) {
+		cfg, err := serverTls(&tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{c.Raw}, PrivateKey: c.PrivateKey}},
+			ClientCAs:    roots,
+		})
+		fc.RequireEqual(t, nil, err)
+		controller, device := net.Pipe()
+		defer controller.Close()
+		defer device.Close()
+		go func() {
+			// controller without a certificate
+			conn := tls.Client(controller, &tls.Config{RootCAs: roots, ServerName: "car1"})
+			conn.Handshake()
+			conn.Read(make([]byte, 1))
+		}()
+		conn := tls.Server(device, cfg)
+		fc.AssertEqual(t, true, conn.Handshake() != nil)
+	})
+}
+
+func readJson(s string) node.Node {
+	n, err := nodeutil.ReadJSON(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
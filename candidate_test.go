@@ -0,0 +1,57 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestCandidate(t *testing.T) {
+	ypath := source.Path("./testdata:./yang")
+	birds := map[string]*testdata.Bird{"robin": {Name: "robin"}}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"candidate": map[string]interface{}{},
+		},
+	}))
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := request("POST", "/restconf/ds/ietf-datastores:candidate/bird:bird", `{"bird":[{"name":"owl"}]}`)
+	fc.AssertEqual(t, 201, code)
+	_, body := request("GET", "/restconf/ds/ietf-datastores:candidate/bird:bird=owl", "")
+	fc.AssertEqual(t, `{"name":"owl"}`, body)
+	_, applied := birds["owl"]
+	fc.AssertEqual(t, false, applied)
+	code, _ = request("GET", "/restconf/ds/ietf-datastores:running/bird:bird=owl", "")
+	fc.AssertEqual(t, 404, code)
+
+	code, _ = request("POST", "/restconf/operations/fc-restconf:validate", "")
+	fc.AssertEqual(t, 204, code)
+	code, _ = request("POST", "/restconf/operations/fc-restconf:commit", `{"confirmed":true}`)
+	fc.AssertEqual(t, 204, code)
+	_, body = request("GET", "/restconf/data/fc-restconf:candidate", "")
+	fc.AssertEqual(t, `{"confirmPending":true}`, body)
+	_, applied = birds["owl"]
+	fc.AssertEqual(t, true, applied)
+	code, _ = request("POST", "/restconf/operations/fc-restconf:cancelCommit", "")
+	fc.AssertEqual(t, 204, code)
+	_, applied = birds["owl"]
+	fc.AssertEqual(t, false, applied)
+
+	code, _ = request("GET", "/restconf/ds/ietf-datastores:intended/bird:bird", "")
+	fc.AssertEqual(t, 404, code)
+}
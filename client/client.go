@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/freeconf/restconf"
@@ -30,6 +31,14 @@ import (
 type Client struct {
 	YangPath  source.Opener
 	Complance restconf.ComplianceOptions
+
+	// Optional: used for connections that are already established like
+	// call home connections
+	HttpClient *http.Client
+
+	// Subscribe to yang-library-update and reload modules when server's
+	// modules change
+	WatchModules bool
 }
 
 func ProtocolHandler(ypath source.Opener) device.ProtocolHandler {
@@ -76,12 +85,15 @@ func (factory Client) NewDevice(url string) (device.Device, error) {
 	if err != nil {
 		return nil, err
 	}
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
+	httpClient := factory.HttpClient
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
 			},
-		},
+		}
 	}
 	remoteSchemaPath := httpStream{
 		ypath:  factory.YangPath,
@@ -95,15 +107,14 @@ func (factory Client) NewDevice(url string) (device.Device, error) {
 		client:     httpClient,
 		compliance: factory.Complance,
 	}
-	d := &clientNode{support: c, device: address.DeviceId, compliance: c.compliance}
-	m := parser.RequireModule(factory.YangPath, "ietf-yang-library")
-	b := node.NewBrowser(m, d.node())
-	modules, err := device.LoadModules(b, remoteSchemaPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not load modules. %s", err)
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+	if factory.WatchModules {
+		if err := c.watchModules(); err != nil {
+			return nil, err
+		}
 	}
-	fc.Debug.Printf("loaded modules %v", modules)
-	c.modules = modules
 	return c, nil
 }
 
@@ -114,6 +125,45 @@ type client struct {
 	client     *http.Client
 	modules    map[string]*meta.Module
 	compliance restconf.ComplianceOptions
+	mu         sync.RWMutex
+	unwatch    node.NotifyCloser
+}
+
+func (c *client) yangLibBrowser() *node.Browser {
+	d := &clientNode{support: c, device: c.address.DeviceId, compliance: c.compliance}
+	m := parser.RequireModule(c.yangPath, "ietf-yang-library")
+	return node.NewBrowser(m, d.node())
+}
+
+// Refresh reloads list of modules from server dropping any cached schemas
+func (c *client) Refresh() error {
+	remoteSchemaPath := httpStream{
+		ypath:  c.yangPath,
+		client: c.client,
+		url:    c.address.Schema,
+	}
+	modules, err := device.LoadModules(c.yangLibBrowser(), remoteSchemaPath)
+	if err != nil {
+		return fmt.Errorf("could not load modules. %s", err)
+	}
+	fc.Debug.Printf("loaded modules %v", modules)
+	c.mu.Lock()
+	c.modules = modules
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *client) watchModules() error {
+	sel, err := c.yangLibBrowser().Root().Find("yang-library-update")
+	if err != nil {
+		return err
+	}
+	c.unwatch, err = sel.Notifications(func(n node.Notification) {
+		if err := c.Refresh(); err != nil {
+			fc.Err.Printf("could not refresh modules of %s. %s", c.address.Base, err)
+		}
+	})
+	return err
 }
 
 func (c *client) SchemaSource() source.Opener {
@@ -138,21 +188,40 @@ func (c *client) Browser(module string) (*node.Browser, error) {
 }
 
 func (c *client) Close() {
+	if c.unwatch != nil {
+		c.unwatch()
+		c.unwatch = nil
+	}
+}
+
+// BaseAddress lets gateways forward requests to this device as is
+func (c *client) BaseAddress() string {
+	return c.address.Base
+}
+
+func (c *client) HttpClient() *http.Client {
+	return c.client
 }
 
 func (c *client) Modules() map[string]*meta.Module {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.modules
 }
 
 func (c *client) module(module string) (*meta.Module, error) {
 	// caching module, but should replace w/cache that can refresh on stale
+	c.mu.RLock()
 	m := c.modules[module]
+	c.mu.RUnlock()
 	if m == nil {
 		var err error
 		if m, err = parser.LoadModule(c.schemaPath, module); err != nil {
 			return nil, err
 		}
+		c.mu.Lock()
 		c.modules[module] = m
+		c.mu.Unlock()
 	}
 	return m, nil
 }
@@ -65,7 +65,7 @@ func (cn *clientNode) node() node.Node {
 		}
 		if r.Delete {
 			target := &node.Path{Parent: r.Selection.Path, Meta: r.Meta}
-			_, err := cn.request("DELETE", target, nil)
+			_, err := cn.request("DELETE", "", target, nil)
 			return nil, err
 		}
 		if cn.edit != nil {
@@ -138,7 +138,12 @@ func (cn *clientNode) node() node.Node {
 		if r.Delete {
 			return nil
 		}
-		_, err := cn.request(cn.method, r.Selection.Path, r.Selection.Split(cn.changes))
+		var params string
+		if ins, found := restconf.InsertPosition(r.Selection.Context); found && (cn.method == "POST" || cn.method == "PUT") {
+			// see restconf.WithInsert
+			params = ins.Query()
+		}
+		_, err := cn.request(cn.method, params, r.Selection.Path, r.Selection.Split(cn.changes))
 		return err
 	}
 	return n
@@ -180,7 +185,7 @@ func (cn *clientNode) startEditMode(path *node.Path) error {
 }
 
 func (cn *clientNode) validNavigation(target *node.Path) (bool, error) {
-	_, err := cn.request("OPTIONS", target, nil)
+	_, err := cn.request("OPTIONS", "", target, nil)
 	if errors.Is(err, fc.NotFoundError) {
 		return false, nil
 	}
@@ -208,14 +213,14 @@ func jsonNode(in io.ReadCloser) (node.Node, error) {
 
 }
 
-func (cn *clientNode) request(method string, p *node.Path, in *node.Selection) (node.Node, error) {
+func (cn *clientNode) request(method string, params string, p *node.Path, in *node.Selection) (node.Node, error) {
 	var payload bytes.Buffer
 	if in != nil {
 		if err := in.InsertInto(jsonWtr(cn.compliance, &payload)); err != nil {
 			return nil, err
 		}
 	}
-	resp, err := cn.support.clientDo(method, "", p, &payload)
+	resp, err := cn.support.clientDo(method, params, p, &payload)
 	if err != nil || resp == nil {
 		return nil, err
 	}
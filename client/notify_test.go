@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -89,3 +90,29 @@ func TestClientNotif(t *testing.T) {
 	fc.AssertEqual(t, nil, testClient(restconf.Simplified))
 	fc.AssertEqual(t, nil, testClient(restconf.Strict))
 }
+
+func TestClientWatchModules(t *testing.T) {
+	ypath := source.Path("../testdata:../yang")
+	m := parser.RequireModule(ypath, "x")
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(m, &nodeutil.Basic{}))
+	s := restconf.NewServer(d)
+	web := httptest.NewServer(s)
+	defer web.Close()
+	factory := Client{YangPath: ypath, WatchModules: true}
+	dev, err := factory.NewDevice(web.URL + "/restconf")
+	fc.RequireEqual(t, nil, err)
+	defer dev.Close()
+	_, found := dev.Modules()["x"]
+	fc.AssertEqual(t, true, found)
+	_, importOnly := dev.Modules()["ietf-yang-types"]
+	fc.AssertEqual(t, false, importOnly)
+
+	time.Sleep(200 * time.Millisecond)
+	d.Remove("x")
+	for i := 0; found && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, found = dev.Modules()["x"]
+	}
+	fc.AssertEqual(t, false, found)
+}
@@ -0,0 +1,61 @@
+package restconf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/estream"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestConfigChanges(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin"},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	s.Filters = append(s.Filters, func(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, error) {
+		return secure.WithUser(ctx, "joe"), nil
+	})
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"configChanges": map[string]interface{}{},
+		},
+	}))
+	events, err := estream.ConfigChangeStream(d).Open()
+	fc.RequireEqual(t, nil, err)
+	var msgs []string
+	unsubscribe, err := events.Notifications(func(n node.Notification) {
+		msg, _ := nodeutil.WriteJSON(n.Event)
+		msgs = append(msgs, msg)
+	})
+	fc.RequireEqual(t, nil, err)
+	defer unsubscribe()
+	request := func(method string, url string, body string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code
+	}
+
+	fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/bird:bird=robin", `{"wingspan":10}`))
+	fc.AssertEqual(t, 201, request("POST", "/restconf/data/bird:bird", `{"bird":[{"name":"owl"}]}`))
+	fc.AssertEqual(t, 204, request("DELETE", "/restconf/data/bird:bird=robin", ""))
+	fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/bird:bird=owl?fc.dry-run", `{"wingspan":3}`))
+	fc.AssertEqual(t, []string{
+		`{"changed-by":{"username":"joe","session-id":0},"datastore":"running","edit":[{"target":"/bird:bird[name='robin']/wingspan","operation":"replace"}]}`,
+		`{"changed-by":{"username":"joe","session-id":0},"datastore":"running","edit":[{"target":"/bird:bird[name='owl']","operation":"create"}]}`,
+		`{"changed-by":{"username":"joe","session-id":0},"datastore":"running","edit":[{"target":"/bird:bird[name='robin']","operation":"delete"}]}`,
+	}, msgs)
+}
@@ -0,0 +1,171 @@
+package restconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// dataExistsError is POST trying to create data that is already there
+type dataExistsError struct {
+	err error
+}
+
+func (e *dataExistsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *dataExistsError) Unwrap() error {
+	return e.err
+}
+
+// postInsert is POST of body into target. Entries of a list under target go
+// into list itself as inserting list from parent conflicts once list has
+// entries.
+func postInsert(target *node.Selection, body []byte) error {
+	n, err := nodeutil.ReadJSONIO(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	sel := target
+	if m, _ := postedData(target, body); m != nil && m != target.Meta() {
+		if _, isList := m.(*meta.List); isList {
+			list, err := target.Find(m.Ident())
+			if err != nil {
+				return err
+			}
+			if list != nil {
+				defer list.Release()
+				sel = list
+			}
+		}
+	}
+	err = sel.InsertFrom(n)
+	if errors.Is(err, fc.ConflictError) {
+		return &dataExistsError{err: err}
+	}
+	return err
+}
+
+// findCreateParent is where PUT creates data at path that does not exist yet
+// along with definition of what is created. New list entries are created from
+// list itself, same as POST. Nil parent when parent does not exist either.
+func findCreateParent(root *node.Selection, path string) (*node.Selection, meta.Definition, error) {
+	parentPath, seg := "", path
+	if slash := strings.LastIndex(path, "/"); slash >= 0 {
+		parentPath, seg = path[:slash], path[slash+1:]
+	}
+	listPath, _, isListEntry := strings.Cut(seg, "=")
+	if isListEntry {
+		parentPath = strings.TrimPrefix(parentPath+"/"+listPath, "/")
+	}
+	var parent *node.Selection
+	var err error
+	if parentPath == "" {
+		parent = root
+	} else if parent, err = root.Find(parentPath); err != nil || parent == nil {
+		return nil, nil, err
+	}
+	if isListEntry {
+		if _, isList := parent.Meta().(*meta.List); !isList {
+			return nil, nil, nil
+		}
+		return parent, parent.Meta(), nil
+	}
+	ident := seg
+	if _, local, qualified := strings.Cut(ident, ":"); qualified {
+		ident = local
+	}
+	m := meta.Find(parent.Meta(), ident)
+	if m == nil {
+		return nil, nil, nil
+	}
+	return parent, m, nil
+}
+
+// postedData is definition and content of data POST body creates. Target
+// itself when target is list, nil when it cannot be told from body.
+func postedData(target *node.Selection, body []byte) (meta.Definition, interface{}) {
+	var data map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil || len(data) != 1 {
+		return nil, nil
+	}
+	var ident string
+	var content interface{}
+	for k, v := range data {
+		ident, content = k, v
+	}
+	if _, local, qualified := strings.Cut(ident, ":"); qualified {
+		ident = local
+	}
+	if list, isList := target.Meta().(*meta.List); isList && len(target.Key()) == 0 && list.Ident() == ident {
+		return list, content
+	}
+	return meta.Find(target.Meta(), ident), content
+}
+
+// createdPath is path relative to target of data POST body creates e.g.
+// =owl when target is list itself or /bird=owl when target is the parent.
+// Empty when it cannot be told from body.
+func createdPath(target *node.Selection, body []byte) string {
+	m, content := postedData(target, body)
+	if m == nil {
+		return ""
+	}
+	if m == target.Meta() {
+		return listEntryKey(m.(*meta.List), content)
+	}
+	if list, isList := m.(*meta.List); isList {
+		if key := listEntryKey(list, content); key != "" {
+			return "/" + list.Ident() + key
+		}
+		return ""
+	}
+	return "/" + m.Ident()
+}
+
+// listEntryKey is key of first entry in list in form of RFC8040 3.5.3
+// e.g. =owl or =a%2Cb,c
+func listEntryKey(list *meta.List, content interface{}) string {
+	entries, valid := content.([]interface{})
+	if !valid || len(entries) == 0 {
+		return ""
+	}
+	entry, valid := entries[0].(map[string]interface{})
+	if !valid {
+		return ""
+	}
+	keyMeta := list.KeyMeta()
+	if len(keyMeta) == 0 {
+		return ""
+	}
+	keys := make([]string, len(keyMeta))
+	for i, k := range keyMeta {
+		v, found := entry[k.Ident()]
+		if !found {
+			return ""
+		}
+		keys[i] = strings.ReplaceAll(url.PathEscape(fmt.Sprint(v)), ",", "%2C")
+	}
+	return "=" + strings.Join(keys, ",")
+}
+
+// location is where client finds data created at path relative to request
+func location(r *http.Request, relPath string) string {
+	base, _, _ := strings.Cut(r.RequestURI, "?")
+	if strings.HasSuffix(base, ":") {
+		relPath = strings.TrimPrefix(relPath, "/")
+	}
+	return base + relPath
+}
@@ -0,0 +1,84 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestStatusCodes(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin", Wingspan: 10},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	var pre []Edit
+	s.PreCommit = append(s.PreCommit, func(e Edit) error {
+		pre = append(pre, e)
+		return nil
+	})
+	request := func(method string, url string, body string) (int, string, string) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Content-Type", string(YangDataJsonMimeType1))
+		s.ServeHTTP(w, r)
+		return w.Code, w.Header().Get("Location"), w.Body.String()
+	}
+
+	code, loc, _ := request("POST", "/restconf/data/bird:bird", `{"bird:bird":[{"name":"blue jay, eastern"}]}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, "/restconf/data/bird:bird=blue%20jay%2C%20eastern", loc)
+	_, found := birds["blue jay, eastern"]
+	fc.AssertEqual(t, true, found)
+
+	code, loc, _ = request("POST", "/restconf/data/bird:bird=robin", `{"bird:species":{"name":"thrush"}}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, "/restconf/data/bird:bird=robin/species", loc)
+
+	code, loc, _ = request("POST", "/restconf/data/bird:bird=robin", `{"bird:wingspan":11,"bird:species":{"name":"thrush"}}`)
+	fc.AssertEqual(t, 400, code)
+	fc.AssertEqual(t, "", loc)
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+
+	code, loc, _ = request("POST", "/restconf/data/bird:bird", `{"bird:bird":[{"wingspan":3}]}`)
+	fc.AssertEqual(t, 400, code)
+	fc.AssertEqual(t, "", loc)
+
+	code, _, body := request("POST", "/restconf/data/bird:bird", `{"bird:bird":[{"name":"robin"}]}`)
+	fc.AssertEqual(t, 409, code)
+	fc.AssertEqual(t, true, strings.Contains(body, `"error-tag":"data-exists"`))
+
+	code, loc, _ = request("PUT", "/restconf/data/bird:bird=owl", `{"bird:bird":[{"name":"owl","wingspan":3}]}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, "/restconf/data/bird:bird=owl", loc)
+	fc.RequireEqual(t, true, birds["owl"] != nil)
+	fc.AssertEqual(t, 3, birds["owl"].Wingspan)
+	fc.AssertEqual(t, true, pre[len(pre)-1].Old == nil)
+	fc.AssertEqual(t, "owl", pre[len(pre)-1].New["name"])
+
+	code, loc, _ = request("PUT", "/restconf/data/bird:bird=owl", `{"bird:bird":[{"name":"owl","wingspan":4}]}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, "", loc)
+	fc.AssertEqual(t, 4, birds["owl"].Wingspan)
+
+	code, _, _ = request("PUT", "/restconf/data/bird:bird=owl/nest", `{"bird:nest":{}}`)
+	fc.AssertEqual(t, 404, code)
+
+	code, _, body = request("PATCH", "/restconf/data/bird:bird=owl", `{"bird:wingspan":5}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, "", body)
+
+	code, _, _ = request("DELETE", "/restconf/data/bird:bird=owl", "")
+	fc.AssertEqual(t, 204, code)
+	_, found = birds["owl"]
+	fc.AssertEqual(t, false, found)
+}
@@ -0,0 +1,331 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/source"
+)
+
+// Implementation of the candidate datastore and confirmed commit from
+// RFC6241. Edits are made to a copy of running config and only reach the
+// running nodes on commit.
+
+// DefaultConfirmTimeout is how long a confirmed commit waits for a
+// confirming commit before rolling back
+const DefaultConfirmTimeout = 600 * time.Second
+
+// ConfirmRetryRate is how often a timed out confirmed commit tries to roll
+// back again while someone else has running config locked
+var ConfirmRetryRate = 10 * time.Second
+
+// Candidate is config staged for running datastore of a local device.
+// Candidate implements Device so edits can be served like any other device.
+type Candidate struct {
+	d        *Local
+	mu       sync.Mutex
+	config   map[string]map[string]interface{}
+	browsers map[string]*node.Browser
+
+	// running config of modules before first unconfirmed commit
+	backup map[string]interface{}
+	timer  *time.Timer
+
+	// who made unconfirmed commit, timeout rolls back as them
+	confirmOwner LockOwner
+}
+
+// EnableCandidate adds candidate datastore if there isn't one already
+func (self *Local) EnableCandidate() *Candidate {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.candidate == nil {
+		self.candidate = &Candidate{d: self}
+		self.candidate.reset()
+	}
+	return self.candidate
+}
+
+// Candidate datastore or nil if not enabled
+func (self *Local) Candidate() *Candidate {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.candidate
+}
+
+// Datastores implements HasDatastores
+func (self *Local) Datastores() []string {
+	if self.Candidate() == nil {
+		return DefaultDatastores
+	}
+	return append([]string{"ietf-datastores:candidate"}, DefaultDatastores...)
+}
+
+func (c *Candidate) SchemaSource() source.Opener {
+	return c.d.SchemaSource()
+}
+
+func (c *Candidate) UiSource() source.Opener {
+	return c.d.UiSource()
+}
+
+func (c *Candidate) Modules() map[string]*meta.Module {
+	return c.d.Modules()
+}
+
+func (c *Candidate) Close() {
+}
+
+// Browser to candidate config of module. Starts as copy of running config
+// the first time module is accessed since last commit or discard.
+func (c *Candidate) Browser(module string) (*node.Browser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, found := c.browsers[module]; found {
+		return b, nil
+	}
+	running, err := c.d.Browser(module)
+	if running == nil || err != nil {
+		return nil, err
+	}
+	data, err := readConfig(running)
+	if err != nil {
+		return nil, err
+	}
+	c.config[module] = data
+	b := node.NewBrowser(running.Meta, nodeutil.ReflectChild(data))
+	c.browsers[module] = b
+	return b, nil
+}
+
+func (c *Candidate) reset() {
+	c.config = make(map[string]map[string]interface{})
+	c.browsers = make(map[string]*node.Browser)
+}
+
+// changes is candidate config of each module that differs from running
+func (c *Candidate) changes() (map[string]interface{}, []string, error) {
+	config := make(map[string]interface{})
+	var modules []string
+	for module, data := range c.config {
+		b, _ := c.d.Browser(module)
+		if b == nil {
+			return nil, nil, fmt.Errorf("%w. browser not found: %s", fc.NotFoundError, module)
+		}
+		running, err := readConfig(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidate, err := normalize(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !reflect.DeepEqual(running, candidate) {
+			config[module] = candidate
+			modules = append(modules, module)
+		}
+	}
+	sort.Strings(modules)
+	return config, modules, nil
+}
+
+// normalize makes data comparable to config read from running nodes
+func normalize(data map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	err = json.Unmarshal(encoded, &normalized)
+	return normalized, err
+}
+
+// Changed are the modules whose candidate config differs from running
+func (c *Candidate) Changed() ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, modules, err := c.changes()
+	return modules, err
+}
+
+// Validate checks candidate config without applying it
+func (c *Candidate) Validate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	config, _, err := c.changes()
+	if err != nil {
+		return err
+	}
+	return errors.Join(c.d.validateStartup(config)...)
+}
+
+// Discard changes so candidate is same as running again
+func (c *Candidate) Discard() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset()
+}
+
+// Commit applies candidate to running as one transaction. Also confirms a
+// pending confirmed commit. Fails when someone other than owner has running
+// config locked or made the pending confirmed commit.
+func (c *Candidate) Commit(owner LockOwner) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkConfirmOwner(owner); err != nil {
+		return err
+	}
+	if err := c.commit(owner); err != nil {
+		return err
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+		c.backup = nil
+	}
+	return nil
+}
+
+// ConfirmedCommit applies candidate to running but rolls back to config
+// running had before unless Commit is called within timeout. Calling
+// again before timeout extends timeout and keeps original rollback point.
+func (c *Candidate) ConfirmedCommit(owner LockOwner, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkConfirmOwner(owner); err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+	if c.backup == nil {
+		c.backup = make(map[string]interface{})
+	}
+	var added []string
+	for module := range c.config {
+		if _, found := c.backup[module]; found {
+			continue
+		}
+		b, _ := c.d.Browser(module)
+		if b == nil {
+			continue
+		}
+		data, err := readConfig(b)
+		if err != nil {
+			return err
+		}
+		c.backup[module] = data
+		added = append(added, module)
+	}
+	if err := c.commit(owner); err != nil {
+		for _, module := range added {
+			delete(c.backup, module)
+		}
+		if len(c.backup) == 0 {
+			c.backup = nil
+		}
+		return err
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.confirmOwner = owner
+	c.startTimer(timeout)
+	return nil
+}
+
+// startTimer rolls back when nothing confirms or cancels before wait
+func (c *Candidate) startTimer(wait time.Duration) {
+	var timer *time.Timer
+	timer = time.AfterFunc(wait, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.timer != timer {
+			// confirmed, cancelled or extended since
+			return
+		}
+		fc.Err.Printf("confirmed commit not confirmed in %s, rolling back", wait)
+		if err := c.rollback(c.confirmOwner); err != nil {
+			fc.Err.Printf("could not roll back confirmed commit. %s", err)
+			var denied *LockDeniedError
+			if errors.As(err, &denied) {
+				// stays pending so lock holder can still confirm or cancel
+				// but is rolled back once lock is released
+				c.startTimer(ConfirmRetryRate)
+				return
+			}
+		}
+		c.d.runningChanged("confirmed commit timed out")
+	})
+	c.timer = timer
+}
+
+// checkConfirmOwner only lets who made a pending confirmed commit confirm,
+// extend or cancel it. RFC6241 Sec 8.4
+func (c *Candidate) checkConfirmOwner(owner LockOwner) error {
+	if c.timer != nil && !owner.same(c.confirmOwner) {
+		return fmt.Errorf("%w. confirmed commit pending from %s", fc.ConflictError, c.confirmOwner)
+	}
+	return nil
+}
+
+// ConfirmPending is true when a confirmed commit is waiting for confirmation
+func (c *Candidate) ConfirmPending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.timer != nil
+}
+
+// CancelCommit rolls back pending confirmed commit now. Only who made the
+// confirmed commit can cancel it.
+func (c *Candidate) CancelCommit(owner LockOwner) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer == nil {
+		return fmt.Errorf("%w. no confirmed commit pending", fc.BadRequestError)
+	}
+	if err := c.checkConfirmOwner(owner); err != nil {
+		return err
+	}
+	return c.rollback(owner)
+}
+
+func (c *Candidate) commit(owner LockOwner) error {
+	config, modules, err := c.changes()
+	if err != nil {
+		return err
+	}
+	if err = c.d.checkLocks(owner, modules); err != nil {
+		return err
+	}
+	if err = c.d.replaceConfig(owner.User, config, modules); err != nil {
+		return err
+	}
+	c.reset()
+	return nil
+}
+
+func (c *Candidate) rollback(owner LockOwner) error {
+	modules := make([]string, 0, len(c.backup))
+	for module := range c.backup {
+		modules = append(modules, module)
+	}
+	if err := c.d.checkLocks(owner, modules); err != nil {
+		return err
+	}
+	c.timer.Stop()
+	c.timer = nil
+	err := c.d.replaceConfig(owner.User, c.backup, modules)
+	c.backup = nil
+	c.reset()
+	return err
+}
@@ -0,0 +1,81 @@
+package device_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+func TestCandidate(t *testing.T) {
+	d, birds := testdata.BirdDevice(`{"bird":[{"name":"robin"}]}`)
+	c := d.EnableCandidate()
+	fc.AssertEqual(t, []string{"ietf-datastores:candidate", "ietf-datastores:running", "ietf-datastores:operational"}, d.Datastores())
+	edit := func(json string) {
+		t.Helper()
+		b, err := c.Browser("bird")
+		fc.RequireEqual(t, nil, err)
+		n, err := nodeutil.ReadJSON(json)
+		fc.RequireEqual(t, nil, err)
+		fc.RequireEqual(t, nil, b.Root().UpsertFrom(n))
+	}
+
+	t.Run("discard", func(t *testing.T) {
+		edit(`{"bird":[{"name":"owl"}]}`)
+		changed, err := c.Changed()
+		fc.AssertEqual(t, nil, err)
+		fc.AssertEqual(t, []string{"bird"}, changed)
+		_, applied := birds["owl"]
+		fc.AssertEqual(t, false, applied)
+		c.Discard()
+		changed, _ = c.Changed()
+		fc.AssertEqual(t, 0, len(changed))
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		edit(`{"bird":[{"name":"owl","wingspan":10}]}`)
+		fc.AssertEqual(t, nil, c.Validate())
+		fc.AssertEqual(t, nil, c.Commit(device.LockOwner{}))
+		fc.RequireEqual(t, true, birds["owl"] != nil)
+		fc.AssertEqual(t, 10, birds["owl"].Wingspan)
+		_, kept := birds["robin"]
+		fc.AssertEqual(t, true, kept)
+	})
+
+	t.Run("confirmed", func(t *testing.T) {
+		edit(`{"bird":[{"name":"hawk"}]}`)
+		fc.AssertEqual(t, nil, c.ConfirmedCommit(device.LockOwner{}, time.Hour))
+		fc.AssertEqual(t, true, c.ConfirmPending())
+		_, applied := birds["hawk"]
+		fc.AssertEqual(t, true, applied)
+		fc.AssertEqual(t, nil, c.Commit(device.LockOwner{}))
+		fc.AssertEqual(t, false, c.ConfirmPending())
+		_, kept := birds["hawk"]
+		fc.AssertEqual(t, true, kept)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		edit(`{"bird":[{"name":"crow"}]}`)
+		fc.AssertEqual(t, nil, c.ConfirmedCommit(device.LockOwner{}, time.Hour))
+		fc.AssertEqual(t, nil, c.CancelCommit(device.LockOwner{}))
+		_, kept := birds["crow"]
+		fc.AssertEqual(t, false, kept)
+		fc.AssertEqual(t, "bad request. no confirmed commit pending", c.CancelCommit(device.LockOwner{}).Error())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		edit(`{"bird":[{"name":"crow"}]}`)
+		fc.AssertEqual(t, nil, c.ConfirmedCommit(device.LockOwner{}, 10*time.Millisecond))
+		for i := 0; c.ConfirmPending() && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		fc.AssertEqual(t, false, c.ConfirmPending())
+		_, kept := birds["crow"]
+		fc.AssertEqual(t, false, kept)
+		_, kept = birds["hawk"]
+		fc.AssertEqual(t, true, kept)
+	})
+}
@@ -0,0 +1,157 @@
+package device
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// ConfigChange is sent to listeners each time running config changes
+type ConfigChange struct {
+	User      string
+	Datastore string
+	Edits     []ConfigEdit
+}
+
+type ConfigChangeListener func(c ConfigChange)
+
+// ConfigChanges publishes each change to running config of a local device
+// with edits since the change before it
+type ConfigChanges struct {
+	d         *Local
+	mu        sync.Mutex
+	last      map[string]interface{}
+	listeners *list.List
+}
+
+// EnableConfigChanges starts publishing changes to running config if it
+// isn't already. Current config is the baseline for the first change.
+func (self *Local) EnableConfigChanges() *ConfigChanges {
+	self.mu.Lock()
+	if self.changes != nil {
+		defer self.mu.Unlock()
+		return self.changes
+	}
+	c := &ConfigChanges{
+		d:         self,
+		listeners: list.New(),
+	}
+	self.changes = c
+	self.mu.Unlock()
+	c.last, _ = self.ExportConfig()
+	return c
+}
+
+// ConfigChanges of running config or nil if not enabled
+func (self *Local) ConfigChanges() *ConfigChanges {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.changes
+}
+
+// Changed is called after running config might have changed and publishes
+// edits to listeners if it did
+func (c *ConfigChanges) Changed(user string) error {
+	config, err := c.d.ExportConfig()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	last := c.last
+	c.last = config
+	var listeners []ConfigChangeListener
+	for p := c.listeners.Front(); p != nil; p = p.Next() {
+		listeners = append(listeners, p.Value.(ConfigChangeListener))
+	}
+	c.mu.Unlock()
+	if last == nil || len(listeners) == 0 || reflect.DeepEqual(last, config) {
+		return nil
+	}
+	change := ConfigChange{
+		User:      user,
+		Datastore: "running",
+		Edits:     DiffConfig(c.d.Modules(), last, config),
+	}
+	for _, l := range listeners {
+		l(change)
+	}
+	return nil
+}
+
+// OnChange is called after every change to running config
+func (c *ConfigChanges) OnChange(l ConfigChangeListener) nodeutil.Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return nodeutil.NewSubscription(c.listeners, c.listeners.PushBack(l))
+}
+
+// NetconfNotificationsNode implements netconf-config-change of
+// ietf-netconf-notifications
+func NetconfNotificationsNode(c *ConfigChanges) node.Node {
+	return &nodeutil.Basic{
+		OnNotify: func(r node.NotifyRequest) (node.NotifyCloser, error) {
+			switch r.Meta.Ident() {
+			case "netconf-config-change":
+				sub := c.OnChange(func(change ConfigChange) {
+					r.Send(configChangeNode(change))
+				})
+				return sub.Close, nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+func configChangeNode(c ConfigChange) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "changed-by":
+				return changedByNode(c.User), nil
+			case "edit":
+				if len(c.Edits) > 0 {
+					return ConfigEditsNode(c.Edits), nil
+				}
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "datastore":
+				v, err := node.NewValue(r.Meta.Type(), c.Datastore)
+				if err != nil {
+					return err
+				}
+				hnd.Val = v
+			}
+			return nil
+		},
+	}
+}
+
+func changedByNode(user string) node.Node {
+	return &nodeutil.Basic{
+		OnChoose: func(sel *node.Selection, choice *meta.Choice) (*meta.ChoiceCase, error) {
+			if user == "" {
+				return choice.Cases()["server"], nil
+			}
+			return choice.Cases()["by-user"], nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "server":
+				hnd.Val = val.NotEmpty
+			case "username":
+				hnd.Val = val.String(user)
+			case "session-id":
+				hnd.Val = val.UInt32(0)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package device_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestConfigChanges(t *testing.T) {
+	d, _ := testdata.BirdDevice(`{"bird":[{"name":"robin","wingspan":10}]}`)
+	c := d.EnableConfigChanges()
+	m, err := parser.LoadModule(source.Path("../yang:../yang/ietf-rfc"), "ietf-netconf-notifications")
+	fc.RequireEqual(t, nil, err)
+	d.AddBrowser(node.NewBrowser(m, device.NetconfNotificationsNode(c)))
+
+	nb, _ := d.Browser("ietf-netconf-notifications")
+	events, err := nb.Root().Find("netconf-config-change")
+	fc.RequireEqual(t, nil, err)
+	var msgs []string
+	unsubscribe, err := events.Notifications(func(n node.Notification) {
+		msg, _ := nodeutil.WriteJSON(n.Event)
+		msgs = append(msgs, msg)
+	})
+	fc.RequireEqual(t, nil, err)
+	defer unsubscribe()
+
+	fc.RequireEqual(t, nil, c.Changed("joe"))
+	fc.AssertEqual(t, 0, len(msgs))
+
+	b, _ := d.Browser("bird")
+	edit, _ := nodeutil.ReadJSON(`{"bird":[{"name":"robin","wingspan":12},{"name":"owl"}]}`)
+	fc.RequireEqual(t, nil, b.Root().UpsertFrom(edit))
+	fc.RequireEqual(t, nil, c.Changed("joe"))
+	fc.RequireEqual(t, 1, len(msgs))
+	fc.AssertEqual(t, `{"changed-by":{"username":"joe","session-id":0},"datastore":"running","edit":[{"target":"/bird:bird[name='owl']","operation":"create"},{"target":"/bird:bird[name='robin']/wingspan","operation":"replace"}]}`, msgs[0])
+
+	sel, _ := b.Root().Find("bird=owl")
+	fc.RequireEqual(t, nil, sel.Delete())
+	fc.RequireEqual(t, nil, c.Changed(""))
+	fc.RequireEqual(t, 2, len(msgs))
+	fc.AssertEqual(t, true, strings.HasSuffix(msgs[1], `"datastore":"running","edit":[{"target":"/bird:bird[name='owl']","operation":"delete"}]}`))
+}
@@ -0,0 +1,227 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/meta"
+)
+
+// ConfigEdit is a single difference between two configs
+type ConfigEdit struct {
+	// Instance identifier of node that is different
+	// e.g. /bird:bird[name='owl']/wingspan
+	Target string
+
+	// Same node as RESTCONF data resource e.g. /bird:bird=owl/wingspan
+	Resource string
+
+	// create, delete or replace
+	Operation string
+
+	// Values before and after, nil when there is no value. Containers and
+	// list items are whole subtree. Values of sensitive leaves are masked.
+	Before interface{}
+	After  interface{}
+}
+
+// DiffConfig finds edits that turn config "from" into config "to" where
+// both are in the form ExportConfig returns. Edits are safe to show as values
+// of sensitive leaves are masked.
+func DiffConfig(mods map[string]*meta.Module, from map[string]interface{}, to map[string]interface{}) []ConfigEdit {
+	var edits []ConfigEdit
+	for _, module := range topIdents(from, to) {
+		m := mods[module]
+		if m == nil {
+			continue
+		}
+		a, _ := from[module].(map[string]interface{})
+		b, _ := to[module].(map[string]interface{})
+		path := "/" + module + ":"
+		edits = diffConfig(m, path, path, a, b, edits)
+	}
+	return edits
+}
+
+func diffConfig(parent meta.HasDataDefinitions, path string, resource string, from map[string]interface{}, to map[string]interface{}, edits []ConfigEdit) []ConfigEdit {
+	from = unprefixed(from)
+	to = unprefixed(to)
+	for _, ident := range topIdents(from, to) {
+		def := meta.Find(parent, ident)
+		if def == nil {
+			continue
+		}
+		target := path + ident
+		res := resource + ident
+		a, inFrom := from[ident]
+		b, inTo := to[ident]
+		switch x := def.(type) {
+		case meta.Leafable:
+			if !inFrom {
+				edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "create", After: redacted(def, b)})
+			} else if !inTo {
+				edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "delete", Before: redacted(def, a)})
+			} else if !reflect.DeepEqual(a, b) {
+				edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "replace", Before: redacted(def, a), After: redacted(def, b)})
+			}
+		case *meta.List:
+			edits = diffList(x, target, res, a, b, edits)
+		case meta.HasDataDefinitions:
+			if !inFrom {
+				edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "create", After: redacted(def, b)})
+			} else if !inTo {
+				edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "delete", Before: redacted(def, a)})
+			} else {
+				aData, _ := a.(map[string]interface{})
+				bData, _ := b.(map[string]interface{})
+				edits = diffConfig(x, target+"/", res+"/", aData, bData, edits)
+			}
+		}
+	}
+	return edits
+}
+
+func diffList(list *meta.List, path string, resource string, from interface{}, to interface{}, edits []ConfigEdit) []ConfigEdit {
+	fromItems := listItems(list, from)
+	toItems := listItems(list, to)
+	var keys []string
+	for _, items := range []map[string]listItem{fromItems, toItems} {
+		for key := range items {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			continue
+		}
+		a, inFrom := fromItems[key]
+		b, inTo := toItems[key]
+		item := a
+		if !inFrom {
+			item = b
+		}
+		target := path + key
+		res := resource + item.resourceKey
+		if !inFrom {
+			edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "create", After: redacted(list, b.data)})
+		} else if !inTo {
+			edits = append(edits, ConfigEdit{Target: target, Resource: res, Operation: "delete", Before: redacted(list, a.data)})
+		} else {
+			edits = diffConfig(list, target+"/", res+"/", a.data, b.data, edits)
+		}
+	}
+	return edits
+}
+
+type listItem struct {
+	// key as in RESTCONF data resource e.g. =owl
+	resourceKey string
+	data        map[string]interface{}
+}
+
+// listItems indexes list items by their key predicate e.g. [name='owl']
+func listItems(list *meta.List, data interface{}) map[string]listItem {
+	items := make(map[string]listItem)
+	rows, _ := data.([]interface{})
+	for _, row := range rows {
+		item, valid := row.(map[string]interface{})
+		if !valid {
+			continue
+		}
+		item = unprefixed(item)
+		var key strings.Builder
+		var resourceKey []string
+		for _, k := range list.KeyMeta() {
+			v := fmt.Sprintf("%v", item[k.Ident()])
+			fmt.Fprintf(&key, "[%s='%s']", k.Ident(), v)
+			resourceKey = append(resourceKey, url.PathEscape(v))
+		}
+		items[key.String()] = listItem{
+			resourceKey: "=" + strings.Join(resourceKey, ","),
+			data:        item,
+		}
+	}
+	return items
+}
+
+// unprefixed removes module prefixes from keys
+func unprefixed(data map[string]interface{}) map[string]interface{} {
+	var copy map[string]interface{}
+	for key, v := range data {
+		if colon := strings.IndexRune(key, ':'); colon >= 0 {
+			if copy == nil {
+				copy = make(map[string]interface{}, len(data))
+				for k, v := range data {
+					copy[k] = v
+				}
+			}
+			delete(copy, key)
+			copy[key[colon+1:]] = v
+		}
+	}
+	if copy == nil {
+		return data
+	}
+	return copy
+}
+
+// redacted is copy of value of definition with values of sensitive leaves
+// masked. Leaf-lists stay lists.
+func redacted(def meta.Meta, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if secure.IsSensitive(def) {
+		if items, isList := v.([]interface{}); isList && meta.IsLeaf(def) {
+			masked := make([]interface{}, len(items))
+			for i := range masked {
+				masked[i] = secure.Mask
+			}
+			return masked
+		}
+		return secure.Mask
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		copy := make(map[string]interface{}, len(x))
+		for k, child := range x {
+			ident := k
+			if colon := strings.IndexRune(k, ':'); colon >= 0 {
+				ident = k[colon+1:]
+			}
+			if childDef := meta.Find(def, ident); childDef != nil {
+				child = redacted(childDef, child)
+			}
+			copy[k] = child
+		}
+		return copy
+	case []interface{}:
+		if meta.IsLeaf(def) {
+			return x
+		}
+		copy := make([]interface{}, len(x))
+		for i, item := range x {
+			copy[i] = redacted(def, item)
+		}
+		return copy
+	}
+	return v
+}
+
+// EditValue is compact form of a value in a ConfigEdit
+func EditValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,72 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestDiffConfigSensitive(t *testing.T) {
+	ypath := source.Path("../yang:../yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(ypath, `module x {
+		import ietf-netconf-acm {
+			prefix nacm;
+		}
+		import fc-secure {
+			prefix sec;
+		}
+		revision 0;
+		list account {
+			key name;
+			leaf name {
+				type string;
+			}
+			leaf password {
+				nacm:default-deny-all;
+				type string;
+			}
+			leaf-list keys {
+				sec:sensitive;
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	mods := map[string]*meta.Module{"x": m}
+	from := map[string]interface{}{
+		"x": map[string]interface{}{
+			"account": []interface{}{
+				map[string]interface{}{"name": "joe", "password": "secret", "keys": []interface{}{"k1"}},
+			},
+		},
+	}
+	to := map[string]interface{}{
+		"x": map[string]interface{}{
+			"account": []interface{}{
+				map[string]interface{}{"name": "joe", "password": "changed", "keys": []interface{}{"k1"}},
+				map[string]interface{}{"name": "sue", "password": "hidden", "keys": []interface{}{"k2", "k3"}},
+			},
+		},
+	}
+	edits := device.DiffConfig(mods, from, to)
+	fc.AssertEqual(t, []device.ConfigEdit{
+		{
+			Target:    "/x:account[name='joe']/password",
+			Resource:  "/x:account=joe/password",
+			Operation: "replace",
+			Before:    "****",
+			After:     "****",
+		},
+		{
+			Target:    "/x:account[name='sue']",
+			Resource:  "/x:account=sue",
+			Operation: "create",
+			After:     map[string]interface{}{"name": "sue", "password": "****", "keys": []interface{}{"****", "****"}},
+		},
+	}, edits)
+	fc.AssertEqual(t, "hidden", to["x"].(map[string]interface{})["account"].([]interface{})[1].(map[string]interface{})["password"])
+}
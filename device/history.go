@@ -0,0 +1,209 @@
+package device
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// DefaultHistoryLimit is number of revisions kept when there is no other
+// limit set
+var DefaultHistoryLimit = 20
+
+// Revision is running config as it was after a change
+type Revision struct {
+	Id        int
+	Timestamp time.Time
+	User      string
+	Comment   string
+
+	config map[string]interface{}
+}
+
+// History keeps recent revisions of running config of a local device
+type History struct {
+	// Maximum number of revisions kept, oldest are dropped first
+	Limit int
+
+	d         *Local
+	mu        sync.Mutex
+	revisions []*Revision
+	lastId    int
+}
+
+// EnableHistory starts keeping history of running config if it isn't
+// already
+func (self *Local) EnableHistory() *History {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.history == nil {
+		self.history = &History{
+			Limit: DefaultHistoryLimit,
+			d:     self,
+		}
+	}
+	return self.history
+}
+
+// History of running config or nil if not enabled
+func (self *Local) History() *History {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.history
+}
+
+// runningChanged is for changes made by device itself
+func (self *Local) runningChanged(comment string) {
+	if h := self.History(); h != nil {
+		if _, err := h.Record("", comment); err != nil {
+			fc.Err.Printf("could not record config history. %s", err)
+		}
+	}
+	if c := self.ConfigChanges(); c != nil {
+		if err := c.Changed(""); err != nil {
+			fc.Err.Printf("could not publish config change. %s", err)
+		}
+	}
+}
+
+// Record running config as a new revision if it changed since last
+// revision. Returns nil revision if nothing changed.
+func (h *History) Record(user string, comment string) (*Revision, error) {
+	config, err := h.d.ExportConfig()
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.revisions) > 0 {
+		last := h.revisions[len(h.revisions)-1]
+		if reflect.DeepEqual(last.config, config) {
+			return nil, nil
+		}
+	}
+	h.lastId++
+	rev := &Revision{
+		Id:        h.lastId,
+		Timestamp: time.Now(),
+		User:      user,
+		Comment:   comment,
+		config:    config,
+	}
+	h.revisions = append(h.revisions, rev)
+	if h.Limit > 0 && len(h.revisions) > h.Limit {
+		h.revisions = h.revisions[len(h.revisions)-h.Limit:]
+	}
+	return rev, nil
+}
+
+// Revisions oldest first
+func (h *History) Revisions() []*Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]*Revision{}, h.revisions...)
+}
+
+// Revision by id or nil if not found or no longer kept
+func (h *History) Revision(id int) *Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, rev := range h.revisions {
+		if rev.Id == id {
+			return rev
+		}
+	}
+	return nil
+}
+
+func (h *History) findRevision(id int) (*Revision, error) {
+	rev := h.Revision(id)
+	if rev == nil {
+		return nil, fmt.Errorf("%w. revision %d", fc.NotFoundError, id)
+	}
+	return rev, nil
+}
+
+// Compare finds edits that turn revision "from" into revision "to".
+// When "to" is 0, compare to current running config.
+func (h *History) Compare(from int, to int) ([]ConfigEdit, error) {
+	a, err := h.findRevision(from)
+	if err != nil {
+		return nil, err
+	}
+	var b map[string]interface{}
+	if to == 0 {
+		if b, err = h.d.ExportConfig(); err != nil {
+			return nil, err
+		}
+	} else {
+		rev, err := h.findRevision(to)
+		if err != nil {
+			return nil, err
+		}
+		b = rev.config
+	}
+	return DiffConfig(h.d.Modules(), a.config, b), nil
+}
+
+// Rollback replaces running config with config of a revision as one
+// transaction, publishes the change and records result as a new revision.
+// Fails when someone other than owner has running config locked.
+func (h *History) Rollback(id int, owner LockOwner) (*Revision, error) {
+	rev, err := h.findRevision(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = h.d.checkLocks(owner, h.d.moduleOrder()); err != nil {
+		return nil, err
+	}
+	if err = h.d.replaceConfig(owner.User, rev.config, h.d.moduleOrder()); err != nil {
+		return nil, err
+	}
+	if c := h.d.ConfigChanges(); c != nil {
+		if err := c.Changed(owner.User); err != nil {
+			fc.Err.Printf("could not publish config change. %s", err)
+		}
+	}
+	return h.Record(owner.User, fmt.Sprintf("rollback to revision %d", id))
+}
+
+// ConfigEditsNode uses edit list of netconf-config-change and the edit list of
+// compare action in fc-restconf
+func ConfigEditsNode(edits []ConfigEdit) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			if r.Row < len(edits) {
+				return configEditNode(edits[r.Row]), nil, nil
+			}
+			return nil, nil, nil
+		},
+	}
+}
+
+func configEditNode(e ConfigEdit) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) (err error) {
+			switch r.Meta.Ident() {
+			case "target":
+				hnd.Val = val.String(e.Target)
+			case "operation":
+				hnd.Val, err = node.NewValue(r.Meta.Type(), e.Operation)
+			case "before":
+				if e.Before != nil {
+					hnd.Val = val.String(EditValue(e.Before))
+				}
+			case "after":
+				if e.After != nil {
+					hnd.Val = val.String(EditValue(e.After))
+				}
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+func TestHistory(t *testing.T) {
+	d, birds := testdata.BirdDevice(`{"bird":[{"name":"robin","wingspan":10}]}`)
+	h := d.EnableHistory()
+	var changes []device.ConfigChange
+	c := d.EnableConfigChanges()
+	sub := c.OnChange(func(c device.ConfigChange) {
+		changes = append(changes, c)
+	})
+	defer sub.Close()
+	rev, err := h.Record("", "baseline")
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, 1, rev.Id)
+	rev, err = h.Record("", "nothing changed")
+	fc.AssertEqual(t, nil, err)
+	fc.AssertEqual(t, true, rev == nil)
+
+	b, _ := d.Browser("bird")
+	edit, _ := nodeutil.ReadJSON(`{"bird":[{"name":"robin","wingspan":12},{"name":"owl"}]}`)
+	fc.RequireEqual(t, nil, b.Root().UpsertFrom(edit))
+	rev, err = h.Record("joe", "grow")
+	fc.RequireEqual(t, nil, c.Changed("joe"))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, 2, rev.Id)
+	fc.AssertEqual(t, "joe", rev.User)
+
+	edits, err := h.Compare(1, 0)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, []device.ConfigEdit{
+		{
+			Target:    "/bird:bird[name='owl']",
+			Resource:  "/bird:bird=owl",
+			Operation: "create",
+			After:     map[string]interface{}{"name": "owl", "wingspan": float64(0)},
+		},
+		{
+			Target:    "/bird:bird[name='robin']/wingspan",
+			Resource:  "/bird:bird=robin/wingspan",
+			Operation: "replace",
+			Before:    float64(10),
+			After:     float64(12),
+		},
+	}, edits)
+	_, err = h.Compare(9, 0)
+	fc.AssertEqual(t, "not found. revision 9", err.Error())
+
+	rev, err = h.Rollback(1, device.LockOwner{User: "sue"})
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, 3, rev.Id)
+	fc.AssertEqual(t, "rollback to revision 1", rev.Comment)
+	_, found := birds["owl"]
+	fc.AssertEqual(t, false, found)
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+	fc.RequireEqual(t, 2, len(changes))
+	fc.AssertEqual(t, "sue", changes[1].User)
+	fc.AssertEqual(t, "running", changes[1].Datastore)
+	fc.AssertEqual(t, []string{
+		"/bird:bird[name='owl'] delete",
+		"/bird:bird[name='robin']/wingspan replace",
+	}, []string{
+		changes[1].Edits[0].Target + " " + changes[1].Edits[0].Operation,
+		changes[1].Edits[1].Target + " " + changes[1].Edits[1].Operation,
+	})
+
+	h.Limit = 2
+	b.Root().UpsertFrom(edit)
+	h.Record("", "")
+	revs := h.Revisions()
+	fc.AssertEqual(t, 2, len(revs))
+	fc.AssertEqual(t, 3, revs[0].Id)
+}
@@ -1,10 +1,13 @@
 package device
 
 import (
+	"container/list"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/meta"
@@ -14,17 +17,38 @@ import (
 	"github.com/freeconf/yang/source"
 )
 
+// Local device where modules can be added and removed at any time
 type Local struct {
 	browsers     map[string]*node.Browser
 	schemaSource source.Opener
 	uiSource     source.Opener
+	mounts       map[string]MountResolver
+	order        []string
+	candidate    *Candidate
+	history      *History
+	locks        *Locks
+	changes      *ConfigChanges
+	mu           sync.RWMutex
+	listeners    *list.List
+	preReplace   *list.List
+	postReplace  *list.List
+}
+
+// ModuleListener is called after module is added to or removed from device
+type ModuleListener func(module string, change Change)
+
+// ConfigHook sees config of a module before and after commit, rollback or
+// reset replaces it. Config is nil when module has none.
+type ConfigHook func(user string, module string, old map[string]interface{}, new map[string]interface{}) error
+
+// ModuleNotifier is implemented by devices whose modules can change so
+// ietf-yang-library can notify clients
+type ModuleNotifier interface {
+	OnModuleUpdate(l ModuleListener) nodeutil.Subscription
 }
 
 func New(schemaSource source.Opener) *Local {
-	return &Local{
-		schemaSource: schemaSource,
-		browsers:     make(map[string]*node.Browser),
-	}
+	return NewWithUi(schemaSource, nil)
 }
 
 func NewWithUi(schemaSource source.Opener, uiSource source.Opener) *Local {
@@ -32,6 +56,9 @@ func NewWithUi(schemaSource source.Opener, uiSource source.Opener) *Local {
 		schemaSource: schemaSource,
 		uiSource:     uiSource,
 		browsers:     make(map[string]*node.Browser),
+		listeners:    list.New(),
+		preReplace:   list.New(),
+		postReplace:  list.New(),
 	}
 }
 
@@ -44,6 +71,8 @@ func (self *Local) UiSource() source.Opener {
 }
 
 func (self *Local) Modules() map[string]*meta.Module {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
 	mods := make(map[string]*meta.Module)
 	for _, b := range self.browsers {
 		mods[b.Meta.Ident()] = b.Meta
@@ -52,6 +81,8 @@ func (self *Local) Modules() map[string]*meta.Module {
 }
 
 func (self *Local) Browser(module string) (*node.Browser, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
 	return self.browsers[module], nil
 }
 
@@ -63,7 +94,7 @@ func (self *Local) Add(module string, n node.Node) error {
 	if err != nil {
 		return err
 	}
-	self.browsers[module] = node.NewBrowser(m, n)
+	self.AddBrowser(node.NewBrowser(m, n))
 	return nil
 }
 
@@ -72,12 +103,88 @@ func (self *Local) AddSource(module string, src func() node.Node) error {
 	if err != nil {
 		return err
 	}
-	self.browsers[module] = node.NewBrowserSource(m, src)
+	self.AddBrowser(node.NewBrowserSource(m, src))
 	return nil
 }
 
+// AddBrowser adds or replaces module
 func (self *Local) AddBrowser(b *node.Browser) {
+	self.mu.Lock()
+	if _, found := self.browsers[b.Meta.Ident()]; !found {
+		self.order = append(self.order, b.Meta.Ident())
+	}
 	self.browsers[b.Meta.Ident()] = b
+	self.mu.Unlock()
+	self.updateListeners(b.Meta.Ident(), Added)
+}
+
+// Remove module from device. Returns false if module was not found
+func (self *Local) Remove(module string) bool {
+	self.mu.Lock()
+	_, found := self.browsers[module]
+	delete(self.browsers, module)
+	for i, ident := range self.order {
+		if ident == module {
+			self.order = append(self.order[:i], self.order[i+1:]...)
+			break
+		}
+	}
+	self.mu.Unlock()
+	if found {
+		self.updateListeners(module, Removed)
+	}
+	return found
+}
+
+// moduleOrder is the order modules were added
+func (self *Local) moduleOrder() []string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return append([]string{}, self.order...)
+}
+
+func (self *Local) OnModuleUpdate(l ModuleListener) nodeutil.Subscription {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return nodeutil.NewSubscription(self.listeners, self.listeners.PushBack(l))
+}
+
+// OnPreReplace is called before commit, rollback or reset replaces config of a
+// module and can veto it by returning an error
+func (self *Local) OnPreReplace(h ConfigHook) nodeutil.Subscription {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return nodeutil.NewSubscription(self.preReplace, self.preReplace.PushBack(h))
+}
+
+// OnPostReplace is called after commit, rollback or reset replaced config of a
+// module. Errors are only logged as config is already replaced.
+func (self *Local) OnPostReplace(h ConfigHook) nodeutil.Subscription {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return nodeutil.NewSubscription(self.postReplace, self.postReplace.PushBack(h))
+}
+
+func (self *Local) hooks(l *list.List) []ConfigHook {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var hooks []ConfigHook
+	for p := l.Front(); p != nil; p = p.Next() {
+		hooks = append(hooks, p.Value.(ConfigHook))
+	}
+	return hooks
+}
+
+func (self *Local) updateListeners(module string, change Change) {
+	self.mu.RLock()
+	var listeners []ModuleListener
+	for p := self.listeners.Front(); p != nil; p = p.Next() {
+		listeners = append(listeners, p.Value.(ModuleListener))
+	}
+	self.mu.RUnlock()
+	for _, l := range listeners {
+		l(module, change)
+	}
 }
 
 func (self *Local) ApplyStartupConfig(config io.Reader) error {
@@ -88,23 +195,112 @@ func (self *Local) ApplyStartupConfig(config io.Reader) error {
 	return self.ApplyStartupConfigData(cfg)
 }
 
+// ApplyStartupConfigData validates config of every module before applying
+// any of it. Modules are applied in the order they were added and if one
+// fails, modules already applied are rolled back.
 func (self *Local) ApplyStartupConfigData(config map[string]interface{}) error {
-	for module, data := range config {
-		b, err := self.Browser(module)
+	if errs := self.validateStartup(config); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	var applied []*moduleConfig
+	for _, module := range self.moduleOrder() {
+		data, found := config[module]
+		if !found {
+			continue
+		}
+		b, _ := self.Browser(module)
+		moduleCfg := data.(map[string]interface{})
+		undo, err := snapshotConfig(module, b, moduleCfg)
+		if err == nil {
+			applied = append(applied, undo)
+			err = b.Root().UpsertFromSetDefaults(nodeutil.ReflectChild(moduleCfg))
+		}
 		if err != nil {
-			return err
+			err = fmt.Errorf("%s. %w", module, err)
+			return rollback(applied, err)
+		}
+	}
+	self.runningChanged("startup")
+	return nil
+}
+
+// ResetConfig replaces config of every module with given config. Modules
+// not in config are cleared.
+func (self *Local) ResetConfig(config map[string]interface{}) error {
+	return self.replaceConfig("", config, self.moduleOrder())
+}
+
+// replaceConfig replaces config of given modules as one transaction on
+// behalf of user
+func (self *Local) replaceConfig(user string, config map[string]interface{}, modules []string) error {
+	if errs := self.validateStartup(config); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	replace := make(map[string]bool)
+	for _, module := range modules {
+		replace[module] = true
+	}
+	var changes []*moduleConfig
+	for _, module := range self.moduleOrder() {
+		if !replace[module] {
+			continue
 		}
+		b, _ := self.Browser(module)
 		if b == nil {
-			return fmt.Errorf("%w. browser not found: %s", fc.NotFoundError, module)
+			continue
 		}
-		moduleCfg := data.(map[string]interface{})
-		if err := b.Root().UpsertFromSetDefaults(nodeutil.ReflectChild(moduleCfg)); err != nil {
+		moduleCfg, _ := config[module].(map[string]interface{})
+		current, err := readConfig(b)
+		if err != nil {
 			return err
 		}
+		idents := topIdents(current, moduleCfg)
+		if len(idents) == 0 {
+			continue
+		}
+		changes = append(changes, &moduleConfig{module: module, b: b, idents: idents, data: current})
+	}
+	preReplace := self.hooks(self.preReplace)
+	for _, c := range changes {
+		moduleCfg, _ := config[c.module].(map[string]interface{})
+		for _, h := range preReplace {
+			if err := h(user, c.module, c.data, moduleCfg); err != nil {
+				return err
+			}
+		}
+	}
+	var applied []*moduleConfig
+	for _, c := range changes {
+		applied = append(applied, c)
+		moduleCfg, _ := config[c.module].(map[string]interface{})
+		reset := &moduleConfig{module: c.module, b: c.b, idents: c.idents, data: moduleCfg}
+		if err := reset.restore(); err != nil {
+			return rollback(applied, fmt.Errorf("%s. %w", c.module, err))
+		}
+	}
+	postReplace := self.hooks(self.postReplace)
+	for _, c := range changes {
+		moduleCfg, _ := config[c.module].(map[string]interface{})
+		for _, h := range postReplace {
+			if err := h(user, c.module, c.data, moduleCfg); err != nil {
+				fc.Err.Printf("post-replace hook failed on %s. %s", c.module, err)
+			}
+		}
 	}
 	return nil
 }
 
+// rollback restores modules in reverse order they were changed
+func rollback(applied []*moduleConfig, err error) error {
+	for i := len(applied) - 1; i >= 0; i-- {
+		if rollbackErr := applied[i].restore(); rollbackErr != nil {
+			fc.Err.Printf("could not roll back config of %s. %s", applied[i].module, rollbackErr)
+			err = errors.Join(err, fmt.Errorf("rollback %s. %w", applied[i].module, rollbackErr))
+		}
+	}
+	return err
+}
+
 func (self *Local) ApplyStartupConfigFile(fname string) error {
 	cfgRdr, err := os.Open(fname)
 	defer cfgRdr.Close()
@@ -0,0 +1,384 @@
+package device
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+)
+
+// DefaultLockTimeout is how long a lock is held when there is no other
+// timeout set
+var DefaultLockTimeout = 10 * time.Minute
+
+// LockOwner is who holds a lock. Locks of a user are held until released
+// or they time out while locks of anonymous sessions are also released when
+// session disconnects.
+type LockOwner struct {
+	User    string
+	Session string
+}
+
+func (o LockOwner) holds(l *Lock) bool {
+	return o.same(l.Owner)
+}
+
+// same is true when o is other user or, for anonymous sessions, same session
+func (o LockOwner) same(other LockOwner) bool {
+	if other.User != "" {
+		return o.User == other.User
+	}
+	return o.Session == other.Session
+}
+
+func (o LockOwner) String() string {
+	if o.User != "" {
+		return o.User
+	}
+	return "session " + o.Session
+}
+
+// Lock on whole running datastore or on just some subtrees
+type Lock struct {
+	Id    uint32
+	Owner LockOwner
+
+	// Data resources locked e.g. /bird:bird=robin. Empty is whole datastore
+	Targets []string
+
+	// Instance identifiers that were asked to be locked, empty for whole
+	// datastore
+	Selects []string
+
+	Expires time.Time
+}
+
+// LockDeniedError is returned on edits to data locked by someone else
+type LockDeniedError struct {
+	Lock *Lock
+}
+
+func (e *LockDeniedError) Error() string {
+	return fmt.Sprintf("%s. lock %d held by %s", fc.ConflictError, e.Lock.Id, e.Lock.Owner)
+}
+
+func (e *LockDeniedError) Unwrap() error {
+	return fc.ConflictError
+}
+
+// Locks serialize editors of running config of a local device
+type Locks struct {
+	// How long locks are held unless given a timeout. Change with SetTimeout
+	// once locks are in use.
+	Timeout time.Duration
+
+	d      *Local
+	mu     sync.Mutex
+	locks  map[uint32]*Lock
+	lastId uint32
+}
+
+// EnableLocks starts honoring locks on running config if it isn't already
+func (self *Local) EnableLocks() *Locks {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.locks == nil {
+		self.locks = &Locks{
+			Timeout: DefaultLockTimeout,
+			d:       self,
+			locks:   make(map[uint32]*Lock),
+		}
+	}
+	return self.locks
+}
+
+// SetTimeout changes how long locks are held unless given a timeout. Zero
+// uses DefaultLockTimeout.
+func (l *Locks) SetTimeout(timeout time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Timeout = timeout
+}
+
+// DefaultTimeout is how long locks are held unless given a timeout
+func (l *Locks) DefaultTimeout() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Timeout
+}
+
+// Locks of running config or nil if not enabled
+func (self *Local) Locks() *Locks {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.locks
+}
+
+// Lock whole datastore. Zero timeout uses default.
+func (l *Locks) Lock(owner LockOwner, timeout time.Duration) (*Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	for _, existing := range l.locks {
+		if !owner.holds(existing) {
+			return nil, &LockDeniedError{Lock: existing}
+		}
+	}
+	return l.add(owner, nil, nil, timeout), nil
+}
+
+// PartialLock locks just the nodes given as instance identifiers e.g.
+// /bird:bird[name='robin']. Zero timeout uses default.
+func (l *Locks) PartialLock(owner LockOwner, selects []string, timeout time.Duration) (*Lock, error) {
+	if len(selects) == 0 {
+		return nil, fmt.Errorf("%w. nothing selected to lock", fc.BadRequestError)
+	}
+	targets := make([]string, len(selects))
+	for i, s := range selects {
+		var err error
+		if targets[i], err = selectResource(s); err != nil {
+			return nil, err
+		}
+		if err = l.exists(targets[i]); err != nil {
+			return nil, err
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	for _, target := range targets {
+		if existing := l.holder(owner, target); existing != nil {
+			return nil, &LockDeniedError{Lock: existing}
+		}
+	}
+	return l.add(owner, targets, selects, timeout), nil
+}
+
+// Unlock releases a lock, only the owner can release it
+func (l *Locks) Unlock(owner LockOwner, id uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	existing, found := l.locks[id]
+	if !found {
+		return fmt.Errorf("%w. lock %d", fc.NotFoundError, id)
+	}
+	if !owner.holds(existing) {
+		return &LockDeniedError{Lock: existing}
+	}
+	delete(l.locks, id)
+	return nil
+}
+
+// ReleaseSession releases locks of anonymous owner taken on session
+func (l *Locks) ReleaseSession(session string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, existing := range l.locks {
+		if existing.Owner.User == "" && existing.Owner.Session == session {
+			delete(l.locks, id)
+		}
+	}
+}
+
+// CheckEdit returns LockDeniedError when someone other than owner holds a
+// lock on resource e.g. /bird:bird=robin
+func (l *Locks) CheckEdit(owner LockOwner, resource string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	if existing := l.holder(owner, resource); existing != nil {
+		return &LockDeniedError{Lock: existing}
+	}
+	return nil
+}
+
+// CheckModules returns LockDeniedError when someone other than owner holds a
+// lock on any part of config of modules
+func (l *Locks) CheckModules(owner LockOwner, modules []string) error {
+	for _, module := range modules {
+		if err := l.CheckEdit(owner, "/"+module+":"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLocks is for changes to running config that do not go thru an edit
+// like commits and rollbacks
+func (self *Local) checkLocks(owner LockOwner, modules []string) error {
+	if l := self.Locks(); l != nil {
+		return l.CheckModules(owner, modules)
+	}
+	return nil
+}
+
+// Held are current locks ordered by id
+func (l *Locks) Held() []*Lock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire()
+	held := make([]*Lock, 0, len(l.locks))
+	for _, existing := range l.locks {
+		held = append(held, existing)
+	}
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].Id < held[j].Id
+	})
+	return held
+}
+
+func (l *Locks) add(owner LockOwner, targets []string, selects []string, timeout time.Duration) *Lock {
+	if timeout <= 0 {
+		timeout = l.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	l.lastId++
+	lock := &Lock{
+		Id:      l.lastId,
+		Owner:   owner,
+		Targets: targets,
+		Selects: selects,
+		Expires: time.Now().Add(timeout),
+	}
+	l.locks[lock.Id] = lock
+	return lock
+}
+
+// holder is lock someone other than owner has on any part of resource
+func (l *Locks) holder(owner LockOwner, resource string) *Lock {
+	for _, existing := range l.locks {
+		if owner.holds(existing) {
+			continue
+		}
+		if len(existing.Targets) == 0 {
+			return existing
+		}
+		for _, target := range existing.Targets {
+			if overlaps(target, resource) {
+				return existing
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Locks) expire() {
+	now := time.Now()
+	for id, existing := range l.locks {
+		if now.After(existing.Expires) {
+			delete(l.locks, id)
+		}
+	}
+}
+
+func (l *Locks) exists(resource string) error {
+	module, path, _ := strings.Cut(resource[1:], ":")
+	b, err := l.d.Browser(module)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return fmt.Errorf("%w. module %s", fc.NotFoundError, module)
+	}
+	sel, err := b.Root().Find(path)
+	if err != nil {
+		return err
+	}
+	if sel == nil {
+		return fmt.Errorf("%w. nothing to lock at %s", fc.NotFoundError, resource)
+	}
+	sel.Release()
+	return nil
+}
+
+// overlaps is true when one resource is within the other
+func overlaps(a string, b string) bool {
+	return within(a, b) || within(b, a)
+}
+
+func within(parent string, child string) bool {
+	if !strings.HasPrefix(child, parent) {
+		return false
+	}
+	if len(child) == len(parent) || isModuleRoot(parent) {
+		return true
+	}
+	next := child[len(parent)]
+	return next == '/' || next == '='
+}
+
+func isModuleRoot(resource string) bool {
+	return strings.HasSuffix(resource, ":") && strings.LastIndex(resource, "/") == 0
+}
+
+var errBadSelect = fmt.Errorf("%w. expected instance identifier", fc.BadRequestError)
+
+// selectResource turns instance identifier e.g. /bird:bird[name='robin']
+// into data resource e.g. /bird:bird=robin
+func selectResource(s string) (string, error) {
+	if !strings.HasPrefix(s, "/") {
+		return "", fmt.Errorf("%w %s", errBadSelect, s)
+	}
+	var resource strings.Builder
+	var module string
+	for _, seg := range splitSelect(s[1:]) {
+		ident, predicates, _ := strings.Cut(seg, "[")
+		prefix, name, qualified := strings.Cut(ident, ":")
+		if !qualified {
+			name = ident
+		} else if prefix != module {
+			module = prefix
+			name = ident
+		}
+		if module == "" || name == "" {
+			return "", fmt.Errorf("%w %s", errBadSelect, s)
+		}
+		resource.WriteRune('/')
+		resource.WriteString(name)
+		if predicates == "" {
+			continue
+		}
+		var keys []string
+		for _, p := range strings.Split(strings.TrimSuffix(predicates, "]"), "][") {
+			_, v, valid := strings.Cut(p, "=")
+			if !valid || len(v) < 2 || (v[0] != '\'' && v[0] != '"') || v[len(v)-1] != v[0] {
+				return "", fmt.Errorf("%w %s", errBadSelect, s)
+			}
+			keys = append(keys, url.PathEscape(v[1:len(v)-1]))
+		}
+		resource.WriteRune('=')
+		resource.WriteString(strings.Join(keys, ","))
+	}
+	if module == "" {
+		return "", fmt.Errorf("%w %s", errBadSelect, s)
+	}
+	return resource.String(), nil
+}
+
+// splitSelect splits on slashes that are not in a key value
+func splitSelect(s string) []string {
+	var segs []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '/':
+			segs = append(segs, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(segs, s[start:])
+}
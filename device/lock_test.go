@@ -0,0 +1,113 @@
+package device_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+func TestLocks(t *testing.T) {
+	d, _ := testdata.BirdDevice(`{"bird":[{"name":"robin"},{"name":"owl"}]}`)
+	l := d.EnableLocks()
+	joe := device.LockOwner{User: "joe", Session: "a"}
+	anon := device.LockOwner{Session: "b"}
+
+	robin, err := l.PartialLock(joe, []string{"/bird:bird[name='robin']"}, 0)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "/bird:bird=robin", robin.Targets[0])
+	_, err = l.PartialLock(anon, []string{"/bird:bird[name='nobody']"}, 0)
+	fc.AssertEqual(t, true, errors.Is(err, fc.NotFoundError))
+
+	var denied *device.LockDeniedError
+	err = l.CheckEdit(anon, "/bird:bird=robin/wingspan")
+	fc.RequireEqual(t, true, errors.As(err, &denied))
+	fc.AssertEqual(t, "joe", denied.Lock.Owner.User)
+	fc.AssertEqual(t, true, errors.Is(err, fc.ConflictError))
+	fc.AssertEqual(t, nil, l.CheckEdit(joe, "/bird:bird=robin"))
+	fc.AssertEqual(t, true, l.CheckEdit(anon, "/bird:bird") != nil)
+	fc.AssertEqual(t, true, l.CheckEdit(anon, "/bird:") != nil)
+	fc.AssertEqual(t, nil, l.CheckEdit(anon, "/bird:bird=owl"))
+	fc.AssertEqual(t, nil, l.CheckEdit(anon, "/bird:bird=robin2"))
+
+	_, err = l.Lock(anon, 0)
+	fc.AssertEqual(t, true, errors.As(err, &denied))
+	fc.AssertEqual(t, true, l.Unlock(anon, robin.Id) != nil)
+	fc.AssertEqual(t, nil, l.Unlock(joe, robin.Id))
+
+	_, err = l.Lock(anon, 0)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, true, l.CheckEdit(joe, "/bird:bird=owl") != nil)
+	l.ReleaseSession("b")
+	fc.AssertEqual(t, 0, len(l.Held()))
+
+	_, err = l.Lock(joe, time.Millisecond)
+	fc.RequireEqual(t, nil, err)
+	l.ReleaseSession("a")
+	fc.AssertEqual(t, 1, len(l.Held()))
+	time.Sleep(5 * time.Millisecond)
+	fc.AssertEqual(t, nil, l.CheckEdit(anon, "/bird:bird=owl"))
+}
+
+func TestLocksOnCommitAndRollback(t *testing.T) {
+	d, birds := testdata.BirdDevice(`{"bird":[{"name":"robin"}]}`)
+	l := d.EnableLocks()
+	c := d.EnableCandidate()
+	h := d.EnableHistory()
+	h.Record("", "start")
+	joe := device.LockOwner{User: "joe"}
+	sue := device.LockOwner{User: "sue"}
+	edit := func(json string) {
+		t.Helper()
+		b, err := c.Browser("bird")
+		fc.RequireEqual(t, nil, err)
+		n, err := nodeutil.ReadJSON(json)
+		fc.RequireEqual(t, nil, err)
+		fc.RequireEqual(t, nil, b.Root().UpsertFrom(n))
+	}
+	var denied *device.LockDeniedError
+
+	defer func(retry time.Duration) {
+		device.ConfirmRetryRate = retry
+	}(device.ConfirmRetryRate)
+	device.ConfirmRetryRate = 10 * time.Millisecond
+
+	edit(`{"bird":[{"name":"owl"}]}`)
+	fc.AssertEqual(t, nil, c.ConfirmedCommit(sue, 10*time.Millisecond))
+	lock, err := l.PartialLock(joe, []string{"/bird:bird[name='robin']"}, 0)
+	fc.RequireEqual(t, nil, err)
+	time.Sleep(50 * time.Millisecond)
+	fc.AssertEqual(t, true, c.ConfirmPending())
+	_, kept := birds["owl"]
+	fc.AssertEqual(t, true, kept)
+	fc.AssertEqual(t, true, errors.As(c.CancelCommit(sue), &denied))
+	err = c.CancelCommit(joe)
+	fc.AssertEqual(t, "conflict. confirmed commit pending from sue", err.Error())
+	fc.AssertEqual(t, false, errors.As(err, &denied))
+	fc.AssertEqual(t, true, errors.Is(c.Commit(joe), fc.ConflictError))
+
+	edit(`{"bird":[{"name":"hawk"}]}`)
+	fc.AssertEqual(t, true, errors.As(c.Commit(sue), &denied))
+	_, applied := birds["hawk"]
+	fc.AssertEqual(t, false, applied)
+	_, err = h.Rollback(1, sue)
+	fc.AssertEqual(t, true, errors.As(err, &denied))
+
+	// timed out commit rolls back once lock is released
+	fc.AssertEqual(t, nil, l.Unlock(joe, lock.Id))
+	for i := 0; c.ConfirmPending() && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	fc.AssertEqual(t, false, c.ConfirmPending())
+	_, kept = birds["owl"]
+	fc.AssertEqual(t, false, kept)
+
+	edit(`{"bird":[{"name":"hawk"}]}`)
+	fc.AssertEqual(t, nil, c.Commit(sue))
+	_, applied = birds["hawk"]
+	fc.AssertEqual(t, true, applied)
+}
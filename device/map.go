@@ -1,7 +1,109 @@
 package device
 
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	"github.com/freeconf/yang/nodeutil"
+)
+
 // Map is used my server to host multiple devices in a single web server
 // at restconf=[device]/...
 type Map interface {
 	Device(deviceId string) (Device, error)
 }
+
+type Change int
+
+const (
+	Added Change = iota
+	Removed
+)
+
+var changeNames = []string{"added", "removed"}
+
+func (c Change) String() string {
+	return changeNames[c]
+}
+
+type MapListener func(deviceId string, d Device, change Change)
+
+// LocalMap is a Map devices can be added to and removed from at any time
+type LocalMap struct {
+	// Optional: connects to devices added by fc-map register rpc
+	Proto ProtocolHandler
+
+	mu        sync.RWMutex
+	devices   map[string]Device
+	listeners *list.List
+}
+
+func NewMap() *LocalMap {
+	return &LocalMap{
+		devices:   make(map[string]Device),
+		listeners: list.New(),
+	}
+}
+
+func (m *LocalMap) Device(deviceId string) (Device, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.devices[deviceId], nil
+}
+
+// Add device, replacing and closing any device with the same id
+func (m *LocalMap) Add(deviceId string, d Device) {
+	m.mu.Lock()
+	existing, replaced := m.devices[deviceId]
+	m.devices[deviceId] = d
+	m.mu.Unlock()
+	if replaced && existing != d {
+		m.updateListeners(deviceId, existing, Removed)
+		existing.Close()
+	}
+	m.updateListeners(deviceId, d, Added)
+}
+
+// Remove and close device. Returns false if device was not found
+func (m *LocalMap) Remove(deviceId string) bool {
+	m.mu.Lock()
+	d, found := m.devices[deviceId]
+	delete(m.devices, deviceId)
+	m.mu.Unlock()
+	if found {
+		m.updateListeners(deviceId, d, Removed)
+		d.Close()
+	}
+	return found
+}
+
+// DeviceIds in sorted order
+func (m *LocalMap) DeviceIds() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.devices))
+	for id := range m.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (m *LocalMap) OnUpdate(l MapListener) nodeutil.Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return nodeutil.NewSubscription(m.listeners, m.listeners.PushBack(l))
+}
+
+func (m *LocalMap) updateListeners(deviceId string, d Device, change Change) {
+	m.mu.RLock()
+	var listeners []MapListener
+	for p := m.listeners.Front(); p != nil; p = p.Next() {
+		listeners = append(listeners, p.Value.(MapListener))
+	}
+	m.mu.RUnlock()
+	for _, l := range listeners {
+		l(deviceId, d, change)
+	}
+}
@@ -0,0 +1,155 @@
+package device
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// MapNode is management of map and uses fc-map.yang
+func MapNode(m *LocalMap) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "device":
+				return mapDevicesNode(m, m.DeviceIds()), nil
+			}
+			return nil, nil
+		},
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			var req struct {
+				DeviceId string
+				Address  string
+			}
+			if err := r.Input.UpsertInto(&nodeutil.Node{Object: &req}); err != nil {
+				return nil, err
+			}
+			switch r.Meta.Ident() {
+			case "register":
+				if m.Proto == nil {
+					return nil, fmt.Errorf("%w. no protocol handler to connect to devices", fc.NotImplementedError)
+				}
+				addr := req.Address
+				if addr == "" {
+					addr = req.DeviceId
+				}
+				d, err := m.Proto(addr)
+				if err != nil {
+					return nil, err
+				}
+				m.Add(req.DeviceId, d)
+			case "unregister":
+				if !m.Remove(req.DeviceId) {
+					return nil, fmt.Errorf("%w. device %s", fc.NotFoundError, req.DeviceId)
+				}
+			}
+			return nil, nil
+		},
+		OnNotify: func(r node.NotifyRequest) (node.NotifyCloser, error) {
+			switch r.Meta.Ident() {
+			case "update":
+				sub := m.OnUpdate(func(deviceId string, d Device, change Change) {
+					r.Send(mapUpdateNode(deviceId, d, change))
+				})
+				return sub.Close, nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+func mapDevicesNode(m *LocalMap, ids []string) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var id string
+			if r.Key != nil {
+				id = r.Key[0].String()
+			} else if r.Row < len(ids) {
+				id = ids[r.Row]
+			}
+			if id == "" {
+				return nil, nil, nil
+			}
+			d, _ := m.Device(id)
+			if d == nil {
+				return nil, nil, nil
+			}
+			return mapDeviceNode(id, d), []val.Value{val.String(id)}, nil
+		},
+	}
+}
+
+// uses deviceItem grouping
+func mapDeviceNode(deviceId string, d Device) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "module":
+				if mods := d.Modules(); len(mods) > 0 {
+					return mapModulesNode(mods), nil
+				}
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "deviceId":
+				hnd.Val = val.String(deviceId)
+			}
+			return nil
+		},
+	}
+}
+
+func mapUpdateNode(deviceId string, d Device, change Change) node.Node {
+	return &nodeutil.Extend{
+		Base: mapDeviceNode(deviceId, d),
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "change":
+				hnd.Val, _ = r.Meta.Type().Enum().ByLabel(change.String())
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+	}
+}
+
+func mapModulesNode(mods map[string]*meta.Module) node.Node {
+	names := make([]string, 0, len(mods))
+	for name := range mods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var m *meta.Module
+			if r.Key != nil {
+				m = mods[r.Key[0].String()]
+			} else if r.Row < len(names) {
+				m = mods[names[r.Row]]
+			}
+			if m == nil {
+				return nil, nil, nil
+			}
+			return &nodeutil.Basic{
+				OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+					switch r.Meta.Ident() {
+					case "name":
+						hnd.Val = val.String(m.Ident())
+					case "revision":
+						if rev := m.Revision(); rev != nil {
+							hnd.Val = val.String(rev.Ident())
+						}
+					}
+					return nil
+				},
+			}, []val.Value{val.String(m.Ident())}, nil
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestMap(t *testing.T) {
+	m := device.NewMap()
+	m.Proto = func(addr string) (device.Device, error) {
+		d, _ := testdata.BirdDevice(`{}`)
+		return d, nil
+	}
+	ypath := source.Dir("../yang")
+	b := node.NewBrowser(parser.RequireModule(ypath, "fc-map"), device.MapNode(m))
+
+	var updates []string
+	sub, err := b.Root().Find("update")
+	fc.RequireEqual(t, nil, err)
+	closer, err := sub.Notifications(func(n node.Notification) {
+		msg, err := nodeutil.WriteJSON(n.Event)
+		fc.AssertEqual(t, nil, err)
+		updates = append(updates, msg)
+	})
+	fc.RequireEqual(t, nil, err)
+	defer closer()
+
+	d, _ := testdata.BirdDevice(`{}`)
+	m.Add("bird1", d)
+	reg, err := b.Root().Find("register")
+	fc.RequireEqual(t, nil, err)
+	_, err = reg.Action(readJson(`{"deviceId":"bird2"}`))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, []string{"bird1", "bird2"}, m.DeviceIds())
+
+	actual, err := nodeutil.WriteJSON(b.Root())
+	fc.AssertEqual(t, nil, err)
+	fc.AssertEqual(t, `{"device":[{"deviceId":"bird1","module":[{"name":"bird","revision":"0"}]},{"deviceId":"bird2","module":[{"name":"bird","revision":"0"}]}]}`, actual)
+
+	unreg, err := b.Root().Find("unregister")
+	fc.RequireEqual(t, nil, err)
+	_, err = unreg.Action(readJson(`{"deviceId":"bird1"}`))
+	fc.RequireEqual(t, nil, err)
+	found, _ := m.Device("bird1")
+	fc.AssertEqual(t, nil, found)
+	_, err = unreg.Action(readJson(`{"deviceId":"bird1"}`))
+	fc.AssertEqual(t, true, err != nil)
+
+	fc.RequireEqual(t, 3, len(updates))
+	fc.AssertEqual(t, `{"deviceId":"bird1","module":[{"name":"bird","revision":"0"}],"change":"added"}`, updates[0])
+	fc.AssertEqual(t, `{"deviceId":"bird1","module":[{"name":"bird","revision":"0"}],"change":"removed"}`, updates[2])
+}
+
+func readJson(s string) node.Node {
+	n, err := nodeutil.ReadJSON(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+package device
+
+import (
+	"fmt"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+)
+
+// Implementation of RFC8528 with inline schemas only. Each mounted device
+// brings its own modules and yang library. Unlike RFC8528, reading a mount
+// point or its parents does not include mounted data inline, mounted modules
+// are only read by paths that go thru the mount point.
+// e.g. /fleet:device=abc/car:engine
+
+// MountResolver finds device mounted at selected container or list entry
+// with a mount point. Nil when nothing is mounted there.
+type MountResolver func(sel *node.Selection) (Device, error)
+
+// Mounter is implemented by devices that have mount points
+type Mounter interface {
+	Mounted(sel *node.Selection) (Device, error)
+}
+
+// MountPoint is the label of the yangmnt:mount-point extension on
+// definition or empty if definition is not a mount point
+func MountPoint(m meta.Meta) string {
+	for _, x := range m.Extensions() {
+		if x.Keyword() != "" {
+			continue
+		}
+		def := x.ExtDefinition()
+		if def == nil || def.Ident() != "mount-point" {
+			continue
+		}
+		if mod, valid := def.Parent().(*meta.Module); valid && mod.Ident() == "ietf-yang-schema-mount" {
+			return x.Argument()
+		}
+	}
+	return ""
+}
+
+// MountPoints are all containers and lists in module that are mount points
+func MountPoints(m *meta.Module) []meta.HasDataDefinitions {
+	var found []meta.HasDataDefinitions
+	var walk func(defs []meta.Definition)
+	walk = func(defs []meta.Definition) {
+		for _, def := range defs {
+			switch x := def.(type) {
+			case *meta.Choice:
+				for _, c := range x.Cases() {
+					walk(c.DataDefinitions())
+				}
+			case meta.HasDataDefinitions:
+				if MountPoint(x) != "" {
+					found = append(found, x)
+				}
+				walk(x.DataDefinitions())
+			}
+		}
+	}
+	walk(m.DataDefinitions())
+	return found
+}
+
+// Mount devices at all mount points with given label. Adds
+// ietf-yang-schema-mount on first mount so clients can find mount points.
+func (self *Local) Mount(label string, resolve MountResolver) error {
+	if b, _ := self.Browser("ietf-yang-schema-mount"); b == nil {
+		if err := self.Add("ietf-yang-schema-mount", SchemaMountNode(self)); err != nil {
+			return err
+		}
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.mounts == nil {
+		self.mounts = make(map[string]MountResolver)
+	}
+	self.mounts[label] = resolve
+	return nil
+}
+
+// Mounted implements Mounter
+func (self *Local) Mounted(sel *node.Selection) (Device, error) {
+	label := MountPoint(sel.Meta())
+	if label == "" {
+		return nil, fmt.Errorf("%w. %s is not a mount point", fc.BadRequestError, sel.Path)
+	}
+	self.mu.RLock()
+	resolve, found := self.mounts[label]
+	self.mu.RUnlock()
+	if !found {
+		return nil, nil
+	}
+	return resolve(sel)
+}
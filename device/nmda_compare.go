@@ -0,0 +1,464 @@
+package device
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// Implementation of RFC9144 with subtree filters only.  Datastores are
+// running and intended as config was last recorded by history or config
+// changes when enabled on a local device, candidate when enabled on a local
+// device and operational as read from the device now.
+
+// CompareOptions are options of compare rpc in ietf-nmda-compare
+type CompareOptions struct {
+	// Compare config false nodes too, otherwise only config true nodes
+	All bool
+
+	// Annotate values from operational datastore with ietf-origin:origin
+	ReportOrigin bool
+
+	// Only compare data selected by subtree filter. Same form as
+	// ExportConfig e.g. {"bird":{"bird":[{"name":"owl"}]}}
+	Filter map[string]interface{}
+
+	// Datastores are read with context and constraints of this selection so
+	// callers only compare data they have access to
+	Scope *node.Selection
+}
+
+// ReadDatastore reads data of every module in device from a datastore. Only
+// config true nodes are read unless all is set and datastore is operational.
+func ReadDatastore(d Device, datastore string, all bool) (map[string]interface{}, error) {
+	return readDatastore(d, datastore, all, nil)
+}
+
+func readDatastore(d Device, datastore string, all bool, scope *node.Selection) (map[string]interface{}, error) {
+	if colon := strings.IndexRune(datastore, ':'); colon >= 0 {
+		datastore = datastore[colon+1:]
+	}
+	var src Device
+	var recorded map[string]interface{}
+	switch datastore {
+	case "running", "intended":
+		src = d
+		if local, valid := d.(*Local); valid {
+			recorded = local.recordedConfig()
+		}
+		all = false
+	case "operational":
+		src = d
+	case "candidate":
+		if local, valid := d.(*Local); valid && local.Candidate() != nil {
+			src = local.Candidate()
+		}
+		all = false
+	}
+	if src == nil {
+		return nil, fmt.Errorf("%w. datastore not found: %s", fc.NotFoundError, datastore)
+	}
+	var modules []string
+	for module := range d.Modules() {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	data := make(map[string]interface{})
+	for _, module := range modules {
+		b, err := src.Browser(module)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			continue
+		}
+		if recorded != nil {
+			config, _ := recorded[module].(map[string]interface{})
+			if config == nil {
+				config = make(map[string]interface{})
+			}
+			n, err := nodeutil.ReadJSONValues(config)
+			if err != nil {
+				return nil, err
+			}
+			b = node.NewBrowser(b.Meta, n)
+		}
+		sel := b.Root()
+		if scope != nil {
+			sel = b.RootWithContext(scope.Context)
+			sel.Constraints = node.NewConstraints(scope.Constraints)
+			sel.Context = sel.Constraints.ContextConstraint(sel)
+		}
+		var moduleData map[string]interface{}
+		if all {
+			moduleData, err = readAll(sel)
+		} else {
+			moduleData, err = readSelection(sel)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(moduleData) > 0 {
+			data[module] = moduleData
+		}
+	}
+	return data, nil
+}
+
+// recordedConfig is running config as last recorded or nil when nothing
+// records it
+func (self *Local) recordedConfig() map[string]interface{} {
+	if h := self.History(); h != nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if len(h.revisions) > 0 {
+			return h.revisions[len(h.revisions)-1].config
+		}
+	}
+	if c := self.ConfigChanges(); c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.last
+	}
+	return nil
+}
+
+// CompareDatastores finds edits that turn source datastore into target
+// datastore
+func CompareDatastores(d Device, source string, target string, opts CompareOptions) ([]ConfigEdit, error) {
+	from, err := readDatastore(d, source, opts.All, opts.Scope)
+	if err != nil {
+		return nil, err
+	}
+	to, err := readDatastore(d, target, opts.All, opts.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Filter != nil {
+		from = filterDatastore(opts.Filter, from)
+		to = filterDatastore(opts.Filter, to)
+	}
+	return DiffConfig(d.Modules(), from, to), nil
+}
+
+func filterDatastore(filter map[string]interface{}, data map[string]interface{}) map[string]interface{} {
+	filtered := make(map[string]interface{})
+	for module, f := range filter {
+		moduleData, valid := data[module].(map[string]interface{})
+		if !valid {
+			continue
+		}
+		if moduleFilter, valid := f.(map[string]interface{}); valid && len(moduleFilter) > 0 {
+			if found, matched := filterSubtree(moduleFilter, moduleData); matched {
+				filtered[module] = found
+			}
+		} else {
+			filtered[module] = moduleData
+		}
+	}
+	return filtered
+}
+
+// filterSubtree applies filter like RFC6241 section 6 subtree filter. Leaves
+// with values in filter must match, empty values select whole node.
+func filterSubtree(filter map[string]interface{}, data map[string]interface{}) (map[string]interface{}, bool) {
+	filter = unprefixed(filter)
+	data = unprefixed(data)
+	selects := false
+	for ident, f := range filter {
+		if isContentMatch(f) {
+			if v, found := data[ident]; !found || fmt.Sprintf("%v", v) != fmt.Sprintf("%v", f) {
+				return nil, false
+			}
+		} else {
+			selects = true
+		}
+	}
+	if !selects {
+		return data, true
+	}
+	found := make(map[string]interface{})
+	for ident, f := range filter {
+		v, exists := data[ident]
+		if !exists {
+			continue
+		}
+		if isContentMatch(f) {
+			found[ident] = v
+			continue
+		}
+		var itemFilters []interface{}
+		switch x := f.(type) {
+		case map[string]interface{}:
+			if len(x) == 0 {
+				found[ident] = v
+				continue
+			}
+			itemFilters = []interface{}{x}
+		case []interface{}:
+			itemFilters = x
+		default:
+			found[ident] = v
+			continue
+		}
+		if items, isList := v.([]interface{}); isList {
+			var matches []interface{}
+			for _, item := range items {
+				itemData, _ := item.(map[string]interface{})
+				for _, itemFilter := range itemFilters {
+					fm, _ := itemFilter.(map[string]interface{})
+					if match, ok := filterSubtree(fm, itemData); ok {
+						matches = append(matches, match)
+						break
+					}
+				}
+			}
+			if len(matches) > 0 {
+				found[ident] = matches
+			}
+		} else if child, isContainer := v.(map[string]interface{}); isContainer {
+			fm, _ := itemFilters[0].(map[string]interface{})
+			if match, ok := filterSubtree(fm, child); ok {
+				found[ident] = match
+			}
+		}
+	}
+	return found, true
+}
+
+// isContentMatch is true for filter entries that are leaf values to match
+// and not selection or containment nodes
+func isContentMatch(f interface{}) bool {
+	switch x := f.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return false
+	case string:
+		return x != ""
+	}
+	return true
+}
+
+// NmdaCompareNode implements ietf-nmda-compare for a device
+func NmdaCompareNode(d Device) node.Node {
+	return &nodeutil.Basic{
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "compare":
+				// copy so caller's constraints are left alone
+				r.Selection.Constraints = node.NewConstraints(r.Selection.Constraints)
+				r.Selection.Constraints.AddConstraint("~when-expr", 50, 0, checkWhen{})
+				return compareAction(d, r.Selection, r.Input)
+			}
+			return nil, nil
+		},
+	}
+}
+
+func compareAction(d Device, scope *node.Selection, in *node.Selection) (node.Node, error) {
+	source, err := in.GetValue("source")
+	if err != nil {
+		return nil, err
+	}
+	target, err := in.GetValue("target")
+	if err != nil {
+		return nil, err
+	}
+	opts := CompareOptions{Scope: scope}
+	if v, err := in.GetValue("all"); err != nil {
+		return nil, err
+	} else {
+		opts.All = v != nil
+	}
+	if v, err := in.GetValue("report-origin"); err != nil {
+		return nil, err
+	} else {
+		opts.ReportOrigin = v != nil
+	}
+	if v, err := in.GetValue("subtree-filter"); err != nil {
+		return nil, err
+	} else if v != nil {
+		filter, valid := v.Value().(map[string]interface{})
+		if !valid {
+			return nil, fmt.Errorf("%w. subtree-filter must be an object", fc.BadRequestError)
+		}
+		opts.Filter = make(map[string]interface{})
+		for key, f := range filter {
+			module, ident, qualified := strings.Cut(key, ":")
+			if !qualified {
+				return nil, fmt.Errorf("%w. subtree-filter %s needs module name", fc.BadRequestError, key)
+			}
+			moduleFilter, _ := opts.Filter[module].(map[string]interface{})
+			if moduleFilter == nil {
+				moduleFilter = make(map[string]interface{})
+				opts.Filter[module] = moduleFilter
+			}
+			moduleFilter[ident] = f
+		}
+	}
+	edits, err := CompareDatastores(d, source.String(), target.String(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return compareResponseNode(d, source.String(), target.String(), opts, edits), nil
+}
+
+func compareResponseNode(d Device, source string, target string, opts CompareOptions, edits []ConfigEdit) node.Node {
+	return &nodeutil.Basic{
+		OnChoose: func(sel *node.Selection, choice *meta.Choice) (*meta.ChoiceCase, error) {
+			if len(edits) == 0 {
+				return choice.Cases()["no-matches"], nil
+			}
+			return choice.Cases()["differences"], nil
+		},
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "differences":
+				return r.Selection.Node, nil
+			case "yang-patch":
+				return yangPatchNode(d, source, target, opts, edits), nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "no-matches":
+				hnd.Val = val.NotEmpty
+			}
+			return nil
+		},
+	}
+}
+
+func yangPatchNode(d Device, source string, target string, opts CompareOptions, edits []ConfigEdit) node.Node {
+	mods := d.Modules()
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "edit":
+				return &nodeutil.Basic{
+					OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+						row := r.Row
+						if r.Key != nil {
+							fmt.Sscanf(r.Key[0].String(), "edit-%d", &row)
+							row--
+						}
+						if row < 0 || row >= len(edits) {
+							return nil, nil, nil
+						}
+						id := val.String(fmt.Sprintf("edit-%d", row+1))
+						e := edits[row]
+						return patchEditNode(mods, source, target, opts, e, id), []val.Value{id}, nil
+					},
+				}, nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "patch-id":
+				hnd.Val = val.String(fmt.Sprintf("compare %s %s", source, target))
+			}
+			return nil
+		},
+	}
+}
+
+func patchEditNode(mods map[string]*meta.Module, source string, target string, opts CompareOptions, e ConfigEdit, id val.Value) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) (err error) {
+			switch r.Meta.Ident() {
+			case "edit-id":
+				hnd.Val = id
+			case "operation":
+				hnd.Val, err = node.NewValue(r.Meta.Type(), e.Operation)
+			case "target":
+				hnd.Val = val.String(e.Resource)
+			case "value":
+				if e.After != nil {
+					hnd.Val = val.Any{Thing: patchValue(mods, e, e.After, opts.ReportOrigin && isOperational(target))}
+				}
+			case "source-value":
+				if e.Before != nil {
+					hnd.Val = val.Any{Thing: patchValue(mods, e, e.Before, opts.ReportOrigin && isOperational(source))}
+				}
+			}
+			return
+		},
+	}
+}
+
+func isOperational(datastore string) bool {
+	return strings.HasSuffix(datastore, "operational")
+}
+
+// patchValue wraps value in the name of the edited node as YANG Patch
+// expects e.g. {"bird:bird":[{"name":"owl"}]}. Values of sensitive leaves
+// are masked.
+func patchValue(mods map[string]*meta.Module, e ConfigEdit, v interface{}, origin bool) map[string]interface{} {
+	def := findResource(mods, e.Resource)
+	if def == nil {
+		return map[string]interface{}{"value": v}
+	}
+	v = redacted(def, v)
+	name := meta.OriginalModule(def).Ident() + ":" + def.Ident()
+	wrapped := make(map[string]interface{})
+	if _, isList := def.(*meta.List); isList {
+		wrapped[name] = []interface{}{v}
+	} else {
+		wrapped[name] = v
+	}
+	if origin {
+		o := "ietf-origin:unknown"
+		if hc, valid := def.(meta.HasConfig); valid && hc.Config() {
+			o = "ietf-origin:intended"
+		}
+		annotation := map[string]interface{}{"ietf-origin:origin": o}
+		if _, isLeaf := def.(meta.Leafable); isLeaf {
+			wrapped["@"+name] = annotation
+		} else if data, valid := v.(map[string]interface{}); valid {
+			copy := map[string]interface{}{"@": annotation}
+			for k, x := range data {
+				copy[k] = x
+			}
+			if _, isList := def.(*meta.List); isList {
+				wrapped[name] = []interface{}{copy}
+			} else {
+				wrapped[name] = copy
+			}
+		}
+	}
+	return wrapped
+}
+
+// findResource finds definition of RESTCONF data resource path
+func findResource(mods map[string]*meta.Module, resource string) meta.Definition {
+	segs := strings.Split(strings.TrimPrefix(resource, "/"), "/")
+	module, _, _ := strings.Cut(segs[0], ":")
+	m := mods[module]
+	if m == nil {
+		return nil
+	}
+	var parent meta.HasDataDefinitions = m
+	var def meta.Definition
+	for _, seg := range segs {
+		ident, _, _ := strings.Cut(seg, "=")
+		if colon := strings.IndexRune(ident, ':'); colon >= 0 {
+			ident = ident[colon+1:]
+		}
+		if parent == nil {
+			return nil
+		}
+		def = meta.Find(parent, ident)
+		if def == nil {
+			return nil
+		}
+		parent, _ = def.(meta.HasDataDefinitions)
+	}
+	return def
+}
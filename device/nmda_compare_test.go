@@ -0,0 +1,186 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestNmdaCompare(t *testing.T) {
+	ypath := source.Path("../yang:../yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(ypath, `module x {
+		revision 0;
+		list item {
+			key id;
+			leaf id {
+				type string;
+			}
+			leaf size {
+				type int32;
+			}
+			leaf temp {
+				config false;
+				type int32;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	d := device.New(ypath)
+	data := map[string]interface{}{
+		"item": []interface{}{
+			map[string]interface{}{"id": "a", "size": 1, "temp": 30},
+			map[string]interface{}{"id": "b", "size": 2, "temp": 40},
+		},
+	}
+	d.AddBrowser(node.NewBrowser(m, nodeutil.ReflectChild(data)))
+	fc.RequireEqual(t, nil, d.Add("ietf-nmda-compare", device.NmdaCompareNode(d)))
+	c := d.EnableCandidate()
+	cb, _ := c.Browser("x")
+	sel, err := cb.Root().Find("item=a")
+	fc.RequireEqual(t, nil, err)
+	edit, _ := nodeutil.ReadJSON(`{"size":9}`)
+	fc.RequireEqual(t, nil, sel.UpsertFrom(edit))
+	sel, err = cb.Root().Find("item=b")
+	fc.RequireEqual(t, nil, err)
+	fc.RequireEqual(t, nil, sel.Delete())
+
+	b, _ := d.Browser("ietf-nmda-compare")
+	action := func(input string) *node.Selection {
+		t.Helper()
+		sel, err := b.Root().Find("compare")
+		fc.RequireEqual(t, nil, err)
+		in, _ := nodeutil.ReadJSON(input)
+		out, err := sel.Action(in)
+		fc.RequireEqual(t, nil, err)
+		return out
+	}
+	compare := func(input string) string {
+		t.Helper()
+		actual, err := nodeutil.WriteJSON(action(input))
+		fc.RequireEqual(t, nil, err)
+		return actual
+	}
+
+	noMatches, err := action(`{"source":"ietf-datastores:running","target":"ietf-datastores:operational"}`).GetValue("no-matches")
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, true, noMatches != nil)
+
+	fc.AssertEqual(t, `{"differences":{"yang-patch":{"patch-id":"compare running candidate","edit":[`+
+		`{"edit-id":"edit-1","operation":"replace","target":"/x:item=a/size","value":{"x:size":9},"source-value":{"x:size":1}},`+
+		`{"edit-id":"edit-2","operation":"delete","target":"/x:item=b","source-value":{"x:item":[{"id":"b","size":2}]}}]}}}`,
+		compare(`{"source":"ietf-datastores:running","target":"ietf-datastores:candidate"}`))
+
+	fc.AssertEqual(t, `{"differences":{"yang-patch":{"patch-id":"compare running candidate","edit":[`+
+		`{"edit-id":"edit-1","operation":"delete","target":"/x:item=b","source-value":{"x:item":[{"id":"b","size":2}]}}]}}}`,
+		compare(`{"source":"ietf-datastores:running","target":"ietf-datastores:candidate","subtree-filter":{"x:item":{"id":"b"}}}`))
+
+	fc.AssertEqual(t, `{"differences":{"yang-patch":{"patch-id":"compare running operational","edit":[`+
+		`{"edit-id":"edit-1","operation":"create","target":"/x:item=a/temp","value":{"@x:temp":{"ietf-origin:origin":"ietf-origin:unknown"},"x:temp":30}}]}}}`,
+		compare(`{"source":"ietf-datastores:running","target":"ietf-datastores:operational","all":[null],"report-origin":[null],"subtree-filter":{"x:item":{"id":"a"}}}`))
+}
+
+func TestNmdaCompareSensitive(t *testing.T) {
+	ypath := source.Path("../yang:../yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(ypath, `module x {
+		import ietf-netconf-acm {
+			prefix nacm;
+		}
+		revision 0;
+		container account {
+			leaf name {
+				type string;
+			}
+			leaf password {
+				nacm:default-deny-all;
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	d := device.New(ypath)
+	data := map[string]interface{}{
+		"account": map[string]interface{}{"name": "joe", "password": "secret"},
+	}
+	d.AddBrowser(node.NewBrowser(m, nodeutil.ReflectChild(data)))
+	fc.RequireEqual(t, nil, d.Add("ietf-nmda-compare", device.NmdaCompareNode(d)))
+	c := d.EnableCandidate()
+	cb, _ := c.Browser("x")
+	edit, _ := nodeutil.ReadJSON(`{"account":{"password":"changed"}}`)
+	fc.RequireEqual(t, nil, cb.Root().UpsertFrom(edit))
+
+	b, _ := d.Browser("ietf-nmda-compare")
+	sel, err := b.Root().Find("compare")
+	fc.RequireEqual(t, nil, err)
+	in, _ := nodeutil.ReadJSON(`{"source":"ietf-datastores:running","target":"ietf-datastores:candidate"}`)
+	out, err := sel.Action(in)
+	fc.RequireEqual(t, nil, err)
+	actual, err := nodeutil.WriteJSON(out)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, `{"differences":{"yang-patch":{"patch-id":"compare running candidate","edit":[`+
+		`{"edit-id":"edit-1","operation":"replace","target":"/x:account/password","value":{"x:password":"****"},"source-value":{"x:password":"****"}}]}}}`,
+		actual)
+}
+
+func TestNmdaCompareAccess(t *testing.T) {
+	ypath := source.Path("../yang:../yang/ietf-rfc")
+	d := device.New(ypath)
+	for _, ident := range []string{"x", "y"} {
+		m, err := parser.LoadModuleFromString(ypath, `module `+ident+` {
+			revision 0;
+			leaf size {
+				type int32;
+			}
+		}`)
+		fc.RequireEqual(t, nil, err)
+		d.AddBrowser(node.NewBrowser(m, nodeutil.ReflectChild(map[string]interface{}{"size": 1})))
+	}
+	fc.RequireEqual(t, nil, d.Add("ietf-nmda-compare", device.NmdaCompareNode(d)))
+	c := d.EnableCandidate()
+	for _, ident := range []string{"x", "y"} {
+		cb, _ := c.Browser(ident)
+		edit, _ := nodeutil.ReadJSON(`{"size":2}`)
+		fc.RequireEqual(t, nil, cb.Root().UpsertFrom(edit))
+	}
+
+	rbac := secure.NewRbac()
+	role := secure.NewRole()
+	role.Access["ietf-nmda-compare"] = &secure.AccessControl{Path: "ietf-nmda-compare", Permissions: secure.Full}
+	role.Access["x"] = &secure.AccessControl{Path: "x", Permissions: secure.Read}
+	rbac.Roles["joe"] = role
+	b, _ := d.Browser("ietf-nmda-compare")
+	root := b.Root()
+	rbac.ConstrainRoot("joe", root.Constraints)
+	root.Context = root.Constraints.ContextConstraint(root)
+	sel, err := root.Find("compare")
+	fc.RequireEqual(t, nil, err)
+	in, _ := nodeutil.ReadJSON(`{"source":"ietf-datastores:running","target":"ietf-datastores:candidate"}`)
+	out, err := sel.Action(in)
+	fc.RequireEqual(t, nil, err)
+	actual, err := nodeutil.WriteJSON(out)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, `{"differences":{"yang-patch":{"patch-id":"compare running candidate","edit":[`+
+		`{"edit-id":"edit-1","operation":"replace","target":"/x:size","value":{"x:size":2},"source-value":{"x:size":1}}]}}}`,
+		actual)
+}
+
+func TestNmdaCompareDrift(t *testing.T) {
+	d, birds := testdata.BirdDevice(`{"bird":[{"name":"robin","wingspan":10}]}`)
+	d.EnableConfigChanges()
+
+	// device changes its own config
+	birds["robin"].Wingspan = 11
+
+	edits, err := device.CompareDatastores(d, "ietf-datastores:running", "ietf-datastores:operational", device.CompareOptions{})
+	fc.RequireEqual(t, nil, err)
+	fc.RequireEqual(t, 1, len(edits))
+	fc.AssertEqual(t, "/bird:bird=robin/wingspan", edits[0].Resource)
+	fc.AssertEqual(t, float64(10), edits[0].Before)
+	fc.AssertEqual(t, float64(11), edits[0].After)
+}
@@ -0,0 +1,211 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// ExportConfig is the config of every module in the same form as
+// ApplyStartupConfigData takes. Modules without config are left out.
+func (self *Local) ExportConfig() (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	for _, module := range self.moduleOrder() {
+		b, _ := self.Browser(module)
+		if b == nil {
+			continue
+		}
+		data, err := readConfig(b)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			config[module] = data
+		}
+	}
+	return config, nil
+}
+
+func readConfig(b *node.Browser) (map[string]interface{}, error) {
+	return readSelection(b.Root())
+}
+
+func readSelection(sel *node.Selection) (map[string]interface{}, error) {
+	if err := node.BuildConstraints(sel, map[string][]string{"content": {"config"}}); err != nil {
+		return nil, err
+	}
+	return readAll(sel)
+}
+
+func readAll(sel *node.Selection) (map[string]interface{}, error) {
+	current, err := nodeutil.WriteJSON(sel)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	if err = json.Unmarshal([]byte(current), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SaveConfig writes config of every module in form ApplyStartupConfig reads
+func (self *Local) SaveConfig(out io.Writer) error {
+	config, err := self.ExportConfig()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(config)
+}
+
+// SaveConfigFile replaces file atomically so file is never left half written
+func (self *Local) SaveConfigFile(fname string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = self.SaveConfig(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fname)
+}
+
+const DefaultAutosaveDelay = time.Second
+
+// Persist saves running config to startup file and resets device to
+// factory defaults
+type Persist struct {
+	File string
+
+	// Save after every edit once there have been no more edits for
+	// AutosaveDelay
+	Autosave      bool
+	AutosaveDelay time.Duration
+
+	// Optional: config applied on factory reset, otherwise factory reset
+	// clears all config except of modules in Keep
+	FactoryDefaultFile string
+
+	// Modules factory reset leaves as is unless factory defaults have config
+	// for them e.g. server's own settings so device stays reachable
+	Keep []string
+
+	d     *Local
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func NewPersist(d *Local, fname string) *Persist {
+	return &Persist{
+		File:          fname,
+		AutosaveDelay: DefaultAutosaveDelay,
+		d:             d,
+	}
+}
+
+// Save config now, cancelling any pending autosave
+func (p *Persist) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.File == "" {
+		return fmt.Errorf("%w. no startup file configured", fc.BadRequestError)
+	}
+	return p.d.SaveConfigFile(p.File)
+}
+
+// Changed is called after each successful edit.  Saves are delayed so
+// many edits in a row are saved once.
+func (p *Persist) Changed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.Autosave || p.File == "" {
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(p.AutosaveDelay, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.timer != timer {
+			// saved or rescheduled since
+			return
+		}
+		p.timer = nil
+		if err := p.d.SaveConfigFile(p.File); err != nil {
+			fc.Err.Printf("could not save config to %s. %s", p.File, err)
+		}
+	})
+	p.timer = timer
+}
+
+// FactoryReset replaces config of every module with factory defaults and
+// saves the result
+func (p *Persist) FactoryReset() error {
+	defaults := make(map[string]interface{})
+	if p.FactoryDefaultFile != "" {
+		f, err := os.Open(p.FactoryDefaultFile)
+		if err != nil {
+			return err
+		}
+		err = json.NewDecoder(f).Decode(&defaults)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	keep := make(map[string]bool)
+	for _, module := range p.Keep {
+		_, hasDefaults := defaults[module]
+		keep[module] = !hasDefaults
+	}
+	var modules []string
+	for _, module := range p.d.moduleOrder() {
+		if !keep[module] {
+			modules = append(modules, module)
+		}
+	}
+	if err := p.d.replaceConfig("", defaults, modules); err != nil {
+		return err
+	}
+	p.d.runningChanged("factory reset")
+	if p.File == "" {
+		return nil
+	}
+	return p.Save()
+}
+
+// FactoryDefaultNode implements ietf-factory-default
+func FactoryDefaultNode(p *Persist) node.Node {
+	return &nodeutil.Basic{
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "factory-reset":
+				return nil, p.FactoryReset()
+			}
+			return nil, nil
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package device
+
+import (
+	"sort"
+
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// Implementation of RFC8528 schema-mounts data
+
+type mountPointEntry struct {
+	module string
+	label  string
+	config bool
+}
+
+// SchemaMountNode lists mount points of all modules in device
+func SchemaMountNode(d Device) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "schema-mounts":
+				return schemaMountsNode(d), nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+func schemaMountsNode(d Device) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "mount-point":
+				if entries := mountPointEntries(d); len(entries) > 0 {
+					return mountPointListNode(entries), nil
+				}
+			}
+			return nil, nil
+		},
+	}
+}
+
+func mountPointEntries(d Device) []mountPointEntry {
+	var entries []mountPointEntry
+	found := make(map[[2]string]bool)
+	for _, m := range d.Modules() {
+		for _, def := range MountPoints(m) {
+			key := [2]string{m.Ident(), MountPoint(def)}
+			if found[key] {
+				continue
+			}
+			found[key] = true
+			entry := mountPointEntry{module: key[0], label: key[1], config: true}
+			if hc, valid := def.(meta.HasConfig); valid {
+				entry.config = hc.Config()
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].module == entries[j].module {
+			return entries[i].label < entries[j].label
+		}
+		return entries[i].module < entries[j].module
+	})
+	return entries
+}
+
+func mountPointListNode(entries []mountPointEntry) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var found *mountPointEntry
+			if r.Key != nil {
+				for i := range entries {
+					if entries[i].module == r.Key[0].String() && entries[i].label == r.Key[1].String() {
+						found = &entries[i]
+						break
+					}
+				}
+			} else if r.Row < len(entries) {
+				found = &entries[r.Row]
+			}
+			if found == nil {
+				return nil, nil, nil
+			}
+			key := []val.Value{val.String(found.module), val.String(found.label)}
+			return mountPointNode(*found), key, nil
+		},
+	}
+}
+
+func mountPointNode(entry mountPointEntry) node.Node {
+	return &nodeutil.Basic{
+		OnChoose: func(sel *node.Selection, choice *meta.Choice) (*meta.ChoiceCase, error) {
+			return choice.Cases()["inline"], nil
+		},
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "inline":
+				return &nodeutil.Basic{}, nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "module":
+				hnd.Val = val.String(entry.module)
+			case "label":
+				hnd.Val = val.String(entry.label)
+			case "config":
+				hnd.Val = val.Bool(entry.config)
+			}
+			return nil
+		},
+	}
+}
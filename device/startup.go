@@ -0,0 +1,301 @@
+package device
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// Startup config is applied as a transaction:
+//  1. every module is validated against its schema and all errors are
+//     reported together, nothing is applied if there are any
+//  2. modules are applied in the order they were added to device
+//  3. if any module fails, modules already applied are restored to the
+//     config they had before
+//
+// Only types and structure are validated up front. Mandatory, must and when
+// are checked by modules as config is applied and failures there roll back
+// like any other.
+
+// validateStartup returns an error for each type or structure problem found
+// in config
+func (self *Local) validateStartup(config map[string]interface{}) []error {
+	var errs []error
+	modules := make([]string, 0, len(config))
+	for module := range config {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		b, _ := self.Browser(module)
+		if b == nil {
+			errs = append(errs, fmt.Errorf("%w. browser not found: %s", fc.NotFoundError, module))
+			continue
+		}
+		data, valid := config[module].(map[string]interface{})
+		if !valid {
+			errs = append(errs, fmt.Errorf("%w. %s: expected object", fc.BadRequestError, module))
+			continue
+		}
+		errs = validateConfig(b.Meta, module+":", data, errs)
+	}
+	return errs
+}
+
+func validateConfig(parent meta.HasDataDefinitions, path string, data map[string]interface{}, errs []error) []error {
+	idents := make([]string, 0, len(data))
+	for ident := range data {
+		idents = append(idents, ident)
+	}
+	sort.Strings(idents)
+	for _, key := range idents {
+		v := data[key]
+		ident := key
+		if colon := strings.IndexRune(ident, ':'); colon >= 0 {
+			ident = ident[colon+1:]
+		}
+		p := path + ident
+		def := parent.Definition(ident)
+		if def == nil {
+			errs = append(errs, fmt.Errorf("%w. %s: not found in schema", fc.BadRequestError, p))
+			continue
+		}
+		if hc, valid := def.(meta.HasConfig); valid && !hc.Config() {
+			errs = append(errs, fmt.Errorf("%w. %s: not config", fc.BadRequestError, p))
+			continue
+		}
+		switch x := def.(type) {
+		case meta.Leafable:
+			if _, err := node.NewValue(x.Type(), v); err != nil {
+				errs = append(errs, fmt.Errorf("%w. %s: %s", fc.BadRequestError, p, err))
+			}
+		case *meta.List:
+			items, valid := v.([]interface{})
+			if !valid {
+				errs = append(errs, fmt.Errorf("%w. %s: expected array", fc.BadRequestError, p))
+				continue
+			}
+			for i, item := range items {
+				itemData, valid := item.(map[string]interface{})
+				if !valid {
+					errs = append(errs, fmt.Errorf("%w. %s[%d]: expected object", fc.BadRequestError, p, i))
+					continue
+				}
+				itemPath := fmt.Sprintf("%s[%d]", p, i)
+				for _, k := range x.KeyMeta() {
+					if _, found := itemData[k.Ident()]; !found {
+						errs = append(errs, fmt.Errorf("%w. %s: missing key %s", fc.BadRequestError, itemPath, k.Ident()))
+					}
+				}
+				errs = validateConfig(x, itemPath+"/", itemData, errs)
+			}
+		case meta.HasDataDefinitions:
+			childData, valid := v.(map[string]interface{})
+			if !valid {
+				errs = append(errs, fmt.Errorf("%w. %s: expected object", fc.BadRequestError, p))
+				continue
+			}
+			errs = validateConfig(x, p+"/", childData, errs)
+		default:
+			errs = append(errs, fmt.Errorf("%w. %s: not data", fc.BadRequestError, p))
+		}
+	}
+	return errs
+}
+
+// moduleConfig is config of a module that can be restored to. Only top
+// level definitions in idents are touched.
+type moduleConfig struct {
+	module string
+	b      *node.Browser
+	idents []string
+	data   map[string]interface{}
+}
+
+// snapshotConfig saves config of definitions that data is about to touch
+func snapshotConfig(module string, b *node.Browser, data map[string]interface{}) (*moduleConfig, error) {
+	current, err := readConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	return &moduleConfig{
+		module: module,
+		b:      b,
+		idents: topIdents(data),
+		data:   current,
+	}, nil
+}
+
+func topIdents(data ...map[string]interface{}) []string {
+	found := make(map[string]bool)
+	var idents []string
+	for _, d := range data {
+		for key := range d {
+			ident := key
+			if colon := strings.IndexRune(ident, ':'); colon >= 0 {
+				ident = ident[colon+1:]
+			}
+			if !found[ident] {
+				found[ident] = true
+				idents = append(idents, ident)
+			}
+		}
+	}
+	sort.Strings(idents)
+	return idents
+}
+
+// restore removes config that is not in data and writes config that is.
+// Leaves with a default are set back to their default and containers are
+// restored in place so their state is kept.
+func (c *moduleConfig) restore() error {
+	return restoreConfig(c.b.Root(), c.b.Meta, c.idents, c.data)
+}
+
+func restoreConfig(sel *node.Selection, parent meta.HasDataDefinitions, idents []string, data map[string]interface{}) error {
+	restore := make(map[string]interface{})
+	for _, ident := range idents {
+		def := meta.Find(parent, ident)
+		prev, existed := data[ident]
+		if leaf, isLeaf := def.(meta.Leafable); isLeaf {
+			if existed {
+				restore[ident] = prev
+			} else if leaf.HasDefault() {
+				restore[ident] = leaf.DefaultValue()
+			} else if err := sel.ClearField(leaf); err != nil {
+				return err
+			}
+			continue
+		}
+		child, err := sel.Find(ident)
+		if err != nil {
+			return err
+		}
+		if child == nil {
+			if existed {
+				restore[ident] = prev
+			}
+			continue
+		}
+		if list, isList := def.(*meta.List); isList {
+			missing, err := restoreItems(child, list, prev)
+			if err != nil {
+				return err
+			}
+			if len(missing) > 0 {
+				restore[ident] = missing
+			}
+			continue
+		}
+		if !existed {
+			if err = child.Delete(); err != nil {
+				return err
+			}
+			continue
+		}
+		current, err := readSelection(child)
+		if err != nil {
+			return err
+		}
+		prevData, _ := prev.(map[string]interface{})
+		if err = restoreConfig(child, def.(meta.HasDataDefinitions), topIdents(current, prevData), prevData); err != nil {
+			return err
+		}
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+	return sel.UpsertFrom(nodeutil.ReflectChild(restore))
+}
+
+// restoreItems removes list items that are not in snapshot and restores the
+// items that are in place. Items in snapshot that no longer exist are
+// returned to be recreated.
+func restoreItems(sel *node.Selection, list *meta.List, snapshot interface{}) ([]interface{}, error) {
+	prev := make(map[string]map[string]interface{})
+	var order []string
+	items, _ := snapshot.([]interface{})
+	for _, item := range items {
+		if data, valid := item.(map[string]interface{}); valid {
+			key, err := snapshotKey(list, data)
+			if err != nil {
+				return nil, err
+			}
+			prev[key] = data
+			order = append(order, key)
+		}
+	}
+	found := make(map[string]bool)
+	var added []*node.Selection
+	li, err := sel.First()
+	for ; err == nil && li.Selection != nil; li, err = li.Next() {
+		var key []string
+		for _, k := range li.Key {
+			key = append(key, k.String())
+		}
+		id := strings.Join(key, ",")
+		data, existed := prev[id]
+		if !existed {
+			added = append(added, li.Selection)
+			continue
+		}
+		found[id] = true
+		current, err := readSelection(li.Selection)
+		if err != nil {
+			return nil, err
+		}
+		if err = restoreConfig(li.Selection, list, nonKeyIdents(list, current, data), data); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range added {
+		if err := item.Delete(); err != nil {
+			return nil, err
+		}
+	}
+	var missing []interface{}
+	for _, id := range order {
+		if !found[id] {
+			missing = append(missing, prev[id])
+		}
+	}
+	return missing, nil
+}
+
+// nonKeyIdents are the top idents of data except the list keys that identify
+// item and cannot change
+func nonKeyIdents(list *meta.List, data ...map[string]interface{}) []string {
+	var idents []string
+	for _, ident := range topIdents(data...) {
+		isKey := false
+		for _, k := range list.KeyMeta() {
+			isKey = isKey || k.Ident() == ident
+		}
+		if !isKey {
+			idents = append(idents, ident)
+		}
+	}
+	return idents
+}
+
+// snapshotKey formats key of item in snapshot the same way as the key of
+// the live item, e.g. numbers read from JSON are float64
+func snapshotKey(list *meta.List, data map[string]interface{}) (string, error) {
+	var key []string
+	for _, k := range list.KeyMeta() {
+		v, err := node.NewValue(k.Type(), data[k.Ident()])
+		if err != nil {
+			return "", err
+		}
+		key = append(key, v.String())
+	}
+	return strings.Join(key, ","), nil
+}
@@ -0,0 +1,165 @@
+package device_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+)
+
+func TestStartupConfig(t *testing.T) {
+	d, birds := testdata.BirdDevice(`{"bird":[{"name":"robin"}]}`)
+	m, err := parser.LoadModuleFromString(testdata.YangPath, `module tree {
+		revision 0;
+		leaf height {
+			type int32;
+		}
+		leaf age {
+			config false;
+			type int32;
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	var height interface{}
+	d.AddBrowser(node.NewBrowser(m, &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			if r.Clear {
+				height = nil
+			} else if r.Write {
+				if hnd.Val.Value().(int) > 100 {
+					return errors.New("too tall")
+				}
+				height = hnd.Val.Value()
+			}
+			return nil
+		},
+	}))
+
+	t.Run("validate", func(t *testing.T) {
+		err := d.ApplyStartupConfigData(map[string]interface{}{
+			"bird": map[string]interface{}{
+				"bird": []interface{}{
+					map[string]interface{}{"name": "owl", "wingspan": "wide"},
+					map[string]interface{}{"wingspan": 10},
+				},
+				"nest": true,
+			},
+			"tree": map[string]interface{}{"age": 10},
+			"rock": map[string]interface{}{},
+		})
+		fc.RequireEqual(t, true, err != nil)
+		fc.AssertEqual(t, true, errors.Is(err, fc.BadRequestError))
+		fc.AssertEqual(t, true, errors.Is(err, fc.NotFoundError))
+		msg := err.Error()
+		for _, expected := range []string{
+			"bird:bird[0]/wingspan",
+			"bird:bird[1]: missing key name",
+			"bird:nest: not found in schema",
+			"tree:age: not config",
+			"browser not found: rock",
+		} {
+			fc.AssertEqual(t, true, strings.Contains(msg, expected), expected)
+		}
+		err = d.ApplyStartupConfigData(map[string]interface{}{
+			"tree": 1,
+		})
+		fc.AssertEqual(t, "bad request. tree: expected object", err.Error())
+		_, applied := birds["owl"]
+		fc.AssertEqual(t, false, applied)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		err := d.ApplyStartupConfigData(map[string]interface{}{
+			"tree": map[string]interface{}{"height": 200},
+			"bird": map[string]interface{}{
+				"bird": []interface{}{
+					map[string]interface{}{"name": "owl"},
+					map[string]interface{}{
+						"name":     "robin",
+						"wingspan": 5,
+						"species":  map[string]interface{}{"name": "thrush"},
+					},
+				},
+			},
+		})
+		fc.AssertEqual(t, "tree. too tall", err.Error())
+		_, applied := birds["owl"]
+		fc.AssertEqual(t, false, applied)
+		robin, kept := birds["robin"]
+		fc.RequireEqual(t, true, kept)
+		fc.AssertEqual(t, 0, robin.Wingspan)
+		fc.AssertEqual(t, true, robin.Species == nil)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		err := d.ApplyStartupConfigData(map[string]interface{}{
+			"tree": map[string]interface{}{"height": 20},
+			"bird": map[string]interface{}{
+				"bird": []interface{}{
+					map[string]interface{}{"name": "owl"},
+				},
+			},
+		})
+		fc.AssertEqual(t, nil, err)
+		_, applied := birds["owl"]
+		fc.AssertEqual(t, true, applied)
+		fc.AssertEqual(t, 20, height)
+	})
+}
+
+func TestStartupConfigNumericKey(t *testing.T) {
+	d, _ := testdata.BirdDevice("")
+	m, err := parser.LoadModuleFromString(testdata.YangPath, `module tree {
+		revision 0;
+		list ring {
+			key "year";
+			leaf year {
+				type int32;
+			}
+			leaf planted {
+				config false;
+				type string;
+			}
+		}
+		leaf height {
+			type int32;
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	rings := map[string]interface{}{
+		"ring": []interface{}{
+			map[string]interface{}{"year": 1000000, "planted": "spring"},
+		},
+	}
+	d.AddBrowser(node.NewBrowser(m, &nodeutil.Extend{
+		Base: nodeutil.ReflectChild(rings),
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			if r.Meta.Ident() == "height" {
+				if r.Write && !r.Clear && hnd.Val.Value().(int) > 100 {
+					return errors.New("too tall")
+				}
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+	}))
+	err = d.ApplyStartupConfigData(map[string]interface{}{
+		"tree": map[string]interface{}{
+			"ring": []interface{}{
+				map[string]interface{}{"year": 2000000},
+			},
+			"height": 200,
+		},
+	})
+	fc.AssertEqual(t, "tree. too tall", err.Error())
+	b, err := d.Browser("tree")
+	fc.RequireEqual(t, nil, err)
+	actual, err := nodeutil.WriteJSON(b.Root())
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, `{"ring":[{"year":1000000,"planted":"spring"}]}`, actual)
+}
@@ -0,0 +1,330 @@
+package device
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/val"
+)
+
+// checkWhen evaluates when expressions on leaves with and, or, not(),
+// parentheses and parent paths like those in ietf-yang-patch that
+// node.CheckWhen cannot read. It is added ahead of node.CheckWhen and when
+// expression holds it reads the value itself so node.CheckWhen never sees
+// the expression. Only meant for reading.
+type checkWhen struct{}
+
+func (checkWhen) CheckFieldPreConstraints(r *node.FieldRequest, hnd *node.ValueHandle) (bool, error) {
+	hw, valid := r.Meta.(meta.HasWhen)
+	if !valid || hw.When() == nil || r.Write || r.Clear {
+		return true, nil
+	}
+	expr, err := parseWhen(hw.When().Expression())
+	if err != nil {
+		return false, err
+	}
+	holds, err := expr.eval(whenContext{sel: r.Selection, leaf: r.Meta})
+	if !holds || err != nil {
+		return false, err
+	}
+	return false, r.Selection.Node.Field(*r, hnd)
+}
+
+type whenContext struct {
+	sel *node.Selection
+
+	// leaf of sel that is the context node or nil if sel is
+	leaf meta.Definition
+}
+
+type whenExpr interface {
+	eval(c whenContext) (bool, error)
+}
+
+type whenOr struct {
+	a, b whenExpr
+}
+
+func (x whenOr) eval(c whenContext) (bool, error) {
+	if holds, err := x.a.eval(c); holds || err != nil {
+		return holds, err
+	}
+	return x.b.eval(c)
+}
+
+type whenAnd struct {
+	a, b whenExpr
+}
+
+func (x whenAnd) eval(c whenContext) (bool, error) {
+	if holds, err := x.a.eval(c); !holds || err != nil {
+		return holds, err
+	}
+	return x.b.eval(c)
+}
+
+type whenNot struct {
+	x whenExpr
+}
+
+func (x whenNot) eval(c whenContext) (bool, error) {
+	holds, err := x.x.eval(c)
+	return !holds, err
+}
+
+// whenPath is a relative or absolute path to a node optionally compared to
+// a literal e.g. ../operation = 'create'
+type whenPath struct {
+	segs    []string
+	oper    string
+	literal string
+}
+
+func (x whenPath) eval(c whenContext) (bool, error) {
+	sel, leaf := c.sel, c.leaf
+	for i, seg := range x.segs {
+		switch {
+		case seg == "" && i == 0:
+			for sel.Parent() != nil {
+				sel = sel.Parent()
+			}
+			leaf = nil
+			continue
+		case seg == ".":
+			continue
+		case seg == "..":
+			if leaf != nil {
+				leaf = nil
+			} else if sel = parentNode(sel); sel == nil {
+				return false, nil
+			}
+			continue
+		}
+		if leaf != nil {
+			return false, nil
+		}
+		if colon := strings.IndexRune(seg, ':'); colon >= 0 {
+			seg = seg[colon+1:]
+		}
+		def := meta.Find(sel.Meta().(meta.HasDefinitions), seg)
+		if def == nil {
+			return false, fmt.Errorf("'%s' not found in when expression", seg)
+		}
+		if _, isLeaf := def.(meta.Leafable); isLeaf {
+			leaf = def
+			continue
+		}
+		child, err := sel.Find(seg)
+		if child == nil || err != nil {
+			return false, err
+		}
+		sel = child
+	}
+	if leaf == nil {
+		if x.oper != "" {
+			return false, fmt.Errorf("only leaves can be compared in when expression")
+		}
+		return true, nil
+	}
+	v, err := sel.GetValue(leaf.Ident())
+	if v == nil || err != nil {
+		return false, err
+	}
+	if x.oper == "" {
+		return true, nil
+	}
+	if l, isList := v.(val.Listable); isList {
+		for i := 0; i < l.Len(); i++ {
+			if holds, err := x.compare(l.Item(i)); holds || err != nil {
+				return holds, err
+			}
+		}
+		return false, nil
+	}
+	return x.compare(v)
+}
+
+func (x whenPath) compare(v val.Value) (bool, error) {
+	switch x.oper {
+	case "=":
+		return v.String() == x.literal, nil
+	case "!=":
+		return v.String() != x.literal, nil
+	}
+	a, err := strconv.ParseFloat(v.String(), 64)
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not a number in when expression", v.String())
+	}
+	b, err := strconv.ParseFloat(x.literal, 64)
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not a number in when expression", x.literal)
+	}
+	switch x.oper {
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	}
+	return a >= b, nil
+}
+
+// parentNode skips list selections so parent of a list item is the node
+// holding the list
+func parentNode(sel *node.Selection) *node.Selection {
+	p := sel.Parent()
+	if p != nil && p.InsideList {
+		p = p.Parent()
+	}
+	return p
+}
+
+func parseWhen(expr string) (whenExpr, error) {
+	tokens, err := whenTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &whenParser{tokens: tokens}
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in when expression '%s'", p.tokens[p.pos], expr)
+	}
+	return x, nil
+}
+
+type whenParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *whenParser) peek(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *whenParser) or() (whenExpr, error) {
+	x, err := p.and()
+	for err == nil && p.peek(0) == "or" {
+		p.pos++
+		var y whenExpr
+		if y, err = p.and(); err == nil {
+			x = whenOr{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *whenParser) and() (whenExpr, error) {
+	x, err := p.unary()
+	for err == nil && p.peek(0) == "and" {
+		p.pos++
+		var y whenExpr
+		if y, err = p.unary(); err == nil {
+			x = whenAnd{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *whenParser) unary() (whenExpr, error) {
+	switch {
+	case p.peek(0) == "not" && p.peek(1) == "(":
+		p.pos++
+		x, err := p.unary()
+		return whenNot{x}, err
+	case p.peek(0) == "(":
+		p.pos++
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek(0) != ")" {
+			return nil, fmt.Errorf("missing ')' in when expression")
+		}
+		p.pos++
+		return x, nil
+	}
+	return p.path()
+}
+
+func (p *whenParser) path() (whenExpr, error) {
+	t := p.peek(0)
+	switch t {
+	case "", "(", ")", "and", "or":
+		return nil, fmt.Errorf("expected path in when expression but found '%s'", t)
+	}
+	if p.peek(1) == "(" {
+		return nil, fmt.Errorf("function %s not supported in when expression", t)
+	}
+	p.pos++
+	x := whenPath{segs: strings.Split(t, "/")}
+	if isWhenOperator(p.peek(0)) {
+		x.oper = p.peek(0)
+		x.literal = strings.Trim(p.peek(1), `'"`)
+		if x.literal == "" && p.peek(1) == "" {
+			return nil, fmt.Errorf("missing value after %s in when expression", x.oper)
+		}
+		p.pos += 2
+	}
+	return x, nil
+}
+
+func isWhenOperator(t string) bool {
+	switch t {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// whenTokens splits expression into parentheses, quoted literals,
+// operators and names
+func whenTokens(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != c {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated literal in when expression '%s'", expr)
+			}
+			tokens = append(tokens, string(runes[i:end+1]))
+			i = end + 1
+		case strings.ContainsRune("=!<>", c):
+			end := i + 1
+			if end < len(runes) && runes[end] == '=' {
+				end++
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()'\"=!<>", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end
+		}
+	}
+	return tokens, nil
+}
@@ -44,6 +44,10 @@ func loadModuleNode(mods map[string]*meta.Module, resolver ResolveModule, hnd *M
 			if err := p.EndEdit(r); err != nil {
 				return err
 			}
+			if hnd.ConformanceType == ConformanceTypeImport {
+				// loaded with modules that import it
+				return nil
+			}
 			mod, err := resolver.ResolveModuleHnd(*hnd)
 			if err != nil {
 				return err
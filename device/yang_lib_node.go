@@ -1,17 +1,33 @@
 package device
 
 import (
+	"fmt"
+	"hash/fnv"
+	"io"
 	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/meta"
 	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/source"
 	"github.com/freeconf/yang/val"
 )
 
 // Implementation of RFC8525
 
+// DefaultDatastores are the NMDA datastores reported for devices that do not
+// implement HasDatastores
+var DefaultDatastores = []string{"ietf-datastores:running", "ietf-datastores:operational"}
+
+// HasDatastores is implemented by devices that serve datastores other than
+// DefaultDatastores
+type HasDatastores interface {
+	Datastores() []string
+}
+
 // Export device by it's address so protocol server can serve a device
 // often referred to northbound
 type ModuleAddresser func(m *meta.Module) string
@@ -27,9 +43,50 @@ func LocalDeviceYangLibNode(addresser ModuleAddresser, d Device) node.Node {
 			}
 			return nil, nil
 		},
+		OnNotify: func(r node.NotifyRequest) (node.NotifyCloser, error) {
+			notifier, valid := d.(ModuleNotifier)
+			if !valid {
+				// modules never change
+				return func() error { return nil }, nil
+			}
+			var leaf string
+			switch r.Meta.Ident() {
+			case "yang-library-update":
+				leaf = "content-id"
+			case "yang-library-change":
+				leaf = "module-set-id"
+			default:
+				return nil, nil
+			}
+			sub := notifier.OnModuleUpdate(func(module string, change Change) {
+				r.Send(nodeutil.ReflectChild(map[string]interface{}{
+					leaf: ContentId(d.Modules()),
+				}))
+			})
+			return sub.Close, nil
+		},
 	}
 }
 
+// ContentId identifies set of modules and changes when modules are added,
+// removed or change revision. Used for both content-id and module-set-id
+func ContentId(mods map[string]*meta.Module) string {
+	idents := make([]string, 0, len(mods))
+	for ident, m := range mods {
+		if m.Revision() != nil {
+			ident += "@" + m.Revision().Ident()
+		}
+		idents = append(idents, ident)
+	}
+	sort.Strings(idents)
+	h := fnv.New64a()
+	for _, ident := range idents {
+		h.Write([]byte(ident))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
 func localYangLibModuleState(addresser ModuleAddresser, d Device) node.Node {
 	return &nodeutil.Basic{
 		OnChild: func(r node.ChildRequest) (node.Node, error) {
@@ -37,18 +94,35 @@ func localYangLibModuleState(addresser ModuleAddresser, d Device) node.Node {
 			case "module":
 				mods := d.Modules()
 				if len(mods) > 0 {
-					return YangLibModuleList(addresser, mods), nil
+					return yangLibModuleList(addresser, d.SchemaSource(), mods, importOnlyModules(mods), deviationModules(mods)), nil
 				}
 			}
 			return nil, nil
 		},
 		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "module-set-id":
+				hnd.Val = val.String(ContentId(d.Modules()))
+			}
 			return nil
 		},
 	}
 }
 
+// YangLibModuleList lists modules in modules-state. Submodules are not listed
+// as there is no schema source to read their names from.
 func YangLibModuleList(addresser ModuleAddresser, mods map[string]*meta.Module) node.Node {
+	return yangLibModuleList(addresser, nil, mods, nil, deviationModules(mods))
+}
+
+func yangLibModuleList(addresser ModuleAddresser, ypath source.Opener, implemented map[string]*meta.Module, importOnly map[string]*meta.Module, deviations map[string][]*meta.Module) node.Node {
+	mods := make(map[string]*meta.Module, len(implemented)+len(importOnly))
+	for ident, m := range importOnly {
+		mods[ident] = m
+	}
+	for ident, m := range implemented {
+		mods[ident] = m
+	}
 	index := node.NewIndex(mods)
 	index.Sort(func(a, b reflect.Value) bool {
 		return strings.Compare(a.String(), b.String()) < 0
@@ -63,23 +137,32 @@ func YangLibModuleList(addresser ModuleAddresser, mods map[string]*meta.Module)
 				if v := index.NextKey(r.Row); v != node.NO_VALUE {
 					module := v.String()
 					if m = mods[module]; m != nil {
-						key = []val.Value{val.String(m.Ident())}
+						key = []val.Value{val.String(m.Ident()), val.String(revision(m))}
 					}
 				}
 			}
 			if m != nil {
-				return yangLibModuleHandleNode(addresser, m), key, nil
+				_, implement := implemented[m.Ident()]
+				return yangLibModuleHandleNode(addresser, ypath, m, implement, deviations[m.Ident()]), key, nil
 			}
 			return nil, nil, nil
 		},
 	}
 }
 
-func yangLibModuleHandleNode(addresser ModuleAddresser, m *meta.Module) node.Node {
+func yangLibModuleHandleNode(addresser ModuleAddresser, ypath source.Opener, m *meta.Module, implement bool, deviations []*meta.Module) node.Node {
 	return &nodeutil.Basic{
 		OnChild: func(r node.ChildRequest) (node.Node, error) {
-			// deviation
-			// submodule
+			switch r.Meta.Ident() {
+			case "deviation":
+				if len(deviations) > 0 {
+					return yangLibRevisionList(nil, deviations), nil
+				}
+			case "submodule":
+				if subs := submodules(ypath, m); len(subs) > 0 {
+					return yangLibRevisionList(addresser, subs), nil
+				}
+			}
 			return nil, nil
 		},
 		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
@@ -95,32 +178,168 @@ func yangLibModuleHandleNode(addresser ModuleAddresser, m *meta.Module) node.Nod
 			case "namespace":
 				hnd.Val = val.String(m.Namespace())
 			case "feature":
+				if features := enabledFeatures(m); len(features) > 0 {
+					hnd.Val = val.StringList(features)
+				}
 			case "conformance-type":
+				conformance := ConformanceTypeImport
+				if implement {
+					conformance = ConformanceTypeImplement
+				}
+				var err error
+				hnd.Val, err = node.NewValue(r.Meta.Type(), conformance)
+				return err
 			}
 			return nil
 		},
 	}
 }
 
+// yangLibRevisionList is for lists keyed by name and revision like
+// deviations and submodules in modules-state
+func yangLibRevisionList(addresser ModuleAddresser, mods []*meta.Module) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var m *meta.Module
+			if r.Key != nil {
+				for _, candidate := range mods {
+					if candidate.Ident() == r.Key[0].String() {
+						m = candidate
+						break
+					}
+				}
+			} else if r.Row < len(mods) {
+				m = mods[r.Row]
+			}
+			if m == nil {
+				return nil, nil, nil
+			}
+			key := []val.Value{val.String(m.Ident()), val.String(revision(m))}
+			return &nodeutil.Basic{
+				OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+					switch r.Meta.Ident() {
+					case "name":
+						hnd.Val = val.String(m.Ident())
+					case "revision":
+						hnd.Val = val.String(revision(m))
+					case "schema":
+						if addresser != nil {
+							hnd.Val = val.String(addresser(m))
+						}
+					}
+					return nil
+				},
+			}, key, nil
+		},
+	}
+}
+
 func localYangLibYangLibrary(addresser ModuleAddresser, d Device) node.Node {
+	// modules can change between requests, but not within a request
 	mods := d.Modules()
-	modset := moduleSet{ident: "all", module: mods}
+	modset := moduleSet{ident: "all", module: mods, importOnlyModule: importOnlyModules(mods), ypath: d.SchemaSource()}
 	modsets := make(map[string]*moduleSet)
 	modsets["all"] = &modset
+	datastores := DefaultDatastores
+	if hd, valid := d.(HasDatastores); valid {
+		datastores = hd.Datastores()
+	}
 	return &nodeutil.Basic{
 		OnChild: func(r node.ChildRequest) (node.Node, error) {
 			switch r.Meta.Ident() {
 			case "module-set":
 				return YangLibModuleSetList(addresser, modsets), nil
+			case "schema":
+				return yangLibSchemaList(modsets), nil
+			case "datastore":
+				if len(datastores) > 0 {
+					return yangLibDatastoreList(datastores), nil
+				}
 			}
 			return nil, nil
 		},
 		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "content-id":
+				hnd.Val = val.String(ContentId(mods))
+			}
 			return nil
 		},
 	}
 }
 
+// yangLibSchemaList has a schema for each module set of the same name
+func yangLibSchemaList(modsets map[string]*moduleSet) node.Node {
+	idents := make([]string, 0, len(modsets))
+	for ident := range modsets {
+		idents = append(idents, ident)
+	}
+	sort.Strings(idents)
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var ident string
+			if r.Key != nil {
+				if _, found := modsets[r.Key[0].String()]; found {
+					ident = r.Key[0].String()
+				}
+			} else if r.Row < len(idents) {
+				ident = idents[r.Row]
+			}
+			if ident == "" {
+				return nil, nil, nil
+			}
+			return &nodeutil.Basic{
+				OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+					switch r.Meta.Ident() {
+					case "name":
+						hnd.Val = val.String(ident)
+					case "module-set":
+						hnd.Val = val.StringList([]string{ident})
+					}
+					return nil
+				},
+			}, []val.Value{val.String(ident)}, nil
+		},
+	}
+}
+
+// yangLibDatastoreList has all datastores using schema of all modules
+func yangLibDatastoreList(datastores []string) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var ds string
+			if r.Key != nil {
+				for _, candidate := range datastores {
+					if strings.HasSuffix(candidate, ":"+r.Key[0].String()) || candidate == r.Key[0].String() {
+						ds = candidate
+						break
+					}
+				}
+			} else if r.Row < len(datastores) {
+				ds = datastores[r.Row]
+			}
+			if ds == "" {
+				return nil, nil, nil
+			}
+			key, err := node.NewValue(r.Meta.KeyMeta()[0].Type(), ds)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &nodeutil.Basic{
+				OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+					switch r.Meta.Ident() {
+					case "name":
+						hnd.Val = key
+					case "schema":
+						hnd.Val = val.String("all")
+					}
+					return nil
+				},
+			}, []val.Value{key}, nil
+		},
+	}
+}
+
 func YangLibModuleSetList(addresser ModuleAddresser, modsets map[string]*moduleSet) node.Node {
 	index := node.NewIndex(modsets)
 	index.Sort(func(a, b reflect.Value) bool {
@@ -155,12 +374,12 @@ func yangLibModuleSetHandleNode(addresser ModuleAddresser, ms *moduleSet) node.N
 			case "module":
 				mods := ms.Module()
 				if len(mods) > 0 {
-					return YangLibModuleSetModuleList(addresser, mods), nil
+					return yangLibModuleSetModuleList(addresser, ms.ypath, mods, deviationModules(mods), true), nil
 				}
 			case "import-only-module":
 				mods := ms.ImportOnlyModule()
 				if len(mods) > 0 {
-					return YangLibModuleSetModuleList(addresser, mods), nil
+					return yangLibModuleSetModuleList(addresser, ms.ypath, mods, nil, false), nil
 				}
 			}
 			return nil, nil
@@ -175,7 +394,13 @@ func yangLibModuleSetHandleNode(addresser ModuleAddresser, ms *moduleSet) node.N
 	}
 }
 
+// YangLibModuleSetModuleList lists modules of a module set. Submodules are
+// not listed as there is no schema source to read their names from.
 func YangLibModuleSetModuleList(addresser ModuleAddresser, mods map[string]*meta.Module) node.Node {
+	return yangLibModuleSetModuleList(addresser, nil, mods, deviationModules(mods), true)
+}
+
+func yangLibModuleSetModuleList(addresser ModuleAddresser, ypath source.Opener, mods map[string]*meta.Module, deviations map[string][]*meta.Module, implement bool) node.Node {
 	index := node.NewIndex(mods)
 	index.Sort(func(a, b reflect.Value) bool {
 		return strings.Compare(a.String(), b.String()) < 0
@@ -191,21 +416,30 @@ func YangLibModuleSetModuleList(addresser ModuleAddresser, mods map[string]*meta
 					module := v.String()
 					if m = mods[module]; m != nil {
 						key = []val.Value{val.String(m.Ident())}
+						if !implement {
+							// import-only modules are keyed by revision too
+							key = append(key, val.String(revision(m)))
+						}
 					}
 				}
 			}
 			if m != nil {
-				return yangLibModuleSetModuleHandleNode(addresser, m), key, nil
+				return yangLibModuleSetModuleHandleNode(addresser, ypath, m, deviations[m.Ident()]), key, nil
 			}
 			return nil, nil, nil
 		},
 	}
 }
 
-func yangLibModuleSetModuleHandleNode(addresser ModuleAddresser, m *meta.Module) node.Node {
+func yangLibModuleSetModuleHandleNode(addresser ModuleAddresser, ypath source.Opener, m *meta.Module, deviations []*meta.Module) node.Node {
 	return &nodeutil.Basic{
 		OnChild: func(r node.ChildRequest) (node.Node, error) {
-			// submodule
+			switch r.Meta.Ident() {
+			case "submodule":
+				if subs := submodules(ypath, m); len(subs) > 0 {
+					return yangLibSubmoduleList(addresser, subs), nil
+				}
+			}
 			return nil, nil
 		},
 		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
@@ -219,18 +453,262 @@ func yangLibModuleSetModuleHandleNode(addresser ModuleAddresser, m *meta.Module)
 			case "namespace":
 				hnd.Val = val.String(m.Namespace())
 			case "location":
-				hnd.Val = val.String(addresser(m))
+				hnd.Val = val.StringList([]string{addresser(m)})
 			case "feature":
+				if features := enabledFeatures(m); len(features) > 0 {
+					hnd.Val = val.StringList(features)
+				}
+			case "deviation":
+				if len(deviations) > 0 {
+					idents := make([]string, len(deviations))
+					for i, d := range deviations {
+						idents[i] = d.Ident()
+					}
+					hnd.Val = val.StringList(idents)
+				}
 			}
 			return nil
 		},
 	}
 }
 
+func yangLibSubmoduleList(addresser ModuleAddresser, subs []*meta.Module) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var m *meta.Module
+			if r.Key != nil {
+				for _, candidate := range subs {
+					if candidate.Ident() == r.Key[0].String() {
+						m = candidate
+						break
+					}
+				}
+			} else if r.Row < len(subs) {
+				m = subs[r.Row]
+			}
+			if m == nil {
+				return nil, nil, nil
+			}
+			return &nodeutil.Basic{
+				OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+					switch r.Meta.Ident() {
+					case "name":
+						hnd.Val = val.String(m.Ident())
+					case "revision":
+						if m.Revision() != nil {
+							hnd.Val = val.String(m.Revision().Ident())
+						}
+					case "location":
+						hnd.Val = val.StringList([]string{addresser(m)})
+					}
+					return nil
+				},
+			}, []val.Value{val.String(m.Ident())}, nil
+		},
+	}
+}
+
+func revision(m *meta.Module) string {
+	if m.Revision() == nil {
+		return ""
+	}
+	return m.Revision().Ident()
+}
+
+// enabledFeatures are features defined in module that are on in module's
+// feature set
+func enabledFeatures(m *meta.Module) []string {
+	var enabled []string
+	fs := m.FeatureSet()
+	var b meta.Builder
+	for ident := range m.Features() {
+		if fs != nil {
+			iff := b.IfFeature(&meta.Container{}, ident)
+			if on, err := fs.Resolve(iff); err != nil || !on {
+				continue
+			}
+		}
+		enabled = append(enabled, ident)
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// deviationModules are the modules with deviations on each module by name
+func deviationModules(mods map[string]*meta.Module) map[string][]*meta.Module {
+	deviations := make(map[string][]*meta.Module)
+	for _, m := range sortedModules(mods) {
+		targets := make(map[string]bool)
+		for _, d := range m.Deviations() {
+			target := m
+			path := strings.TrimPrefix(d.Ident(), "/")
+			if colon := strings.IndexRune(path, ':'); colon > 0 {
+				var err error
+				if target, err = m.ModuleByPrefix(path[:colon]); err != nil {
+					continue
+				}
+			}
+			if !targets[target.Ident()] {
+				targets[target.Ident()] = true
+				deviations[target.Ident()] = append(deviations[target.Ident()], m)
+			}
+		}
+	}
+	return deviations
+}
+
+// importOnlyModules are imported by modules, directly or indirectly, but
+// are not modules themselves
+func importOnlyModules(mods map[string]*meta.Module) map[string]*meta.Module {
+	imported := make(map[string]*meta.Module)
+	var walk func(m *meta.Module)
+	walk = func(m *meta.Module) {
+		for _, imp := range m.Imports() {
+			dep := imp.Module()
+			if dep == nil {
+				continue
+			}
+			if _, implemented := mods[dep.Ident()]; implemented {
+				continue
+			}
+			if _, found := imported[dep.Ident()]; found {
+				continue
+			}
+			imported[dep.Ident()] = dep
+			walk(dep)
+		}
+	}
+	for _, m := range mods {
+		walk(m)
+	}
+	return imported
+}
+
+// submodules only have a name and revision as meta does not keep them
+// after they are merged into their module. Names are read from include
+// statements in module's source.
+func submodules(ypath source.Opener, m *meta.Module) []*meta.Module {
+	includes := m.Includes()
+	if len(includes) == 0 || ypath == nil {
+		return nil
+	}
+	names, err := includedNames(ypath, m.Ident())
+	if err == nil && len(names) != len(includes) {
+		err = fmt.Errorf("found %d of %d includes", len(names), len(includes))
+	}
+	if err != nil {
+		fc.Err.Printf("could not read submodules of %s. %s", m.Ident(), err)
+		return nil
+	}
+	var subs []*meta.Module
+	var b meta.Builder
+	for i, inc := range includes {
+		sub := b.Submodule(m, names[i], nil)
+		if inc.Revision() != nil {
+			b.Revision(sub, inc.Revision().Ident())
+		} else if inc.RevisionDate() != "" {
+			b.Revision(sub, inc.RevisionDate())
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// includedNames are the submodules a module includes in the order they
+// appear, the same order as meta.Module.Includes
+func includedNames(ypath source.Opener, module string) ([]string, error) {
+	res, err := ypath(module, ".yang")
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, fmt.Errorf("%w. %s resource not found", fc.NotFoundError, module)
+	}
+	if closer, ok := res.(io.Closer); ok {
+		defer closer.Close()
+	}
+	data, err := io.ReadAll(res)
+	if err != nil {
+		return nil, err
+	}
+	tokens := yangTokens(string(data))
+	var names []string
+	for i := 0; i+1 < len(tokens); i++ {
+		statementStart := i == 0 || tokens[i-1] == ";" || tokens[i-1] == "{" || tokens[i-1] == "}"
+		if statementStart && tokens[i] == "include" {
+			names = append(names, tokens[i+1])
+		}
+	}
+	return names, nil
+}
+
+// yangTokens splits YANG into statement keywords, arguments and ; { }
+// dropping comments and quotes
+func yangTokens(yang string) []string {
+	var tokens []string
+	for i := 0; i < len(yang); {
+		c := yang[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(yang[i:], "//"):
+			end := strings.IndexByte(yang[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end
+		case strings.HasPrefix(yang[i:], "/*"):
+			end := strings.Index(yang[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == ';' || c == '{' || c == '}':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(yang) && yang[end] != c {
+				if c == '"' && yang[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(yang) {
+				return append(tokens, yang[i+1:])
+			}
+			tokens = append(tokens, yang[i+1:end])
+			i = end + 1
+		default:
+			end := i
+			for end < len(yang) && !strings.ContainsRune(" \t\r\n;{}\"'", rune(yang[end])) {
+				end++
+			}
+			tokens = append(tokens, yang[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
+
+func sortedModules(mods map[string]*meta.Module) []*meta.Module {
+	sorted := make([]*meta.Module, 0, len(mods))
+	for _, m := range mods {
+		sorted = append(sorted, m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Ident() < sorted[j].Ident()
+	})
+	return sorted
+}
+
 type moduleSet struct {
 	ident            string
 	module           map[string]*meta.Module
 	importOnlyModule map[string]*meta.Module
+
+	// to read submodule names from, nil to not list submodules
+	ypath source.Opener
 }
 
 func (ms *moduleSet) Ident() string {
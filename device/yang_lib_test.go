@@ -8,7 +8,10 @@ import (
 	"github.com/freeconf/restconf/testdata"
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
 )
 
 var update = flag.Bool("update", false, "update golden test files")
@@ -40,3 +43,68 @@ func TestYangLibNode(t *testing.T) {
 	}
 	fc.Gold(t, *update, []byte(actual), "gold/yang_lib.json")
 }
+
+func TestYangLibUpdate(t *testing.T) {
+	d, _ := testdata.BirdDevice(`{}`)
+	moduleNameAsAddress := func(m *meta.Module) string {
+		return m.Ident()
+	}
+	fc.RequireEqual(t, nil, d.Add("ietf-yang-library", device.LocalDeviceYangLibNode(moduleNameAsAddress, d)))
+	b, _ := d.Browser("ietf-yang-library")
+	contentId := func() string {
+		v, err := b.Root().GetValue("yang-library/content-id")
+		fc.RequireEqual(t, nil, err)
+		return v.String()
+	}
+	before := contentId()
+	updates := make(chan string, 1)
+	notif, err := b.Root().Find("yang-library-update")
+	fc.RequireEqual(t, nil, err)
+	sub, err := notif.Notifications(func(n node.Notification) {
+		v, _ := n.Event.GetValue("content-id")
+		updates <- v.String()
+	})
+	fc.RequireEqual(t, nil, err)
+	defer sub()
+
+	fc.AssertEqual(t, true, d.Remove("bird"))
+	fc.AssertEqual(t, false, d.Remove("bird"))
+	after := <-updates
+	fc.AssertEqual(t, true, before != after)
+	fc.AssertEqual(t, after, contentId())
+	_, found := d.Modules()["bird"]
+	fc.AssertEqual(t, false, found)
+}
+
+func TestYangLibDetails(t *testing.T) {
+	ypath := source.Dir("./testdata")
+	lib, err := parser.LoadModuleWithOptions(ypath, "lib", parser.Options{
+		Features: meta.FeaturesOff([]string{"slow"}),
+	})
+	fc.RequireEqual(t, nil, err)
+	dev, err := parser.LoadModule(ypath, "lib-dev")
+	fc.RequireEqual(t, nil, err)
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(lib, &nodeutil.Basic{}))
+	d.AddBrowser(node.NewBrowser(dev, &nodeutil.Basic{}))
+	moduleNameAsAddress := func(m *meta.Module) string {
+		return m.Ident()
+	}
+	ylib, err := parser.LoadModule(testdata.YangPath, "ietf-yang-library")
+	fc.RequireEqual(t, nil, err)
+	b := node.NewBrowser(ylib, device.LocalDeviceYangLibNode(moduleNameAsAddress, d))
+	actual, err := nodeutil.WriteJSON(sel(b.Root().Find("yang-library/module-set=all/module=lib")))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, `{"name":"lib","revision":"2024-01-01","namespace":"lib","location":["lib"],"submodule":[{"name":"lib-sub","revision":"2024-01-02","location":["lib-sub"]}],"feature":["fast"],"deviation":["lib-dev"]}`, actual)
+
+	actual, err = nodeutil.WriteJSON(sel(b.Root().Find("modules-state/module=lib,2024-01-01")))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, `{"name":"lib","revision":"2024-01-01","schema":"lib","namespace":"lib","feature":["fast"],"deviation":[{"name":"lib-dev","revision":"0"}],"conformance-type":"implement","submodule":[{"name":"lib-sub","revision":"2024-01-02","schema":"lib-sub"}]}`, actual)
+}
+
+func sel(s *node.Selection, err error) *node.Selection {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package restconf
+
+import (
+	"context"
+
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// DryRunParam is query parameter on PUT, PATCH, POST or DELETE to check an
+// edit would succeed without changing anything
+const DryRunParam = "fc.dry-run"
+
+type DryRunContextKeyType string
+
+var DryRunContextKey = DryRunContextKeyType("RESTCONF_DRY_RUN")
+
+// IsDryRun is true when edit is only being validated. Nodes that act on
+// changes in OnBeginEdit or OnEndEdit should check but not act.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(DryRunContextKey).(bool)
+	return dryRun
+}
+
+// dryRunNode lets edits walk the real node so values, constraints and the
+// node's own begin and end edit checks run, but writes, new items and deletes
+// never reach the node.
+func dryRunNode(n node.Node) node.Node {
+	return &nodeutil.Extend{
+		Base: n,
+		OnChild: func(p node.Node, r node.ChildRequest) (node.Node, error) {
+			if r.Delete {
+				return nil, nil
+			}
+			if r.New {
+				return shadowNode(), nil
+			}
+			child, err := p.Child(r)
+			if child == nil || err != nil {
+				return child, err
+			}
+			return dryRunNode(child), nil
+		},
+		OnNext: func(p node.Node, r node.ListRequest) (node.Node, []val.Value, error) {
+			if r.Delete {
+				return nil, nil, nil
+			}
+			if r.New {
+				return shadowNode(), r.Key, nil
+			}
+			child, key, err := p.Next(r)
+			if child == nil || err != nil {
+				return child, key, err
+			}
+			return dryRunNode(child), key, nil
+		},
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			if r.Write || r.Clear {
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+	}
+}
+
+// shadowNode stands in for data that would be created so nodes that attach
+// new items to live data on creation are never asked for them
+func shadowNode() node.Node {
+	return nodeutil.ReflectChild(make(map[string]interface{}))
+}
@@ -0,0 +1,79 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestDryRun(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin", Wingspan: 10},
+	}
+	var checked []bool
+	n := &nodeutil.Extend{
+		Base: testdata.BirdNode(birds),
+		OnEndEdit: func(p node.Node, r node.NodeRequest) error {
+			checked = append(checked, IsDryRun(r.Selection.Context))
+			return p.EndEdit(r)
+		},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), n))
+	s := NewServer(d)
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := request("PATCH", "/restconf/data/bird:bird=robin?fc.dry-run", `{"wingspan":12}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+	fc.AssertEqual(t, []bool{true}, checked)
+
+	code, _ = request("POST", "/restconf/data/bird:bird?fc.dry-run", `{"bird":[{"name":"owl","wingspan":3}]}`)
+	fc.AssertEqual(t, 201, code)
+	_, found := birds["owl"]
+	fc.AssertEqual(t, false, found)
+
+	code, _ = request("DELETE", "/restconf/data/bird:bird=robin?fc.dry-run", "")
+	fc.AssertEqual(t, 204, code)
+	_, found = birds["robin"]
+	fc.AssertEqual(t, true, found)
+
+	expectedCode, expected := request("PATCH", "/restconf/data/bird:bird=robin", `{"wingspan":"x"}`)
+	fc.AssertEqual(t, true, expectedCode >= 400)
+	code, actual := request("PATCH", "/restconf/data/bird:bird=robin?fc.dry-run", `{"wingspan":"x"}`)
+	fc.AssertEqual(t, expectedCode, code)
+	fc.AssertEqual(t, expected, actual)
+
+	t.Run("reflect", func(t *testing.T) {
+		app := struct {
+			Bird map[string]*testdata.Bird
+		}{
+			Bird: map[string]*testdata.Bird{"robin": {Name: "robin"}},
+		}
+		d := device.New(ypath)
+		d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), &nodeutil.Node{Object: &app}))
+		s := NewServer(d)
+		request := func(method string, url string, body string) int {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+			return w.Code
+		}
+		fc.AssertEqual(t, 201, request("POST", "/restconf/data/bird:bird?fc.dry-run", `{"bird":[{"name":"owl"}]}`))
+		fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/bird:bird=robin?fc.dry-run", `{"species":{"name":"thrush"}}`))
+		fc.AssertEqual(t, 1, len(app.Bird))
+		fc.AssertEqual(t, true, app.Bird["robin"].Species == nil)
+	})
+}
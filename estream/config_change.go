@@ -0,0 +1,28 @@
+package estream
+
+import (
+	"fmt"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+)
+
+// ConfigChangeStream is netconf-config-change notifications of
+// ietf-netconf-notifications on a device
+func ConfigChangeStream(d device.Device) Stream {
+	return Stream{
+		Name:        "netconf-config-change",
+		Description: "Every change to running config",
+		Open: func() (*node.Selection, error) {
+			b, err := d.Browser("ietf-netconf-notifications")
+			if err != nil {
+				return nil, err
+			}
+			if b == nil {
+				return nil, fmt.Errorf("%w. ietf-netconf-notifications", fc.NotFoundError)
+			}
+			return b.Root().Find("netconf-config-change")
+		},
+	}
+}
@@ -0,0 +1,297 @@
+package restconf
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// Downstream is implemented by devices that are remote RESTCONF servers so a
+// gateway can forward requests to them without parsing them.  Devices from
+// client package implement this.
+type Downstream interface {
+	// Example: https://host:port/restconf/
+	BaseAddress() string
+}
+
+// downstreamClient is optionally implemented by downstream devices that need
+// their own connections like call home devices
+type downstreamClient interface {
+	HttpClient() *http.Client
+}
+
+const DefaultGatewayTimeout = 30 * time.Second
+
+const DefaultMaxIdleConnsPerDevice = 8
+
+// Gateway forwards requests for restconf=[deviceId] to downstream devices as
+// is. Error responses from devices are returned to caller unaltered.  Only
+// devices that implement Downstream are forwarded, others are served like
+// any other device. Requests that authorization, auditing, edit hooks or
+// redaction of sensitive values need to see inside are also served like any
+// other device.
+type Gateway struct {
+	// Applies to all requests except subscriptions which stay open until
+	// caller or device closes them. Change with SetTimeout once gateway is
+	// in use.
+	Timeout time.Duration
+
+	// Optional: overrides Timeout for given devices
+	DeviceTimeouts map[string]time.Duration
+
+	// Pool of connections to downstream devices that do not have their own.
+	// Replace with SetTransport once gateway is in use.
+	Transport *http.Transport
+
+	mu sync.RWMutex
+}
+
+func NewGateway() *Gateway {
+	return &Gateway{
+		Timeout:        DefaultGatewayTimeout,
+		DeviceTimeouts: make(map[string]time.Duration),
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: DefaultMaxIdleConnsPerDevice,
+			IdleConnTimeout:     90 * time.Second,
+			ForceAttemptHTTP2:   true,
+			TLSClientConfig:     &tls.Config{},
+		},
+	}
+}
+
+// SetTimeout changes timeout of devices without their own timeout
+func (g *Gateway) SetTimeout(timeout time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Timeout = timeout
+}
+
+// DefaultTimeout is timeout of devices without their own timeout
+func (g *Gateway) DefaultTimeout() time.Duration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.Timeout
+}
+
+func (g *Gateway) SetDeviceTimeout(deviceId string, timeout time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if timeout == 0 {
+		delete(g.DeviceTimeouts, deviceId)
+	} else {
+		g.DeviceTimeouts[deviceId] = timeout
+	}
+}
+
+// SetTransport replaces pool of connections, connections of old pool are
+// closed once requests using them are done
+func (g *Gateway) SetTransport(t *http.Transport) {
+	g.mu.Lock()
+	old := g.Transport
+	g.Transport = t
+	g.mu.Unlock()
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+func (g *Gateway) transport() *http.Transport {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.Transport
+}
+
+func (g *Gateway) timeout(deviceId string) time.Duration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if t, found := g.DeviceTimeouts[deviceId]; found {
+		return t
+	}
+	return g.Timeout
+}
+
+// forward returns false if device cannot be forwarded to
+func (g *Gateway) forward(w http.ResponseWriter, r *http.Request, deviceId string, d device.Device, p *url.URL) bool {
+	downstream, valid := d.(Downstream)
+	if !valid {
+		return false
+	}
+	base, err := url.Parse(strings.TrimSuffix(downstream.BaseAddress(), "/"))
+	if err != nil {
+		fc.Err.Printf("bad address for device %s. %s", deviceId, err)
+		return false
+	}
+	transport := http.RoundTripper(g.transport())
+	if c, valid := d.(downstreamClient); valid && c.HttpClient() != nil && c.HttpClient().Transport != nil {
+		transport = c.HttpClient().Transport
+	}
+	ctx := r.Context()
+	if !isSubscription(r) {
+		if timeout := g.timeout(deviceId); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	// headers like CORS are set by downstream
+	hdr := w.Header()
+	proxy := &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(base)
+			pr.Out.URL.Path = base.Path + "/" + p.Path
+			pr.Out.URL.RawPath = base.EscapedPath() + "/" + p.EscapedPath()
+			pr.Out.URL.RawQuery = p.RawQuery
+			pr.SetXForwarded()
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for k := range resp.Header {
+				hdr.Del(k)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fc.Err.Printf("gateway to %s failed. %s", deviceId, err)
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			http.Error(w, fmt.Sprintf("device %s. %s", deviceId, http.StatusText(status)), status)
+		},
+	}
+	fc.Debug.Printf("forwarding to %s %s", deviceId, p.Path)
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+	return true
+}
+
+// canForward is true when nothing needs to see inside requests to device.
+// Locks only apply to main device so they never do.
+func (srv *Server) canForward(d device.Device) bool {
+	if srv.Auth != nil || srv.Audit != nil || len(srv.PreCommit) > 0 || len(srv.PostCommit) > 0 {
+		return false
+	}
+	for _, m := range d.Modules() {
+		if len(sensitiveIdents(m)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func isSubscription(r *http.Request) bool {
+	return r.Method == "GET" && strings.Contains(r.Header.Get("Accept"), string(TextStreamMimeType))
+}
+
+// GatewayNode uses gateway container in fc-restconf.yang
+func GatewayNode(g *Gateway) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "device":
+				return gatewayDevicesNode(g), nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "timeoutMs":
+				if r.Write {
+					g.SetTimeout(time.Duration(hnd.Val.Value().(int)) * time.Millisecond)
+				} else {
+					hnd.Val = val.Int32(g.DefaultTimeout().Milliseconds())
+				}
+			case "maxIdleConnsPerDevice":
+				if r.Write {
+					// live transport is shared by requests in flight
+					t := g.transport().Clone()
+					t.MaxIdleConnsPerHost = hnd.Val.Value().(int)
+					g.SetTransport(t)
+				} else {
+					hnd.Val = val.Int32(g.transport().MaxIdleConnsPerHost)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func gatewayDevicesNode(g *Gateway) node.Node {
+	g.mu.RLock()
+	ids := make([]string, 0, len(g.DeviceTimeouts))
+	for id := range g.DeviceTimeouts {
+		ids = append(ids, id)
+	}
+	g.mu.RUnlock()
+	sort.Strings(ids)
+	return &nodeutil.Basic{
+		OnNextItem: func(r node.ListRequest) nodeutil.BasicNextItem {
+			var id string
+			return nodeutil.BasicNextItem{
+				New: func() error {
+					id = r.Key[0].String()
+					g.SetDeviceTimeout(id, g.DefaultTimeout())
+					return nil
+				},
+				GetByKey: func() error {
+					id = r.Key[0].String()
+					g.mu.RLock()
+					if _, found := g.DeviceTimeouts[id]; !found {
+						id = ""
+					}
+					g.mu.RUnlock()
+					return nil
+				},
+				GetByRow: func() ([]val.Value, error) {
+					if r.Row >= len(ids) {
+						return nil, nil
+					}
+					id = ids[r.Row]
+					return []val.Value{val.String(id)}, nil
+				},
+				Node: func() (node.Node, error) {
+					if id == "" {
+						return nil, nil
+					}
+					return gatewayDeviceNode(g, id), nil
+				},
+				DeleteByKey: func() error {
+					g.SetDeviceTimeout(r.Key[0].String(), 0)
+					return nil
+				},
+			}
+		},
+	}
+}
+
+func gatewayDeviceNode(g *Gateway, deviceId string) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "deviceId":
+				hnd.Val = val.String(deviceId)
+			case "timeoutMs":
+				if r.Write {
+					g.SetDeviceTimeout(deviceId, time.Duration(hnd.Val.Value().(int))*time.Millisecond)
+				} else {
+					hnd.Val = val.Int32(g.timeout(deviceId).Milliseconds())
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,129 @@
+package restconf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/source"
+)
+
+type downstreamDevice struct {
+	*device.Local
+	base string
+}
+
+func (d downstreamDevice) BaseAddress() string {
+	return d.base
+}
+
+func TestGateway(t *testing.T) {
+	var mu sync.Mutex
+	var lastUrl string
+	var lastForwarded string
+	last := func() (string, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastUrl, lastForwarded
+	}
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastUrl = r.URL.String()
+		lastForwarded = r.Header.Get("X-Forwarded-For")
+		mu.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/restconf/data/slow:"):
+			time.Sleep(200 * time.Millisecond)
+		case strings.HasPrefix(r.URL.Path, "/restconf/data/bad:"):
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"ietf-restconf:errors":{"error":[{"error-tag":"data-exists"}]}}`))
+			return
+		}
+		w.Header().Set("Content-Type", string(YangDataJsonMimeType1))
+		w.Write([]byte(`{"x":"remote"}`))
+	}))
+	defer remote.Close()
+
+	ypath := source.Path("./yang:./yang/ietf-rfc")
+	devices := device.NewMap()
+	devices.Add("remote", downstreamDevice{Local: device.New(ypath), base: remote.URL + "/restconf/"})
+	devices.Add("local", device.New(ypath))
+	s := NewServer(device.New(ypath))
+	s.ServeDevices(devices)
+	s.Gateway = NewGateway()
+	s.Gateway.SetDeviceTimeout("remote", 100*time.Millisecond)
+
+	request := func(url string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w.Code, w.Body.String()
+	}
+
+	t.Run("passthrough", func(t *testing.T) {
+		code, body := request("/restconf=remote/data/x:a/b%2Fc?depth=1")
+		fc.AssertEqual(t, 200, code)
+		fc.AssertEqual(t, `{"x":"remote"}`, body)
+		url, forwarded := last()
+		fc.AssertEqual(t, "/restconf/data/x:a/b%2Fc?depth=1", url)
+		fc.AssertEqual(t, true, forwarded != "")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		code, body := request("/restconf=remote/data/bad:x")
+		fc.AssertEqual(t, 409, code)
+		fc.AssertEqual(t, `{"ietf-restconf:errors":{"error":[{"error-tag":"data-exists"}]}}`, body)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		code, _ := request("/restconf=remote/data/slow:x")
+		fc.AssertEqual(t, 504, code)
+	})
+
+	t.Run("yang-library", func(t *testing.T) {
+		code, body := request("/restconf=remote/data/ietf-yang-library:")
+		fc.AssertEqual(t, 200, code)
+		fc.AssertEqual(t, `{"x":"remote"}`, body)
+		url, _ := last()
+		fc.AssertEqual(t, "/restconf/data/ietf-yang-library:", url)
+
+		code, body = request("/restconf=local/data/ietf-yang-library:")
+		fc.AssertEqual(t, 200, code)
+		fc.AssertEqual(t, true, strings.Contains(body, "yang-library"))
+	})
+
+	t.Run("authorized", func(t *testing.T) {
+		s.Auth = secure.NewRbac()
+		defer func() {
+			s.Auth = nil
+		}()
+		before, _ := last()
+		code, body := request("/restconf=remote/data/ietf-yang-library:")
+		fc.AssertEqual(t, 200, code)
+		fc.AssertEqual(t, "{}", body)
+		after, _ := last()
+		fc.AssertEqual(t, before, after)
+	})
+
+	t.Run("transport", func(t *testing.T) {
+		live := s.Gateway.transport()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("PATCH", "/restconf/data/fc-restconf:gateway", strings.NewReader(`{"maxIdleConnsPerDevice":2}`)))
+		fc.RequireEqual(t, 204, w.Code)
+		fc.AssertEqual(t, DefaultMaxIdleConnsPerDevice, live.MaxIdleConnsPerHost)
+		fc.AssertEqual(t, 2, s.Gateway.transport().MaxIdleConnsPerHost)
+		code, _ := request("/restconf=remote/data/x:a")
+		fc.AssertEqual(t, 200, code)
+	})
+
+	t.Run("down", func(t *testing.T) {
+		remote.Close()
+		code, _ := request("/restconf=remote/data/x:")
+		fc.AssertEqual(t, 502, code)
+	})
+}
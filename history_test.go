@@ -0,0 +1,51 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestHistory(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"history": map[string]interface{}{},
+		},
+		"bird": map[string]interface{}{
+			"bird": []interface{}{
+				map[string]interface{}{"name": "robin"},
+			},
+		},
+	}))
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := request("PATCH", "/restconf/data/bird:bird=robin", `{"wingspan":10}`)
+	fc.AssertEqual(t, 204, code)
+	_, body := request("GET", "/restconf/data/fc-restconf:history/revision?fields=id%3Bcomment", "")
+	fc.AssertEqual(t, `{"revision":[{"id":2},{"id":1,"comment":"startup"}]}`, body)
+
+	_, body = request("POST", "/restconf/data/fc-restconf:history/compare", `{"from":1}`)
+	fc.AssertEqual(t, `{"edit":[{"target":"/bird:bird[name='robin']/wingspan","operation":"replace","before":"0","after":"10"}]}`, body)
+
+	code, _ = request("POST", "/restconf/data/fc-restconf:history/rollback", `{"revision":1}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 0, birds["robin"].Wingspan)
+	_, body = request("GET", "/restconf/data/fc-restconf:history/revision=3/comment", "")
+	fc.AssertEqual(t, `{"comment":"rollback to revision 1"}`, body)
+}
@@ -0,0 +1,295 @@
+package restconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// Edit is a PUT, PATCH, POST or DELETE of config as hooks see it. Commits,
+// rollbacks and resets of main device config are a PUT of each module that
+// changes.
+type Edit struct {
+	Context  context.Context
+	User     string
+	DeviceId string
+	Method   string
+
+	// Edit is only checked and will not be committed. Only pre-commit hooks
+	// see these.
+	DryRun bool
+
+	// Target of edit as data resource e.g. bird:bird=robin
+	Path string
+
+	// Config of target before and after edit, nil when there is none
+	Old map[string]interface{}
+	New map[string]interface{}
+}
+
+// EditHook sees every edit to any module. Pre-commit hooks veto an edit by
+// returning an error, ideally an EditVetoError. Errors from post-commit hooks
+// do not undo edit.
+type EditHook func(e Edit) error
+
+// EditVetoError is how pre-commit hooks reject an edit
+type EditVetoError struct {
+	// Where problem is, defaults to target of edit
+	Path string
+
+	// Machine readable reason e.g. speed-limit-exceeded
+	AppTag string
+
+	Message string
+}
+
+func (e *EditVetoError) Error() string {
+	return fmt.Sprintf("%s. %s", fc.BadRequestError, e.Message)
+}
+
+func (e *EditVetoError) Unwrap() error {
+	return fc.BadRequestError
+}
+
+// runPreCommit works out what target will look like after edit and gives
+// pre-commit hooks a chance to veto it. Target is nil when PUT creates it.
+func (hndlr *browserHandler) runPreCommit(ctx context.Context, r *http.Request, target *node.Selection) (*Edit, error) {
+	e := &Edit{
+		Context:  ctx,
+		User:     secure.User(ctx),
+		DeviceId: hndlr.deviceId,
+		Method:   r.Method,
+		Path:     hndlr.browser.Meta.Ident() + ":" + r.URL.EscapedPath(),
+	}
+	e.DryRun, _ = ctx.Value(DryRunContextKey).(bool)
+	var err error
+	if target != nil {
+		if e.Old, err = readConfigJSON(target); err != nil {
+			return nil, err
+		}
+	}
+	if e.New, err = hndlr.previewEdit(ctx, r); err != nil {
+		return nil, err
+	}
+	for _, h := range hndlr.preCommit {
+		if err = h(*e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// runPostCommit tells post-commit hooks about an edit. Failures are returned
+// but cannot undo edit.
+func runPostCommit(hooks []EditHook, e Edit) error {
+	var errs []error
+	for _, h := range hooks {
+		if err := h(e); err != nil {
+			fc.Err.Printf("post-commit hook failed on %s. %s", e.Path, err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("edit committed but post-commit hook failed. %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// replaceEdit is commit, rollback or reset of module config of main device
+// as hooks see it
+func replaceEdit(user string, module string, old map[string]interface{}, new map[string]interface{}) Edit {
+	return Edit{
+		Context: context.Background(),
+		User:    user,
+		Method:  "PUT",
+		Path:    module + ":",
+		Old:     old,
+		New:     new,
+	}
+}
+
+func (srv *Server) preReplace(user string, module string, old map[string]interface{}, new map[string]interface{}) error {
+	e := replaceEdit(user, module, old, new)
+	for _, h := range srv.PreCommit {
+		if err := h(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (srv *Server) postReplace(user string, module string, old map[string]interface{}, new map[string]interface{}) error {
+	return runPostCommit(srv.PostCommit, replaceEdit(user, module, old, new))
+}
+
+// previewEdit applies edit to a copy of target subtree and returns what target
+// would be after it
+func (hndlr *browserHandler) previewEdit(ctx context.Context, r *http.Request) (map[string]interface{}, error) {
+	path := r.URL.EscapedPath()
+	if r.Method == "DELETE" {
+		return nil, nil
+	}
+	shadow, seg, err := hndlr.previewScope(ctx, r, path)
+	if err != nil {
+		return nil, err
+	}
+	var sel *node.Selection
+	create := false
+	if seg == "" {
+		sel = shadow
+	} else if sel, err = shadow.Find(seg); err != nil {
+		return nil, err
+	}
+	if sel == nil && r.Method == "PUT" {
+		// scope has nothing else in it to conflict with
+		create = true
+		sel = shadow
+	}
+	if sel == nil {
+		return nil, fmt.Errorf("%w. %s", fc.NotFoundError, path)
+	}
+	var input node.Node
+	var body []byte
+	if r.Method == "POST" {
+		body, err = previewBody(r)
+	} else {
+		input, err = previewInput(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case "PATCH":
+		err = sel.UpsertFrom(input)
+	case "PUT":
+		if create {
+			err = sel.InsertFrom(input)
+		} else {
+			err = sel.ReplaceFrom(input)
+		}
+	case "POST":
+		err = postInsert(sel, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if seg != "" {
+		if sel, err = shadow.Find(seg); err != nil || sel == nil {
+			return nil, err
+		}
+	}
+	return readConfigJSON(sel)
+}
+
+// previewScope is copy of just the config of target at path, and of nothing
+// else, grafted where target's parent is along with path to target relative
+// to it. Whole module when target is module itself.
+func (hndlr *browserHandler) previewScope(ctx context.Context, r *http.Request, path string) (*node.Selection, string, error) {
+	root, err := hndlr.browser.RootWithContext(ctx).Constrain("content=config")
+	if err != nil {
+		return nil, "", err
+	}
+	if path == "" {
+		config, err := readConfigJSON(root)
+		if err != nil {
+			return nil, "", err
+		}
+		if config == nil {
+			config = make(map[string]interface{})
+		}
+		return root.Split(nodeutil.ReflectChild(config)), "", nil
+	}
+	seg := path
+	if slash := strings.LastIndex(path, "/"); slash >= 0 {
+		seg = path[slash+1:]
+	}
+	ident, _, isListEntry := strings.Cut(seg, "=")
+	if _, local, qualified := strings.Cut(ident, ":"); qualified {
+		ident = local
+	}
+	target, err := root.Find(path)
+	if err != nil {
+		return nil, "", err
+	}
+	config := make(map[string]interface{})
+	var parent *node.Selection
+	if target != nil {
+		defer target.Release()
+		data, err := readConfigJSON(target)
+		if err != nil {
+			return nil, "", err
+		}
+		switch {
+		case isListEntry:
+			config[ident] = []interface{}{data}
+			parent = target.Parent().Parent()
+		case len(target.Key()) == 0 && meta.IsList(target.Meta()):
+			// already has list in it
+			config = data
+			parent = target.Parent()
+		default:
+			config[ident] = data
+			parent = target.Parent()
+		}
+	} else if r.Method == "PUT" {
+		var created meta.Definition
+		if parent, created, err = findCreateParent(root, path); err != nil || parent == nil {
+			return nil, "", err
+		}
+		defer parent.Release()
+		if created == parent.Meta() {
+			// new entry of list
+			parent = parent.Parent()
+		}
+	}
+	if parent == nil {
+		return nil, "", fmt.Errorf("%w. %s", fc.NotFoundError, path)
+	}
+	return parent.Split(nodeutil.ReflectChild(config)), seg, nil
+}
+
+// previewInput reads request body leaving it to be read again for the edit
+func previewInput(r *http.Request) (node.Node, error) {
+	body, err := previewBody(r)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}()
+	return requestNode(r, MimeType(r.Header.Get("Content-Type")))
+}
+
+// previewBody reads request body leaving it to be read again
+func previewBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+func readConfigJSON(sel *node.Selection) (map[string]interface{}, error) {
+	cfg, err := sel.Constrain("content=config")
+	if err != nil {
+		return nil, err
+	}
+	data, err := nodeutil.WriteJSON(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err = json.Unmarshal([]byte(data), &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
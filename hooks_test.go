@@ -0,0 +1,177 @@
+package restconf
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestEditHooks(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin", Wingspan: 5},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	var pre, post []Edit
+	s.PreCommit = append(s.PreCommit, func(e Edit) error {
+		pre = append(pre, e)
+		if e.New != nil && e.New["wingspan"].(float64) > 100 {
+			return &EditVetoError{AppTag: "wingspan-limit", Message: "wingspan may not exceed 100"}
+		}
+		return nil
+	})
+	s.PostCommit = append(s.PostCommit, func(e Edit) error {
+		post = append(post, e)
+		return nil
+	})
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Content-Type", string(YangDataJsonMimeType1))
+		s.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	code, _ := request("PATCH", "/restconf/data/bird:bird=robin", `{"bird:wingspan":10}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+	fc.RequireEqual(t, 1, len(post))
+	fc.AssertEqual(t, "bird:bird=robin", post[0].Path)
+	fc.AssertEqual(t, "PATCH", post[0].Method)
+	fc.AssertEqual(t, float64(5), post[0].Old["wingspan"])
+	fc.AssertEqual(t, float64(10), post[0].New["wingspan"])
+
+	code, body := request("PATCH", "/restconf/data/bird:bird=robin", `{"bird:wingspan":200}`)
+	fc.AssertEqual(t, 400, code)
+	fc.AssertEqual(t, true, strings.Contains(body, `"error-app-tag":"wingspan-limit"`))
+	fc.AssertEqual(t, true, strings.Contains(body, `wingspan may not exceed 100`))
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+	fc.AssertEqual(t, 1, len(post))
+
+	code, _ = request("DELETE", "/restconf/data/bird:bird=robin?fc.dry-run", "")
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 3, len(pre))
+	fc.AssertEqual(t, true, pre[2].New == nil)
+	fc.AssertEqual(t, 1, len(post))
+}
+
+func TestEditHooksPreview(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin", Wingspan: 5},
+		"owl":   {Name: "owl", Wingspan: 20},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	var pre []Edit
+	s.PreCommit = append(s.PreCommit, func(e Edit) error {
+		pre = append(pre, e)
+		return nil
+	})
+	failPost := false
+	s.PostCommit = append(s.PostCommit, func(e Edit) error {
+		if failPost {
+			return errors.New("mail server down")
+		}
+		return nil
+	})
+	request := func(method string, url string, body string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code
+	}
+
+	fc.AssertEqual(t, 204, request("PATCH", "/restconf/data/bird:bird=robin?fc.dry-run", `{"wingspan":6}`))
+	fc.RequireEqual(t, 1, len(pre))
+	fc.AssertEqual(t, true, pre[0].DryRun)
+	fc.AssertEqual(t, map[string]interface{}{"name": "robin", "wingspan": float64(6)}, pre[0].New)
+	fc.AssertEqual(t, 5, birds["robin"].Wingspan)
+
+	fc.AssertEqual(t, 204, request("PUT", "/restconf/data/bird:bird=robin", `{"bird":[{"name":"robin","wingspan":7}]}`))
+	fc.AssertEqual(t, false, pre[1].DryRun)
+	fc.AssertEqual(t, map[string]interface{}{"name": "robin", "wingspan": float64(7)}, pre[1].New)
+
+	fc.AssertEqual(t, 201, request("PUT", "/restconf/data/bird:bird=hawk", `{"bird":[{"name":"hawk","wingspan":30}]}`))
+	fc.AssertEqual(t, true, pre[2].Old == nil)
+	fc.AssertEqual(t, map[string]interface{}{"name": "hawk", "wingspan": float64(30)}, pre[2].New)
+
+	fc.AssertEqual(t, 201, request("POST", "/restconf/data/bird:bird", `{"bird":[{"name":"jay"}]}`))
+	fc.AssertEqual(t, 4, len(pre[3].New["bird"].([]interface{})))
+
+	failPost = true
+	fc.AssertEqual(t, 500, request("PATCH", "/restconf/data/bird:bird=robin", `{"wingspan":8}`))
+	fc.AssertEqual(t, 8, birds["robin"].Wingspan)
+}
+
+func TestCommitHooks(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{"robin": {Name: "robin"}}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"candidate": map[string]interface{}{},
+			"history":   map[string]interface{}{},
+		},
+	}))
+	names := func(config map[string]interface{}) []string {
+		var found []string
+		rows, _ := config["bird"].([]interface{})
+		for _, row := range rows {
+			found = append(found, row.(map[string]interface{})["name"].(string))
+		}
+		return found
+	}
+	var post []Edit
+	s.PreCommit = append(s.PreCommit, func(e Edit) error {
+		for _, name := range names(e.New) {
+			if name == "eagle" {
+				return &EditVetoError{Message: "no eagles"}
+			}
+		}
+		return nil
+	})
+	s.PostCommit = append(s.PostCommit, func(e Edit) error {
+		if e.Path == "bird:" {
+			post = append(post, e)
+		}
+		return nil
+	})
+	request := func(method string, url string, body string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code
+	}
+
+	fc.AssertEqual(t, 201, request("POST", "/restconf/ds/ietf-datastores:candidate/bird:bird", `{"bird":[{"name":"owl"}]}`))
+	fc.AssertEqual(t, 204, request("POST", "/restconf/operations/fc-restconf:commit", ""))
+	fc.RequireEqual(t, 1, len(post))
+	fc.AssertEqual(t, "PUT", post[0].Method)
+	fc.AssertEqual(t, []string{"robin"}, names(post[0].Old))
+	fc.AssertEqual(t, []string{"robin", "owl"}, names(post[0].New))
+
+	fc.AssertEqual(t, 201, request("POST", "/restconf/ds/ietf-datastores:candidate/bird:bird", `{"bird":[{"name":"eagle"}]}`))
+	fc.AssertEqual(t, 400, request("POST", "/restconf/operations/fc-restconf:commit", ""))
+	_, applied := birds["eagle"]
+	fc.AssertEqual(t, false, applied)
+	fc.AssertEqual(t, 1, len(post))
+	fc.AssertEqual(t, 204, request("POST", "/restconf/operations/fc-restconf:discardChanges", ""))
+
+	fc.AssertEqual(t, 204, request("POST", "/restconf/data/fc-restconf:history/rollback", `{"revision":1}`))
+	fc.RequireEqual(t, 2, len(post))
+	fc.AssertEqual(t, []string{"robin"}, names(post[1].New))
+	_, applied = birds["owl"]
+	fc.AssertEqual(t, false, applied)
+}
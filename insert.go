@@ -0,0 +1,264 @@
+package restconf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/val"
+)
+
+// InsertParam and PointParam are query parameters on POST and PUT to say where
+// a new entry goes in an ordered-by user list or leaf-list. See RFC8040 4.8.5
+// and 4.8.6
+const (
+	InsertParam = "insert"
+	PointParam  = "point"
+)
+
+type InsertContextKeyType string
+
+var InsertContextKey = InsertContextKeyType("RESTCONF_INSERT")
+
+// Insert is where new entry of an ordered-by user list or leaf-list goes
+type Insert struct {
+	// first, last, before or after
+	Where string
+
+	// Data resource of entry to go before or after e.g. /bird:bird=robin
+	Point string
+
+	// Key of entry at Point or value for leaf-lists. Set by server for nodes
+	PointKey []val.Value
+}
+
+// WithInsert is how clients ask for entries they create to be put in a
+// position
+func WithInsert(ctx context.Context, ins Insert) context.Context {
+	return context.WithValue(ctx, InsertContextKey, &ins)
+}
+
+// InsertPosition is where request wants new entry of target list to go. Nodes
+// of ordered-by user lists should check this when creating entries in OnNext
+// and nodes of ordered-by user leaf-lists when writing them in OnField. Server
+// rejects list edits with 400 when entry does not end up where asked.
+func InsertPosition(ctx context.Context) (Insert, bool) {
+	ins, found := ctx.Value(InsertContextKey).(*Insert)
+	if !found || ins == nil {
+		return Insert{}, false
+	}
+	return *ins, true
+}
+
+// Query is insert as query parameters
+func (ins Insert) Query() string {
+	q := url.Values{}
+	q.Set(InsertParam, ins.Where)
+	if ins.Point != "" {
+		q.Set(PointParam, ins.Point)
+	}
+	return q.Encode()
+}
+
+var errBadInsert = fmt.Errorf("%w. %s", fc.BadRequestError, InsertParam)
+
+// readInsert is insert from query parameters or nil when there are none. It
+// goes into context before edit selections are made so even PUT, which
+// recreates entry from the list, sees it.
+func readInsert(r *http.Request) *Insert {
+	q := r.URL.Query()
+	where, hasInsert := q[InsertParam]
+	point, hasPoint := q[PointParam]
+	if !hasInsert && !hasPoint {
+		return nil
+	}
+	ins := &Insert{}
+	if hasInsert {
+		ins.Where = where[0]
+	}
+	if hasPoint {
+		ins.Point = point[0]
+	}
+	return ins
+}
+
+// checkInsert validates insert against definition of list or leaf-list entry
+// goes into and finds key of point
+func (hndlr *browserHandler) checkInsert(r *http.Request, ctx context.Context, m meta.Meta, ins *Insert) error {
+	if r.Method != "POST" && r.Method != "PUT" {
+		return fmt.Errorf("%w only allowed on POST and PUT", errBadInsert)
+	}
+	if ins.Where == "" {
+		return fmt.Errorf("%w. %s requires %s", fc.BadRequestError, PointParam, InsertParam)
+	}
+	ordered, valid := m.(meta.HasOrderedBy)
+	if !valid || ordered.OrderedBy() != meta.OrderedByUser {
+		return fmt.Errorf("%w only allowed on ordered-by user lists and leaf-lists", errBadInsert)
+	}
+	switch ins.Where {
+	case "first", "last":
+		if ins.Point != "" {
+			return fmt.Errorf("%w. %s only allowed when %s is before or after", fc.BadRequestError, PointParam, InsertParam)
+		}
+	case "before", "after":
+		if ins.Point == "" {
+			return fmt.Errorf("%w. %s %s requires %s", fc.BadRequestError, InsertParam, ins.Where, PointParam)
+		}
+		var err error
+		if ins.PointKey, err = hndlr.findPoint(ctx, m.(meta.Definition), ins.Point); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w must be first, last, before or after not '%s'", errBadInsert, ins.Where)
+	}
+	return nil
+}
+
+// findPoint is key of existing entry in same list or leaf-list as target
+func (hndlr *browserHandler) findPoint(ctx context.Context, list meta.Definition, point string) ([]val.Value, error) {
+	module, path, _ := strings.Cut(strings.TrimPrefix(point, "/"), ":")
+	if module != hndlr.browser.Meta.Ident() {
+		return nil, fmt.Errorf("%w. %s %s not in module %s", fc.BadRequestError, PointParam, point, hndlr.browser.Meta.Ident())
+	}
+	if leafList, isLeafList := list.(*meta.LeafList); isLeafList {
+		return hndlr.findLeafListPoint(ctx, leafList, point, path)
+	}
+	sel, err := hndlr.browser.RootWithContext(ctx).Find(path)
+	if err != nil {
+		return nil, err
+	}
+	if sel == nil {
+		return nil, fmt.Errorf("%w. %s %s not found", fc.BadRequestError, PointParam, point)
+	}
+	defer sel.Release()
+	if sel.Meta() != list || len(sel.Key()) == 0 {
+		return nil, fmt.Errorf("%w. %s %s is not an entry of %s", fc.BadRequestError, PointParam, point, list.Ident())
+	}
+	return sel.Key(), nil
+}
+
+// findLeafListPoint is existing value in leaf-list at point e.g.
+// /q:queue/tag=rock
+func (hndlr *browserHandler) findLeafListPoint(ctx context.Context, leafList *meta.LeafList, point string, path string) ([]val.Value, error) {
+	notFound := fmt.Errorf("%w. %s %s not found in %s", fc.BadRequestError, PointParam, point, leafList.Ident())
+	eq := strings.LastIndex(path, "=")
+	if eq < 0 {
+		return nil, notFound
+	}
+	parentPath, ident := "", path[:eq]
+	if slash := strings.LastIndex(ident, "/"); slash >= 0 {
+		parentPath, ident = ident[:slash], ident[slash+1:]
+	}
+	value, err := url.PathUnescape(path[eq+1:])
+	if err != nil || ident != leafList.Ident() {
+		return nil, notFound
+	}
+	sel := hndlr.browser.RootWithContext(ctx)
+	if parentPath != "" {
+		if sel, err = sel.Find(parentPath); err != nil {
+			return nil, err
+		}
+		if sel == nil {
+			return nil, notFound
+		}
+		defer sel.Release()
+	}
+	if sel.Meta() != leafList.Parent() {
+		return nil, notFound
+	}
+	existing, err := sel.GetValue(ident)
+	if err != nil {
+		return nil, err
+	}
+	if items, valid := existing.(val.Listable); valid {
+		for i := 0; i < items.Len(); i++ {
+			if items.Item(i).String() == value {
+				return []val.Value{items.Item(i)}, nil
+			}
+		}
+	}
+	return nil, notFound
+}
+
+// checkPlaced verifies entry of ordered-by user list at path went where insert
+// asked as nodes that do not check InsertPosition, like reflection, put new
+// entries at the end. Entry is removed again when it was created by request.
+func checkPlaced(root *node.Selection, path string, ins *Insert, created bool) error {
+	slash := strings.LastIndex(path, "/")
+	listPath, key, isEntry := strings.Cut(path[slash+1:], "=")
+	if !isEntry {
+		return nil
+	}
+	listPath = strings.TrimPrefix(path[:slash+1]+listPath, "/")
+	list, err := root.Find(listPath)
+	if err != nil || list == nil {
+		return err
+	}
+	defer list.Release()
+	if _, isList := list.Meta().(*meta.List); !isList {
+		return nil
+	}
+	var keys []string
+	li, err := list.First()
+	for ; err == nil && li.Selection != nil; li, err = li.Next() {
+		keys = append(keys, entryKey(li.Key))
+		li.Selection.Release()
+	}
+	if err != nil {
+		return err
+	}
+	if placed(keys, key, ins) {
+		return nil
+	}
+	if created {
+		entry, err := root.Find(listPath + "=" + key)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			defer entry.Release()
+			if err := entry.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("%w %s not supported by %s", errBadInsert, ins.Where, list.Meta().Ident())
+}
+
+// placed is whether key is where insert asks in list of keys
+func placed(keys []string, key string, ins *Insert) bool {
+	at := -1
+	for i, candidate := range keys {
+		if candidate == key {
+			at = i
+		}
+	}
+	if at < 0 {
+		return true
+	}
+	switch ins.Where {
+	case "first":
+		return at == 0
+	case "last":
+		return at == len(keys)-1
+	case "before":
+		return at+1 < len(keys) && keys[at+1] == entryKey(ins.PointKey)
+	case "after":
+		return at > 0 && keys[at-1] == entryKey(ins.PointKey)
+	}
+	return true
+}
+
+// entryKey is key in form of RFC8040 3.5.3 without leading = e.g. a%2Cb,c
+func entryKey(key []val.Value) string {
+	parts := make([]string, len(key))
+	for i, k := range key {
+		parts[i] = strings.ReplaceAll(url.PathEscape(k.String()), ",", "%2C")
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,244 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+	"github.com/freeconf/yang/val"
+)
+
+// queueNode puts new songs and tags where request asks
+func queueNode(songs *[]string, tags *[]string) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			return queueNode(songs, tags), nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			if !r.Write {
+				if len(*tags) > 0 {
+					hnd.Val = val.StringList(*tags)
+				}
+				return nil
+			}
+			posted := hnd.Val.Value().([]string)
+			ins, found := InsertPosition(r.Selection.Context)
+			if !found {
+				*tags = posted
+				return nil
+			}
+			at := len(*tags)
+			switch ins.Where {
+			case "first":
+				at = 0
+			case "before", "after":
+				for i, candidate := range *tags {
+					if candidate == ins.PointKey[0].String() {
+						at = i
+						if ins.Where == "after" {
+							at++
+						}
+					}
+				}
+			}
+			*tags = append((*tags)[:at], append(posted, (*tags)[at:]...)...)
+			return nil
+		},
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			key := r.Key
+			pos := -1
+			if key != nil {
+				for i, candidate := range *songs {
+					if candidate == key[0].String() {
+						pos = i
+					}
+				}
+			} else if r.Row < len(*songs) {
+				pos = r.Row
+				key = []val.Value{val.String((*songs)[pos])}
+			}
+			switch {
+			case r.Delete:
+				*songs = append((*songs)[:pos], (*songs)[pos+1:]...)
+				return nil, nil, nil
+			case r.New:
+				at := len(*songs)
+				if ins, found := InsertPosition(r.Selection.Context); found {
+					switch ins.Where {
+					case "first":
+						at = 0
+					case "before", "after":
+						for i, candidate := range *songs {
+							if candidate == ins.PointKey[0].String() {
+								at = i
+								if ins.Where == "after" {
+									at++
+								}
+							}
+						}
+					}
+				}
+				*songs = append((*songs)[:at], append([]string{key[0].String()}, (*songs)[at:]...)...)
+			case pos < 0:
+				return nil, nil, nil
+			}
+			return &nodeutil.Basic{
+				OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+					if !r.Write {
+						hnd.Val = key[0]
+					}
+					return nil
+				},
+			}, key, nil
+		},
+	}
+}
+
+func TestInsert(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(nil, `module q {namespace ""; prefix ""; revision 0;
+		container queue {
+			list song {
+				key name;
+				ordered-by user;
+				leaf name {
+					type string;
+				}
+			}
+			leaf-list tag {
+				type string;
+				ordered-by user;
+			}
+			leaf-list genre {
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	songs := []string{"a", "b"}
+	tags := []string{"x", "y"}
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin"},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(m, queueNode(&songs, &tags)))
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	request := func(method string, url string, body string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code
+	}
+
+	code := request("POST", "/restconf/data/q:queue/song?insert=first", `{"song":[{"name":"c"}]}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, []string{"c", "a", "b"}, songs)
+
+	code = request("POST", "/restconf/data/q:queue/song?insert=after&point=%2Fq%3Aqueue%2Fsong%3Da", `{"song":[{"name":"d"}]}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, []string{"c", "a", "d", "b"}, songs)
+
+	code = request("PUT", "/restconf/data/q:queue/song=b?insert=before&point=/q:queue/song=c", `{"song":[{"name":"b"}]}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, []string{"b", "c", "a", "d"}, songs)
+
+	code = request("POST", "/restconf/data/q:queue/song?insert=last", `{"song":[{"name":"e"}]}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, []string{"b", "c", "a", "d", "e"}, songs)
+
+	t.Run("parent target", func(t *testing.T) {
+		code := request("POST", "/restconf/data/q:queue?insert=first", `{"q:song":[{"name":"f"}]}`)
+		fc.AssertEqual(t, 201, code)
+		fc.AssertEqual(t, []string{"f", "b", "c", "a", "d", "e"}, songs)
+
+		code = request("POST", "/restconf/data/q:queue?insert=before&point=/q:queue/song=a", `{"q:song":[{"name":"g"}]}`)
+		fc.AssertEqual(t, 201, code)
+		fc.AssertEqual(t, []string{"f", "b", "c", "g", "a", "d", "e"}, songs)
+	})
+
+	t.Run("leaf-list", func(t *testing.T) {
+		code := request("POST", "/restconf/data/q:queue?insert=first", `{"tag":["w"]}`)
+		fc.AssertEqual(t, 201, code)
+		fc.AssertEqual(t, []string{"w", "x", "y"}, tags)
+
+		code = request("POST", "/restconf/data/q:queue?insert=after&point=/q:queue/tag=x", `{"tag":["z"]}`)
+		fc.AssertEqual(t, 201, code)
+		fc.AssertEqual(t, []string{"w", "x", "z", "y"}, tags)
+
+		code = request("POST", "/restconf/data/q:queue?insert=after&point=/q:queue/tag=nope", `{"tag":["z"]}`)
+		fc.AssertEqual(t, 400, code)
+		code = request("POST", "/restconf/data/q:queue?insert=first", `{"genre":["pop"]}`)
+		fc.AssertEqual(t, 400, code)
+		fc.AssertEqual(t, []string{"w", "x", "z", "y"}, tags)
+	})
+	songs = []string{"b", "c", "a", "d", "e"}
+
+	bad := []string{
+		"POST /restconf/data/q:queue/song?insert=middle",
+		"POST /restconf/data/q:queue/song?insert=before",
+		"POST /restconf/data/q:queue/song?insert=first&point=/q:queue/song=a",
+		"POST /restconf/data/q:queue/song?point=/q:queue/song=a",
+		"POST /restconf/data/q:queue/song?insert=after&point=/q:queue/song=x",
+		"PATCH /restconf/data/q:queue/song=a?insert=first",
+		"POST /restconf/data/bird:bird?insert=first",
+	}
+	for _, req := range bad {
+		method, url, _ := strings.Cut(req, " ")
+		fc.AssertEqual(t, 400, request(method, url, `{"song":[{"name":"f"}]}`), req)
+	}
+	fc.AssertEqual(t, []string{"b", "c", "a", "d", "e"}, songs)
+
+	ins := Insert{Where: "before", Point: "/q:queue/song=a"}
+	fc.AssertEqual(t, "insert=before&point=%2Fq%3Aqueue%2Fsong%3Da", ins.Query())
+}
+
+func TestInsertNotHonored(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(nil, `module q {namespace ""; prefix ""; revision 0;
+		list song {
+			key name;
+			ordered-by user;
+			leaf name {
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	data := map[string]interface{}{
+		"song": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b"},
+		},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(m, nodeutil.ReflectChild(data)))
+	s := NewServer(d)
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+	songs := func() string {
+		_, body := request("GET", "/restconf/data/q:song?fields=name", "")
+		return body
+	}
+
+	code, _ := request("POST", "/restconf/data/q:song?insert=first", `{"song":[{"name":"c"}]}`)
+	fc.AssertEqual(t, 400, code)
+	code, _ = request("PUT", "/restconf/data/q:song=c?insert=before&point=/q:song=a", `{"song":[{"name":"c"}]}`)
+	fc.AssertEqual(t, 400, code)
+	fc.AssertEqual(t, `{"song":[{"name":"a"},{"name":"b"}]}`, songs())
+
+	code, _ = request("POST", "/restconf/data/q:song?insert=after&point=/q:song=b", `{"song":[{"name":"c"}]}`)
+	fc.AssertEqual(t, 201, code)
+	code, _ = request("POST", "/restconf/data/q:?insert=last", `{"song":[{"name":"d"}]}`)
+	fc.AssertEqual(t, 201, code)
+	fc.AssertEqual(t, `{"song":[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d"}]}`, songs())
+}
@@ -0,0 +1,191 @@
+package restconf
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/val"
+)
+
+// SessionKey is connection request came in on as remote address and port. Locks
+// of anonymous users are released when this connection closes.
+var SessionKey = ProxyContextKey("FC_SESSION")
+
+func lockOwner(ctx context.Context) device.LockOwner {
+	session, _ := ctx.Value(SessionKey).(string)
+	return device.LockOwner{
+		User:    secure.User(ctx),
+		Session: session,
+	}
+}
+
+// locks of main device or nil if not enabled
+func (srv *Server) locks() *device.Locks {
+	if local, valid := srv.main.(*device.Local); valid {
+		return local.Locks()
+	}
+	return nil
+}
+
+func (srv *Server) isCandidate(d device.Device) bool {
+	if local, valid := srv.main.(*device.Local); valid {
+		if c := local.Candidate(); c != nil {
+			return d == device.Device(c)
+		}
+	}
+	return false
+}
+
+func (srv *Server) connClosed(conn net.Conn) {
+	if l := srv.locks(); l != nil {
+		l.ReleaseSession(conn.RemoteAddr().String())
+	}
+}
+
+func locksNode(l *device.Locks) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "lock":
+				return heldLocksNode(l.Held()), nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "timeoutMs":
+				if r.Write {
+					l.SetTimeout(time.Duration(hnd.Val.Value().(int)) * time.Millisecond)
+				} else {
+					hnd.Val = val.Int32(l.DefaultTimeout().Milliseconds())
+				}
+			}
+			return nil
+		},
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			owner := lockOwner(r.Selection.Context)
+			switch r.Meta.Ident() {
+			case "lockDatastore":
+				var timeout time.Duration
+				if r.Input != nil {
+					if v, err := r.Input.GetValue("timeoutMs"); err != nil {
+						return nil, err
+					} else if v != nil {
+						timeout = time.Duration(v.Value().(int)) * time.Millisecond
+					}
+				}
+				lock, err := l.Lock(owner, timeout)
+				if err != nil {
+					return nil, err
+				}
+				return lockOutputNode(lock), nil
+			case "unlock":
+				id, err := r.Input.GetValue("id")
+				if err != nil {
+					return nil, err
+				}
+				return nil, l.Unlock(owner, uint32(id.Value().(uint)))
+			}
+			return nil, nil
+		},
+	}
+}
+
+func heldLocksNode(held []*device.Lock) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var lock *device.Lock
+			if r.Key != nil {
+				id := uint32(r.Key[0].Value().(uint))
+				for _, candidate := range held {
+					if candidate.Id == id {
+						lock = candidate
+					}
+				}
+			} else if r.Row < len(held) {
+				lock = held[r.Row]
+			}
+			if lock == nil {
+				return nil, nil, nil
+			}
+			return heldLockNode(lock), []val.Value{val.UInt32(lock.Id)}, nil
+		},
+	}
+}
+
+func heldLockNode(lock *device.Lock) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "id":
+				hnd.Val = val.UInt32(lock.Id)
+			case "user":
+				if lock.Owner.User != "" {
+					hnd.Val = val.String(lock.Owner.User)
+				}
+			case "session":
+				if lock.Owner.Session != "" {
+					hnd.Val = val.String(lock.Owner.Session)
+				}
+			case "select":
+				if len(lock.Selects) > 0 {
+					hnd.Val = val.StringList(lock.Selects)
+				}
+			case "expires":
+				hnd.Val = val.String(lock.Expires.Format(time.RFC3339Nano))
+			}
+			return nil
+		},
+	}
+}
+
+func lockOutputNode(lock *device.Lock) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "id", "lock-id":
+				hnd.Val = val.UInt32(lock.Id)
+			case "locked-node":
+				hnd.Val = val.StringList(lock.Selects)
+			}
+			return nil
+		},
+	}
+}
+
+// partialLockNode implements ietf-netconf-partial-lock
+func partialLockNode(l *device.Locks) node.Node {
+	return &nodeutil.Basic{
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			owner := lockOwner(r.Selection.Context)
+			switch r.Meta.Ident() {
+			case "partial-lock":
+				v, err := r.Input.GetValue("select")
+				if err != nil {
+					return nil, err
+				}
+				var selects []string
+				if v != nil {
+					selects = v.Value().([]string)
+				}
+				lock, err := l.PartialLock(owner, selects, 0)
+				if err != nil {
+					return nil, err
+				}
+				return lockOutputNode(lock), nil
+			case "partial-unlock":
+				id, err := r.Input.GetValue("lock-id")
+				if err != nil {
+					return nil, err
+				}
+				return nil, l.Unlock(owner, uint32(id.Value().(uint)))
+			}
+			return nil, nil
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/testdata"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestLocks(t *testing.T) {
+	ypath := source.Path("./testdata:./yang:./yang/ietf-rfc")
+	birds := map[string]*testdata.Bird{
+		"robin": {Name: "robin"},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(parser.RequireModule(ypath, "bird"), testdata.BirdNode(birds)))
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"locks":     map[string]interface{}{},
+			"candidate": map[string]interface{}{},
+		},
+	}))
+	request := func(session string, method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.RemoteAddr = session
+		r.Header.Set("Content-Type", string(YangDataJsonMimeType1))
+		s.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	_, body := request("10.0.0.1:1000", "POST", "/restconf/operations/ietf-netconf-partial-lock:partial-lock", `{"ietf-netconf-partial-lock:input":{"select":["/bird:bird[name='robin']"]}}`)
+	fc.AssertEqual(t, `{"ietf-netconf-partial-lock:output":{"lock-id":1,"locked-node":["/bird:bird[name='robin']"]}}`, body)
+
+	code, body := request("10.0.0.2:2000", "PATCH", "/restconf/data/bird:bird=robin", `{"bird:wingspan":10}`)
+	fc.AssertEqual(t, 409, code)
+	fc.AssertEqual(t, true, strings.Contains(body, `"error-tag":"lock-denied"`))
+	fc.AssertEqual(t, true, strings.Contains(body, `"error-info":{"session-id":"10.0.0.1:1000","lock-id":1}`))
+	fc.AssertEqual(t, 0, birds["robin"].Wingspan)
+
+	code, _ = request("10.0.0.1:1000", "PATCH", "/restconf/data/bird:bird=robin", `{"bird:wingspan":10}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+
+	_, body = request("10.0.0.2:2000", "GET", "/restconf/data/fc-restconf:locks/lock?fields=id%3Bsession%3Bselect", "")
+	fc.AssertEqual(t, `{"lock":[{"id":1,"session":"10.0.0.1:1000","select":["/bird:bird[name='robin']"]}]}`, body)
+
+	code, body = request("10.0.0.2:2000", "GET", "/restconf/data/fc-restconf:locks/lock=1?fields=session", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"session":"10.0.0.1:1000"}`, body)
+
+	code, _ = request("10.0.0.2:2000", "POST", "/restconf/operations/ietf-netconf-partial-lock:partial-unlock", `{"ietf-netconf-partial-lock:input":{"lock-id":1}}`)
+	fc.AssertEqual(t, 409, code)
+	code, _ = request("10.0.0.1:1000", "POST", "/restconf/operations/ietf-netconf-partial-lock:partial-unlock", `{"ietf-netconf-partial-lock:input":{"lock-id":1}}`)
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 0, len(d.Locks().Held()))
+
+	_, body = request("10.0.0.1:1000", "POST", "/restconf/data/fc-restconf:locks/lockDatastore", "")
+	fc.AssertEqual(t, `{"fc-restconf:output":{"id":2}}`, body)
+	code, _ = request("10.0.0.2:2000", "PATCH", "/restconf/data/bird:bird=robin", `{"bird:wingspan":11}`)
+	fc.AssertEqual(t, 409, code)
+	code, _ = request("10.0.0.2:2000", "PATCH", "/restconf/ds/ietf-datastores:candidate/bird:bird=robin", `{"bird:wingspan":11}`)
+	fc.AssertEqual(t, 409, code)
+	code, _ = request("10.0.0.1:1000", "PATCH", "/restconf/ds/ietf-datastores:candidate/bird:bird=robin", `{"bird:wingspan":12}`)
+	fc.AssertEqual(t, 204, code)
+	code, body = request("10.0.0.2:2000", "POST", "/restconf/operations/fc-restconf:commit", "")
+	fc.AssertEqual(t, 409, code)
+	fc.AssertEqual(t, true, strings.Contains(body, `"error-tag":"lock-denied"`))
+	fc.AssertEqual(t, 10, birds["robin"].Wingspan)
+	code, _ = request("10.0.0.1:1000", "POST", "/restconf/operations/fc-restconf:commit", "")
+	fc.AssertEqual(t, 204, code)
+	fc.AssertEqual(t, 12, birds["robin"].Wingspan)
+	code, _ = request("10.0.0.1:1000", "POST", "/restconf/data/fc-restconf:locks/unlock", `{"fc-restconf:input":{"id":2}}`)
+	fc.AssertEqual(t, 204, code)
+	code, _ = request("10.0.0.2:2000", "PATCH", "/restconf/data/bird:bird=robin", `{"bird:wingspan":11}`)
+	fc.AssertEqual(t, 204, code)
+}
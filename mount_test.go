@@ -0,0 +1,227 @@
+package restconf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestMount(t *testing.T) {
+	ypath := source.Path("./yang:./yang/ietf-rfc")
+	fleet, err := parser.LoadModuleFromString(ypath, `module fleet {
+		import ietf-yang-schema-mount {
+			prefix yangmnt;
+		}
+		revision 0;
+		container devices {
+			list device {
+				key id;
+				yangmnt:mount-point "device";
+				leaf id {
+					type string;
+				}
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	car, err := parser.LoadModuleFromString(ypath, `module car {
+		revision 0;
+		container engine {
+			leaf speed {
+				type int32;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+
+	cars := make(map[string]device.Device)
+	for _, id := range []string{"abc", "xyz"} {
+		data := map[string]interface{}{
+			"engine": map[string]interface{}{
+				"speed": 10,
+			},
+		}
+		d := device.New(ypath)
+		d.AddBrowser(node.NewBrowser(car, nodeutil.ReflectChild(data)))
+		cars[id] = d
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(fleet, nodeutil.ReflectChild(map[string]interface{}{
+		"devices": map[string]interface{}{
+			"device": []interface{}{
+				map[string]interface{}{"id": "abc"},
+				map[string]interface{}{"id": "xyz"},
+				map[string]interface{}{"id": "none"},
+			},
+		},
+	})))
+	fc.RequireEqual(t, nil, d.Mount("device", func(sel *node.Selection) (device.Device, error) {
+		return cars[sel.Key()[0].String()], nil
+	}))
+	s := NewServer(d)
+
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := request("GET", "/restconf/data/fleet:devices/device=abc/car:engine", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"speed":10}`, body)
+
+	code, _ = request("PATCH", "/restconf/data/fleet:devices/device=xyz/car:engine", `{"speed":20}`)
+	fc.AssertEqual(t, 204, code)
+	_, body = request("GET", "/restconf/data/fleet:devices/device=xyz/car:engine/speed", "")
+	fc.AssertEqual(t, `{"speed":20}`, body)
+	_, body = request("GET", "/restconf/data/fleet:devices/device=abc/car:engine/speed", "")
+	fc.AssertEqual(t, `{"speed":10}`, body)
+
+	code, _ = request("GET", "/restconf/data/fleet:devices/device=none/car:engine", "")
+	fc.AssertEqual(t, 404, code)
+
+	code, body = request("GET", "/restconf/data/fleet:devices/device=abc", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, `{"id":"abc"}`, body)
+
+	code, body = request("GET", "/restconf/data/fleet:devices/device=abc/ietf-yang-library:yang-library", "")
+	fc.AssertEqual(t, 200, code)
+	fc.AssertEqual(t, true, strings.Contains(body, `"car"`))
+
+	_, body = request("GET", "/restconf/data/ietf-yang-schema-mount:schema-mounts", "")
+	fc.AssertEqual(t, `{"mount-point":[{"module":"fleet","label":"device","config":true,"inline":{}}]}`, body)
+}
+
+func TestMountAuth(t *testing.T) {
+	ypath := source.Path("./yang:./yang/ietf-rfc")
+	fleet, err := parser.LoadModuleFromString(ypath, `module fleet {
+		import ietf-yang-schema-mount {
+			prefix yangmnt;
+		}
+		revision 0;
+		list device {
+			key id;
+			yangmnt:mount-point "device";
+			leaf id {
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	car, err := parser.LoadModuleFromString(ypath, `module car {
+		revision 0;
+		leaf speed {
+			type int32;
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	mounted := device.New(ypath)
+	mounted.AddBrowser(node.NewBrowser(car, nodeutil.ReflectChild(map[string]interface{}{"speed": 10})))
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(fleet, nodeutil.ReflectChild(map[string]interface{}{
+		"device": []interface{}{
+			map[string]interface{}{"id": "abc"},
+		},
+	})))
+	fc.RequireEqual(t, nil, d.Mount("device", func(sel *node.Selection) (device.Device, error) {
+		return mounted, nil
+	}))
+	s := NewServer(d)
+	rbac := secure.NewRbac()
+	driver := secure.NewRole()
+	driver.Access["car"] = &secure.AccessControl{Path: "car", Permissions: secure.Read}
+	rbac.Roles["driver"] = driver
+	s.Auth = rbac
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/restconf/data/fleet:device=abc/car:speed", nil))
+		return w.Code
+	}
+
+	t.Run("no anonymous role", func(t *testing.T) {
+		fc.AssertEqual(t, false, get() == 200)
+	})
+
+	rbac.Anonymous = "driver"
+	t.Run("mount point hidden", func(t *testing.T) {
+		fc.AssertEqual(t, false, get() == 200)
+	})
+
+	driver.Access["fleet"] = &secure.AccessControl{Path: "fleet", Permissions: secure.Read}
+	t.Run("anonymous role", func(t *testing.T) {
+		fc.AssertEqual(t, 200, get())
+	})
+}
+
+func TestMountLocks(t *testing.T) {
+	ypath := source.Path("./yang:./yang/ietf-rfc")
+	fleet, err := parser.LoadModuleFromString(ypath, `module fleet {
+		import ietf-yang-schema-mount {
+			prefix yangmnt;
+		}
+		revision 0;
+		list device {
+			key id;
+			yangmnt:mount-point "device";
+			leaf id {
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	car, err := parser.LoadModuleFromString(ypath, `module car {
+		revision 0;
+		leaf speed {
+			type int32;
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	cars := make(map[string]device.Device)
+	for _, id := range []string{"abc", "xyz"} {
+		d := device.New(ypath)
+		d.AddBrowser(node.NewBrowser(car, nodeutil.ReflectChild(map[string]interface{}{"speed": 10})))
+		cars[id] = d
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(fleet, nodeutil.ReflectChild(map[string]interface{}{
+		"device": []interface{}{
+			map[string]interface{}{"id": "abc"},
+			map[string]interface{}{"id": "xyz"},
+		},
+	})))
+	fc.RequireEqual(t, nil, d.Mount("device", func(sel *node.Selection) (device.Device, error) {
+		return cars[sel.Key()[0].String()], nil
+	}))
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"locks": map[string]interface{}{},
+		},
+	}))
+	request := func(session string, method string, url string, body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.RemoteAddr = session
+		r.Header.Set("Content-Type", string(YangDataJsonMimeType1))
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	code := request("10.0.0.1:1000", "POST", "/restconf/operations/ietf-netconf-partial-lock:partial-lock", `{"ietf-netconf-partial-lock:input":{"select":["/fleet:device[id='abc']"]}}`)
+	fc.AssertEqual(t, 200, code)
+	code = request("10.0.0.2:2000", "PATCH", "/restconf/data/fleet:device=abc/car:speed", `{"speed":20}`)
+	fc.AssertEqual(t, 409, code)
+	code = request("10.0.0.2:2000", "PATCH", "/restconf/data/fleet:device=xyz/car:speed", `{"speed":20}`)
+	fc.AssertEqual(t, 204, code)
+	code = request("10.0.0.1:1000", "PATCH", "/restconf/data/fleet:device=abc/car:speed", `{"speed":20}`)
+	fc.AssertEqual(t, 204, code)
+}
@@ -1,6 +1,11 @@
 package restconf
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/freeconf/restconf/audit"
+	"github.com/freeconf/restconf/device"
 	"github.com/freeconf/restconf/stock"
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/node"
@@ -14,9 +19,97 @@ func Node(mgmt *Server, ypath source.Opener) node.Node {
 		Base: nodeutil.ReflectChild(mgmt),
 		OnChild: func(p node.Node, r node.ChildRequest) (node.Node, error) {
 			switch r.Meta.Ident() {
+			case "audit":
+				if r.New {
+					mgmt.Audit = audit.NewLog()
+				}
+				if mgmt.Audit != nil {
+					return audit.Manage(mgmt.Audit), nil
+				}
+			case "gateway":
+				if r.New {
+					mgmt.Gateway = NewGateway()
+				}
+				if mgmt.Gateway != nil {
+					return GatewayNode(mgmt.Gateway), nil
+				}
+			case "startup":
+				if r.New {
+					local, valid := mgmt.main.(*device.Local)
+					if !valid {
+						return nil, fmt.Errorf("%w. startup requires local device", fc.BadRequestError)
+					}
+					p := device.NewPersist(local, "")
+					// server settings survive factory reset so device stays reachable
+					p.Keep = []string{"fc-restconf"}
+					if b, _ := local.Browser("ietf-factory-default"); b == nil {
+						if err := local.Add("ietf-factory-default", device.FactoryDefaultNode(p)); err != nil {
+							return nil, err
+						}
+					}
+					mgmt.Persist = p
+				}
+				if mgmt.Persist != nil {
+					return persistNode(mgmt.Persist), nil
+				}
+			case "candidate":
+				if r.New {
+					local, valid := mgmt.main.(*device.Local)
+					if !valid {
+						return nil, fmt.Errorf("%w. candidate requires local device", fc.BadRequestError)
+					}
+					local.EnableCandidate()
+				}
+				if c := mgmt.candidate(); c != nil {
+					return candidateNode(c), nil
+				}
+			case "history":
+				if r.New {
+					local, valid := mgmt.main.(*device.Local)
+					if !valid {
+						return nil, fmt.Errorf("%w. history requires local device", fc.BadRequestError)
+					}
+					local.EnableHistory()
+					if err := enableConfigChanges(local); err != nil {
+						return nil, err
+					}
+				}
+				if h := mgmt.history(); h != nil {
+					return historyNode(mgmt, h), nil
+				}
+			case "configChanges":
+				if r.New {
+					local, valid := mgmt.main.(*device.Local)
+					if !valid {
+						return nil, fmt.Errorf("%w. configChanges requires local device", fc.BadRequestError)
+					}
+					if err := enableConfigChanges(local); err != nil {
+						return nil, err
+					}
+				}
+				if mgmt.configChanges() != nil {
+					return &nodeutil.Basic{}, nil
+				}
+			case "locks":
+				if r.New {
+					local, valid := mgmt.main.(*device.Local)
+					if !valid {
+						return nil, fmt.Errorf("%w. locks requires local device", fc.BadRequestError)
+					}
+					l := local.EnableLocks()
+					if b, _ := local.Browser("ietf-netconf-partial-lock"); b == nil {
+						if err := local.Add("ietf-netconf-partial-lock", partialLockNode(l)); err != nil {
+							return nil, err
+						}
+					}
+				}
+				if l := mgmt.locks(); l != nil {
+					return locksNode(l), nil
+				}
 			case "web":
 				if r.New {
 					mgmt.Web = stock.NewHttpServer(mgmt)
+					mgmt.Web.OnConnClosed = mgmt.connClosed
 				}
 				if mgmt.Web != nil {
 					return stock.WebServerNode(mgmt.Web), nil
@@ -26,6 +119,35 @@ func Node(mgmt *Server, ypath source.Opener) node.Node {
 			}
 			return nil, nil
 		},
+		OnAction: func(p node.Node, r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "saveConfig":
+				if mgmt.Persist == nil {
+					return nil, fmt.Errorf("%w. startup not enabled", fc.NotFoundError)
+				}
+				return nil, mgmt.Persist.Save()
+			case "commit", "cancelCommit", "discardChanges", "validate":
+				c := mgmt.candidate()
+				if c == nil {
+					return nil, fmt.Errorf("%w. candidate not enabled", fc.NotFoundError)
+				}
+				return nil, candidateAction(mgmt, c, r)
+			}
+			return p.Action(r)
+		},
+		OnNotify: func(p node.Node, r node.NotifyRequest) (node.NotifyCloser, error) {
+			switch r.Meta.Ident() {
+			case "auditRecord":
+				if mgmt.Audit == nil {
+					return nil, fmt.Errorf("%w. audit not enabled", fc.NotFoundError)
+				}
+				sub := mgmt.Audit.OnRecord(func(rec audit.Record) {
+					r.Send(audit.RecordNode(rec))
+				})
+				return sub.Close, nil
+			}
+			return p.Notify(r)
+		},
 		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
 			switch r.Meta.Ident() {
 			case "debug":
@@ -45,3 +167,189 @@ func Node(mgmt *Server, ypath source.Opener) node.Node {
 		},
 	}
 }
+
+func enableConfigChanges(local *device.Local) error {
+	c := local.EnableConfigChanges()
+	if b, _ := local.Browser("ietf-netconf-notifications"); b == nil {
+		return local.Add("ietf-netconf-notifications", device.NetconfNotificationsNode(c))
+	}
+	return nil
+}
+
+func persistNode(p *device.Persist) node.Node {
+	return &nodeutil.Extend{
+		Base: nodeutil.ReflectChild(p),
+		OnField: func(parent node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "autosaveDelayMs":
+				if r.Write {
+					p.AutosaveDelay = time.Duration(hnd.Val.Value().(int)) * time.Millisecond
+				} else {
+					hnd.Val = val.Int32(p.AutosaveDelay.Milliseconds())
+				}
+				return nil
+			}
+			return parent.Field(r, hnd)
+		},
+	}
+}
+
+func candidateNode(c *device.Candidate) node.Node {
+	return &nodeutil.Basic{
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "confirmPending":
+				hnd.Val = val.Bool(c.ConfirmPending())
+			}
+			return nil
+		},
+	}
+}
+
+func candidateAction(mgmt *Server, c *device.Candidate, r node.ActionRequest) error {
+	owner := lockOwner(r.Selection.Context)
+	user := owner.User
+	switch r.Meta.Ident() {
+	case "commit":
+		var confirmed bool
+		var comment string
+		timeout := device.DefaultConfirmTimeout
+		if r.Input != nil {
+			if v, err := r.Input.GetValue("comment"); err != nil {
+				return err
+			} else if v != nil {
+				comment = v.String()
+			}
+			if v, err := r.Input.GetValue("confirmed"); err != nil {
+				return err
+			} else if v != nil {
+				confirmed = v.Value().(bool)
+			}
+			if v, err := r.Input.GetValue("confirmTimeoutMs"); err != nil {
+				return err
+			} else if v != nil {
+				timeout = time.Duration(v.Value().(int)) * time.Millisecond
+			}
+		}
+		if confirmed {
+			if err := c.ConfirmedCommit(owner, timeout); err != nil {
+				return err
+			}
+			// not saved to startup until confirmed
+			mgmt.runningChanged(user, comment)
+			return nil
+		}
+		if err := c.Commit(owner); err != nil {
+			return err
+		}
+		mgmt.configChanged(user, comment)
+	case "cancelCommit":
+		if err := c.CancelCommit(owner); err != nil {
+			return err
+		}
+		mgmt.runningChanged(user, "cancel commit")
+	case "discardChanges":
+		c.Discard()
+	case "validate":
+		return c.Validate()
+	}
+	return nil
+}
+
+func historyNode(mgmt *Server, h *device.History) node.Node {
+	return &nodeutil.Basic{
+		OnChild: func(r node.ChildRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "revision":
+				return revisionsNode(h.Revisions()), nil
+			}
+			return nil, nil
+		},
+		OnField: func(r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "limit":
+				if r.Write {
+					h.Limit = hnd.Val.Value().(int)
+				} else {
+					hnd.Val = val.Int32(h.Limit)
+				}
+			}
+			return nil
+		},
+		OnAction: func(r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "compare":
+				from, err := r.Input.GetValue("from")
+				if err != nil {
+					return nil, err
+				}
+				var to int
+				if v, err := r.Input.GetValue("to"); err != nil {
+					return nil, err
+				} else if v != nil {
+					to = v.Value().(int)
+				}
+				edits, err := h.Compare(from.Value().(int), to)
+				if err != nil {
+					return nil, err
+				}
+				return &nodeutil.Basic{
+					OnChild: func(r node.ChildRequest) (node.Node, error) {
+						if len(edits) == 0 {
+							return nil, nil
+						}
+						return device.ConfigEditsNode(edits), nil
+					},
+				}, nil
+			case "rollback":
+				rev, err := r.Input.GetValue("revision")
+				if err != nil {
+					return nil, err
+				}
+				owner := lockOwner(r.Selection.Context)
+				if _, err = h.Rollback(rev.Value().(int), owner); err != nil {
+					return nil, err
+				}
+				mgmt.configChanged(owner.User, "")
+			}
+			return nil, nil
+		},
+	}
+}
+
+func revisionsNode(revs []*device.Revision) node.Node {
+	return &nodeutil.Basic{
+		OnNext: func(r node.ListRequest) (node.Node, []val.Value, error) {
+			var rev *device.Revision
+			if r.Key != nil {
+				id := r.Key[0].Value().(int)
+				for _, candidate := range revs {
+					if candidate.Id == id {
+						rev = candidate
+					}
+				}
+			} else if r.Row < len(revs) {
+				// newest first
+				rev = revs[len(revs)-r.Row-1]
+			}
+			if rev == nil {
+				return nil, nil, nil
+			}
+			return revisionNode(rev), []val.Value{val.Int32(rev.Id)}, nil
+		},
+	}
+}
+
+func revisionNode(rev *device.Revision) node.Node {
+	return &nodeutil.Extend{
+		Base: nodeutil.ReflectChild(rev),
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "timestamp":
+				hnd.Val = val.String(rev.Timestamp.Format(time.RFC3339Nano))
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+	}
+}
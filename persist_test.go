@@ -0,0 +1,137 @@
+package restconf
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestPersist(t *testing.T) {
+	ypath := source.Path("./yang:./yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(ypath, `module x {
+		revision 0;
+		container c {
+			leaf a {
+				type string;
+			}
+			leaf b {
+				config false;
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	dir := t.TempDir()
+	startup := filepath.Join(dir, "startup.json")
+	defaults := filepath.Join(dir, "defaults.json")
+	fc.RequireEqual(t, nil, os.WriteFile(defaults, []byte(`{"x":{"c":{"a":"factory"}}}`), 0600))
+	newDevice := func() *device.Local {
+		d := device.New(ypath)
+		data := map[string]interface{}{
+			"c": map[string]interface{}{"b": "state"},
+		}
+		d.AddBrowser(node.NewBrowser(m, nodeutil.ReflectChild(data)))
+		NewServer(d)
+		return d
+	}
+	d := newDevice()
+	s := NewServer(d)
+	fc.RequireEqual(t, nil, d.ApplyStartupConfigData(map[string]interface{}{
+		"fc-restconf": map[string]interface{}{
+			"notifyKeepaliveTimeoutMs": 5000,
+			"startup": map[string]interface{}{
+				"file":               startup,
+				"autosave":           true,
+				"autosaveDelayMs":    10,
+				"factoryDefaultFile": defaults,
+			},
+		},
+		"x": map[string]interface{}{
+			"c": map[string]interface{}{"a": "startup"},
+		},
+	}))
+	request := func(method string, url string, body string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+	saved := func() map[string]interface{} {
+		data, err := os.ReadFile(startup)
+		if err != nil {
+			return nil
+		}
+		var cfg map[string]interface{}
+		fc.RequireEqual(t, nil, json.Unmarshal(data, &cfg))
+		return cfg
+	}
+	savedA := func() interface{} {
+		if x, valid := saved()["x"].(map[string]interface{}); valid {
+			return x["c"].(map[string]interface{})["a"]
+		}
+		return nil
+	}
+
+	t.Run("autosave", func(t *testing.T) {
+		code, _ := request("PATCH", "/restconf/data/x:c", `{"a":"edited"}`)
+		fc.AssertEqual(t, 204, code)
+		for i := 0; savedA() != "edited" && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		fc.AssertEqual(t, "edited", savedA())
+		_, hasState := saved()["x"].(map[string]interface{})["c"].(map[string]interface{})["b"]
+		fc.AssertEqual(t, false, hasState)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		d2 := newDevice()
+		fc.RequireEqual(t, nil, d2.ApplyStartupConfigFile(startup))
+		b, _ := d2.Browser("x")
+		c, err := b.Root().Find("c")
+		fc.RequireEqual(t, nil, err)
+		actual, err := nodeutil.WriteJSON(c)
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, `{"a":"edited","b":"state"}`, actual)
+	})
+
+	t.Run("save", func(t *testing.T) {
+		os.Remove(startup)
+		code, _ := request("POST", "/restconf/operations/fc-restconf:saveConfig", "")
+		fc.AssertEqual(t, 204, code)
+		fc.AssertEqual(t, "edited", savedA())
+	})
+
+	t.Run("factory-reset", func(t *testing.T) {
+		code, _ := request("POST", "/restconf/operations/ietf-factory-default:factory-reset", "")
+		fc.AssertEqual(t, 204, code)
+		_, body := request("GET", "/restconf/data/x:c", "")
+		fc.AssertEqual(t, `{"a":"factory","b":"state"}`, body)
+		fc.AssertEqual(t, "factory", savedA())
+	})
+
+	t.Run("factory-reset w/o defaults", func(t *testing.T) {
+		s.Persist.FactoryDefaultFile = ""
+		code, _ := request("POST", "/restconf/operations/ietf-factory-default:factory-reset", "")
+		fc.AssertEqual(t, 204, code)
+		_, body := request("GET", "/restconf/data/x:", "")
+		fc.AssertEqual(t, false, strings.Contains(body, "factory"), body)
+		fc.AssertEqual(t, 5000, s.NotifyKeepaliveTimeoutMs)
+		fc.AssertEqual(t, startup, s.Persist.File)
+	})
+
+	t.Run("save w/o file", func(t *testing.T) {
+		err := device.NewPersist(d, "").Save()
+		fc.AssertEqual(t, true, errors.Is(err, fc.BadRequestError))
+	})
+}
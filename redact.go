@@ -0,0 +1,177 @@
+package restconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+)
+
+// redactWtr masks values of sensitive leaves as they are written unless reveal
+// allows it.  Nil reveal means nothing is revealed.
+func redactWtr(wtr node.Node, reveal func(m meta.Meta) bool) node.Node {
+	return &nodeutil.Extend{
+		Base: wtr,
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			if r.Write && hnd.Val != nil && secure.IsSensitive(r.Meta) {
+				if reveal == nil || !reveal(r.Meta) {
+					hnd.Val = secure.MaskValue(hnd.Val)
+				}
+			}
+			return p.Field(r, hnd)
+		},
+		OnExtend: func(e *nodeutil.Extend, sel *node.Selection, m meta.HasDefinitions, child node.Node) (node.Node, error) {
+			return redactWtr(child, reveal), nil
+		},
+	}
+}
+
+// redactJson masks sensitive values in data in place where data is JSON of
+// given definition
+func redactJson(m meta.Meta, data map[string]interface{}) {
+	for k, v := range data {
+		ident := k
+		if colon := strings.IndexRune(k, ':'); colon >= 0 {
+			ident = k[colon+1:]
+		}
+		def := meta.Find(m, ident)
+		if def == nil {
+			continue
+		}
+		switch x := v.(type) {
+		case map[string]interface{}:
+			redactJson(def, x)
+		case []interface{}:
+			if meta.IsLeaf(def) {
+				if v != nil && secure.IsSensitive(def) {
+					data[k] = secure.Mask
+				}
+				continue
+			}
+			for _, item := range x {
+				if itemData, valid := item.(map[string]interface{}); valid {
+					redactJson(def, itemData)
+				}
+			}
+		default:
+			if v != nil && secure.IsSensitive(def) {
+				data[k] = secure.Mask
+			}
+		}
+	}
+}
+
+// redactBody is for logging request bodies before request is resolved to a
+// definition so values of any keys sharing a name with a sensitive leaf
+// in device are masked.
+func redactBody(d device.Device, contentType MimeType, content []byte) string {
+	idents := make(map[string]bool)
+	for _, m := range d.Modules() {
+		for ident := range sensitiveIdents(m) {
+			idents[ident] = true
+		}
+	}
+	if len(idents) == 0 {
+		return string(content)
+	}
+	var data interface{}
+	if !contentType.IsXml() && json.Unmarshal(content, &data) == nil {
+		redactKeys(idents, data)
+		if masked, err := json.Marshal(data); err == nil {
+			return string(masked)
+		}
+	}
+	return fmt.Sprintf("(%d bytes not shown, may contain sensitive values)", len(content))
+}
+
+func redactKeys(idents map[string]bool, data interface{}) {
+	switch x := data.(type) {
+	case map[string]interface{}:
+		for k, v := range x {
+			ident := k
+			if colon := strings.IndexRune(k, ':'); colon >= 0 {
+				ident = k[colon+1:]
+			}
+			if idents[ident] {
+				if _, isMap := v.(map[string]interface{}); !isMap {
+					x[k] = secure.Mask
+					continue
+				}
+			}
+			redactKeys(idents, v)
+		}
+	case []interface{}:
+		for _, item := range x {
+			redactKeys(idents, item)
+		}
+	}
+}
+
+var sensitiveIdentsCache sync.Map
+
+// sensitiveIdents are names of all sensitive leaves in module
+func sensitiveIdents(m *meta.Module) map[string]bool {
+	if found, exists := sensitiveIdentsCache.Load(m); exists {
+		return found.(map[string]bool)
+	}
+	idents := make(map[string]bool)
+	findSensitive(m, idents)
+	sensitiveIdentsCache.Store(m, idents)
+	return idents
+}
+
+func findSensitive(m meta.Meta, idents map[string]bool) {
+	if meta.IsLeaf(m) {
+		if secure.IsSensitive(m) {
+			idents[m.(meta.Identifiable).Ident()] = true
+		}
+		return
+	}
+	if x, valid := m.(*meta.Choice); valid {
+		for _, c := range x.Cases() {
+			findSensitive(c, idents)
+		}
+		return
+	}
+	if x, valid := m.(*meta.Rpc); valid {
+		if x.Input() != nil {
+			findSensitive(x.Input(), idents)
+		}
+		if x.Output() != nil {
+			findSensitive(x.Output(), idents)
+		}
+		return
+	}
+	if x, valid := m.(meta.HasDataDefinitions); valid {
+		for _, def := range x.DataDefinitions() {
+			findSensitive(def, idents)
+		}
+	}
+	if x, valid := m.(meta.HasActions); valid {
+		for _, a := range x.Actions() {
+			findSensitive(a, idents)
+		}
+	}
+	if x, valid := m.(meta.HasNotifications); valid {
+		for _, n := range x.Notifications() {
+			findSensitive(n, idents)
+		}
+	}
+}
+
+// reveal is nil unless auth allows some roles to see sensitive values
+func reveal(auth secure.Auth, user string) func(m meta.Meta) bool {
+	r, valid := auth.(secure.Revealer)
+	if !valid {
+		return nil
+	}
+	return func(m meta.Meta) bool {
+		return r.Reveal(user, m)
+	}
+}
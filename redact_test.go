@@ -0,0 +1,93 @@
+package restconf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freeconf/restconf/audit"
+	"github.com/freeconf/restconf/device"
+	"github.com/freeconf/restconf/secure"
+	"github.com/freeconf/yang/fc"
+	"github.com/freeconf/yang/node"
+	"github.com/freeconf/yang/nodeutil"
+	"github.com/freeconf/yang/parser"
+	"github.com/freeconf/yang/source"
+)
+
+func TestRedact(t *testing.T) {
+	ypath := source.Path("./yang:./yang/ietf-rfc")
+	m, err := parser.LoadModuleFromString(ypath, `module x {
+		import ietf-netconf-acm {
+			prefix nacm;
+		}
+		import fc-secure {
+			prefix sec;
+		}
+		revision 0;
+		container account {
+			leaf name {
+				type string;
+			}
+			leaf password {
+				nacm:default-deny-all;
+				type string;
+			}
+			leaf-list keys {
+				sec:sensitive;
+				type string;
+			}
+		}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	data := map[string]interface{}{
+		"account": map[string]interface{}{
+			"name":     "joe",
+			"password": "secret",
+			"keys":     []interface{}{"k1", "k2"},
+		},
+	}
+	d := device.New(ypath)
+	d.AddBrowser(node.NewBrowser(m, nodeutil.ReflectChild(data)))
+	s := NewServer(d)
+	s.Audit = audit.NewLog()
+	s.Filters = append(s.Filters, func(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, error) {
+		return secure.WithUser(ctx, "joe"), nil
+	})
+	request := func(method string, url string, body string) string {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	expected := `{"account":{"name":"joe","password":"****","keys":["****","****"]}}`
+	fc.AssertEqual(t, expected, request("GET", "/restconf/data/x:", ""))
+
+	t.Run("explicit permission", func(t *testing.T) {
+		rbac := secure.NewRbac()
+		role := secure.NewRole()
+		role.Access["x"] = &secure.AccessControl{Path: "x", Permissions: secure.Full}
+		role.Access["x/account/password"] = &secure.AccessControl{Path: "x/account/password", Permissions: secure.Read}
+		rbac.Roles["joe"] = role
+		s.Auth = rbac
+		defer func() { s.Auth = nil }()
+		expected := `{"account":{"name":"joe","password":"secret","keys":["****","****"]}}`
+		fc.AssertEqual(t, expected, request("GET", "/restconf/data/x:", ""))
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		request("PATCH", "/restconf/data/x:account", `{"password":"changed"}`)
+		fc.AssertEqual(t, "changed", data["account"].(map[string]interface{})["password"])
+		fc.AssertEqual(t, `{"password":"****"}`, s.Audit.Recent()[0].Diff)
+	})
+
+	t.Run("body", func(t *testing.T) {
+		actual := redactBody(d, YangDataJsonMimeType1, []byte(`{"account":{"name":"joe","password":"x"}}`))
+		fc.AssertEqual(t, `{"account":{"name":"joe","password":"****"}}`, actual)
+		actual = redactBody(d, YangDataXmlMimeType1, []byte(`<account><password>x</password></account>`))
+		fc.AssertEqual(t, false, strings.Contains(actual, "x</password>"))
+	})
+}
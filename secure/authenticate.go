@@ -1,35 +1,122 @@
 package secure
 
 import (
+	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/freeconf/restconf/stock"
+	"github.com/freeconf/yang/fc"
 )
 
+// CertHandler authenticates clients by their TLS certificate and maps the certificate
+// to a user name using RFC7407 cert-to-name entries.
 type CertHandler struct {
-	Authority *stock.Tls
+	// Certificate authorities client certificates must be issued by. RESTCONF
+	// server uses its own when this is not set.
+	Authority  *stock.Tls
+	CertToName CertToNameMap
 }
 
-func (self *CertHandler) VerifyRequest(certs []*x509.Certificate) error {
-	// certs := r.TLS.PeerCertificates
+// CertIdentity is the result of successfully verifying and mapping a client certificate
+type CertIdentity struct {
+	// User name derived from certificate
+	User string
+
+	// Cert-to-name entry that produced the user name
+	Entry *CertToName
+
+	// Verified chain starting with peer certificate
+	Chain []*x509.Certificate
+}
+
+var ErrNoCertName = errors.New("no cert-to-name entry matched certificate")
+
+var ErrNoAuthority = errors.New("no certificate authority to verify client certificate")
+
+// VerifyRequest verifies peer certificate chain against the certificate authority
+// and then maps the certificate to a user name. certs[0] is expected to be peer
+// certificate followed by any intermediate certificates as they are presented
+// in a TLS handshake.
+func (self *CertHandler) VerifyRequest(certs []*x509.Certificate) (*CertIdentity, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w. no client certificate", fc.UnauthorizedError)
+	}
+	if self.Authority == nil || self.Authority.RootCAs() == nil {
+		// otherwise system roots would be trusted
+		return nil, fmt.Errorf("%w. %s", fc.UnauthorizedError, ErrNoAuthority)
+	}
 	opts := x509.VerifyOptions{
-		Roots: self.Authority.Config.RootCAs,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	}
-	var err error
-	var valid *x509.Certificate
-	for _, cert := range certs {
-		if _, invalid := cert.Verify(opts); invalid != nil {
-			err = invalid
-		} else {
-			valid = cert
+	opts.Roots = self.Authority.RootCAs()
+	for _, intermediate := range certs[1:] {
+		opts.Intermediates.AddCert(intermediate)
+	}
+	chains, err := certs[0].Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w. %s", fc.UnauthorizedError, err)
+	}
+	if err = self.Authority.CheckRevoked(chains); err != nil {
+		return nil, fmt.Errorf("%w. %s", fc.UnauthorizedError, err)
+	}
+	return self.identify(chains)
+}
+
+func (self *CertHandler) identify(chains [][]*x509.Certificate) (*CertIdentity, error) {
+	for _, chain := range chains {
+		entry, name, err := self.CertToName.Name(chain)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			return &CertIdentity{
+				User:  name,
+				Entry: entry,
+				Chain: chain,
+			}, nil
 		}
 	}
+	return nil, fmt.Errorf("%w. %s", fc.UnauthorizedError, ErrNoCertName)
+}
 
+// Filter is compatible with RESTCONF server request filters and puts the user name
+// from client certificate into request context.  If TLS handshake has already
+// verified the client certificate, those verified chains are used.
+func (self *CertHandler) Filter(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ctx, nil
+	}
+	var id *CertIdentity
+	var err error
+	if len(r.TLS.VerifiedChains) > 0 {
+		id, err = self.identify(r.TLS.VerifiedChains)
+	} else {
+		id, err = self.VerifyRequest(r.TLS.PeerCertificates)
+	}
 	if err != nil {
-		return err
+		fc.Debug.Printf("client certificate rejected. %s", err)
+		return ctx, err
 	}
-	fmt.Printf("Valid! %v", valid)
+	fc.Debug.Printf("client certificate mapped to user %s using entry %d", id.User, id.Entry.Id)
+	return WithUser(ctx, id.User), nil
+}
+
+var userKey contextKey = 1
 
-	return nil
+// WithUser stores authenticated user name in context for authorization and audit
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// User is the authenticated user name stored in context or empty string if there
+// is none
+func User(ctx context.Context) string {
+	if user, valid := ctx.Value(userKey).(string); valid {
+		return user
+	}
+	return ""
 }
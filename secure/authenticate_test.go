@@ -1,7 +1,170 @@
 package secure
 
-import "testing"
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freeconf/restconf/stock"
+	"github.com/freeconf/yang/fc"
+)
 
 func TestAuthenticate(t *testing.T) {
+	ca, caKey := testCert(t, nil, nil, func(c *x509.Certificate) {
+		c.Subject.CommonName = "ca"
+		c.IsCA = true
+		c.KeyUsage = x509.KeyUsageCertSign
+	})
+	client, _ := testCert(t, ca, caKey, func(c *x509.Certificate) {
+		c.Subject.CommonName = "Joe"
+		c.DNSNames = []string{"Joe.Example.COM"}
+		c.EmailAddresses = []string{"joe@Example.COM"}
+		c.IPAddresses = []net.IP{net.ParseIP("2001:db8::1")}
+	})
+	caPrint, err := Fingerprint(ca, crypto.SHA256)
+	fc.RequireEqual(t, nil, err)
+	clientPrint, err := Fingerprint(client, crypto.SHA1)
+	fc.RequireEqual(t, nil, err)
+	bogusPrint := "04:" + caPrint[3:len(caPrint)-2] + "00"
+
+	authority := &stock.Tls{}
+	authority.Config.RootCAs = x509.NewCertPool()
+	authority.Config.RootCAs.AddCert(ca)
+
+	tests := []struct {
+		desc     string
+		entries  CertToNameMap
+		expected string
+	}{
+		{
+			desc: "specified by ca",
+			entries: CertToNameMap{
+				{Id: 1, Fingerprint: caPrint, MapType: "x509c2n:specified", Name: "admin"},
+			},
+			expected: "admin",
+		},
+		{
+			desc: "lower id searched first",
+			entries: CertToNameMap{
+				{Id: 5, Fingerprint: caPrint, MapType: "common-name"},
+				{Id: 2, Fingerprint: clientPrint, MapType: "san-dns-name"},
+			},
+			expected: "joe.example.com",
+		},
+		{
+			desc: "skip mismatched fingerprint",
+			entries: CertToNameMap{
+				{Id: 1, Fingerprint: bogusPrint, MapType: "specified", Name: "admin"},
+				{Id: 2, Fingerprint: caPrint, MapType: "san-rfc822-name"},
+			},
+			expected: "joe@example.com",
+		},
+		{
+			desc: "san any prefers rfc822",
+			entries: CertToNameMap{
+				{Id: 1, Fingerprint: caPrint, MapType: "san-any"},
+			},
+			expected: "joe@example.com",
+		},
+		{
+			desc: "ipv6",
+			entries: CertToNameMap{
+				{Id: 1, Fingerprint: caPrint, MapType: "san-ip-address"},
+			},
+			expected: "20010db8000000000000000000000001",
+		},
+		{
+			desc: "no match",
+			entries: CertToNameMap{
+				{Id: 1, Fingerprint: bogusPrint, MapType: "common-name"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Log(test.desc)
+		h := &CertHandler{Authority: authority, CertToName: test.entries}
+		id, err := h.VerifyRequest([]*x509.Certificate{client})
+		if test.expected == "" {
+			fc.AssertEqual(t, true, errors.Is(err, fc.UnauthorizedError))
+			continue
+		}
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, test.expected, id.User)
+		fc.AssertEqual(t, 2, len(id.Chain))
+	}
+
+	t.Run("untrusted", func(t *testing.T) {
+		h := &CertHandler{Authority: &stock.Tls{}}
+		h.Authority.Config.RootCAs = x509.NewCertPool()
+		_, err := h.VerifyRequest([]*x509.Certificate{client})
+		fc.AssertEqual(t, true, errors.Is(err, fc.UnauthorizedError))
+	})
+
+	t.Run("no authority", func(t *testing.T) {
+		h := &CertHandler{
+			CertToName: CertToNameMap{
+				{Id: 1, Fingerprint: caPrint, MapType: "common-name"},
+			},
+		}
+		_, err := h.VerifyRequest([]*x509.Certificate{client})
+		fc.AssertEqual(t, true, errors.Is(err, fc.UnauthorizedError))
+		fc.AssertEqual(t, true, strings.Contains(err.Error(), ErrNoAuthority.Error()))
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		h := &CertHandler{
+			Authority: authority,
+			CertToName: CertToNameMap{
+				{Id: 1, Fingerprint: caPrint, MapType: "common-name"},
+			},
+		}
+		r := &http.Request{
+			TLS: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{client},
+			},
+		}
+		ctx, err := h.Filter(context.Background(), nil, r)
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, "Joe", User(ctx))
+
+		ctx, err = h.Filter(context.Background(), nil, &http.Request{})
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, "", User(ctx))
+	})
+}
 
+func testCert(t *testing.T, parent *x509.Certificate, parentKey crypto.Signer, init func(*x509.Certificate)) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	fc.RequireEqual(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	init(template)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	fc.RequireEqual(t, nil, err)
+	cert, err := x509.ParseCertificate(raw)
+	fc.RequireEqual(t, nil, err)
+	return cert, key
 }
@@ -74,6 +74,10 @@ func (role *Role) ContextConstraint(s *node.Selection) context.Context {
 	if acl, found := role.Access[meta.SchemaPath(s.Meta())]; found {
 		return context.WithValue(s.Context, permKey, acl.Permissions)
 	}
+	if s.Parent() == nil {
+		// permissions never carry over from another module
+		return context.WithValue(s.Context, permKey, None)
+	}
 	return s.Context
 }
 
@@ -1,6 +1,7 @@
 package secure
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strings"
@@ -212,3 +213,23 @@ func sel(sel *node.Selection, err error) *node.Selection {
 	}
 	return sel
 }
+
+func TestAuthModuleRoot(t *testing.T) {
+	m, err := parser.LoadModuleFromString(nil, `module other { revision 0;
+leaf count {
+	type int32;
+}
+	}`)
+	fc.RequireEqual(t, nil, err)
+	role := NewRole()
+	role.Access["birding"] = &AccessControl{Path: "birding", Permissions: Full}
+	b := node.NewBrowser(m, nodeutil.ReflectChild(map[string]interface{}{"count": 10}))
+
+	// context from another module
+	sel := b.RootWithContext(context.WithValue(context.Background(), permKey, Full))
+	sel.Constraints.AddConstraint("auth", 0, 0, role)
+	sel.Context = sel.Constraints.ContextConstraint(sel)
+	actual, err := nodeutil.WriteJSON(sel)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, `{}`, actual)
+}
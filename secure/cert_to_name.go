@@ -0,0 +1,196 @@
+package secure
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Implementation of RFC7407 ietf-x509-cert-to-name mapping algorithms
+//
+//	https://datatracker.ietf.org/doc/html/rfc7407#section-4.1
+type MapType string
+
+const (
+	MapSpecified     MapType = "specified"
+	MapSanRfc822Name MapType = "san-rfc822-name"
+	MapSanDnsName    MapType = "san-dns-name"
+	MapSanIpAddress  MapType = "san-ip-address"
+	MapSanAny        MapType = "san-any"
+	MapCommonName    MapType = "common-name"
+)
+
+// CertToName is a single entry in the cert-to-name list.  Entries are searched in
+// order of their id.
+type CertToName struct {
+	Id          uint
+	Fingerprint string
+	MapType     string
+	Name        string
+}
+
+// TLS HashAlgorithm registry from RFC5246 used as first octet of a fingerprint
+var fingerprintHashes = map[byte]crypto.Hash{
+	1: crypto.MD5,
+	2: crypto.SHA1,
+	3: crypto.SHA224,
+	4: crypto.SHA256,
+	5: crypto.SHA384,
+	6: crypto.SHA512,
+}
+
+// Fingerprint formats a certificate fingerprint as a tls-fingerprint value using
+// the given hash. Useful for building cert-to-name entries.
+func Fingerprint(cert *x509.Certificate, h crypto.Hash) (string, error) {
+	for id, candidate := range fingerprintHashes {
+		if candidate == h {
+			digest := h.New()
+			digest.Write(cert.Raw)
+			return formatHexString(append([]byte{id}, digest.Sum(nil)...)), nil
+		}
+	}
+	return "", fmt.Errorf("hash %s not supported in tls fingerprint", h)
+}
+
+func formatHexString(data []byte) string {
+	octets := make([]string, len(data))
+	for i, b := range data {
+		octets[i] = hex.EncodeToString([]byte{b})
+	}
+	return strings.Join(octets, ":")
+}
+
+func parseFingerprint(fingerprint string) (crypto.Hash, []byte, error) {
+	data, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid fingerprint '%s'. %w", fingerprint, err)
+	}
+	if len(data) < 2 {
+		return 0, nil, fmt.Errorf("fingerprint '%s' too short", fingerprint)
+	}
+	h, supported := fingerprintHashes[data[0]]
+	if !supported || !h.Available() {
+		return 0, nil, fmt.Errorf("fingerprint '%s' uses unsupported hash algorithm %d", fingerprint, data[0])
+	}
+	return h, data[1:], nil
+}
+
+func (entry *CertToName) matches(cert *x509.Certificate) (bool, error) {
+	h, expected, err := parseFingerprint(entry.Fingerprint)
+	if err != nil {
+		return false, err
+	}
+	digest := h.New()
+	digest.Write(cert.Raw)
+	return string(digest.Sum(nil)) == string(expected), nil
+}
+
+// name derives a name from the peer certificate according to map type. Returns empty
+// string if the certificate does not contain the data required.
+func (entry *CertToName) name(cert *x509.Certificate) string {
+	switch MapType(stripPrefix(entry.MapType)) {
+	case MapSpecified:
+		return entry.Name
+	case MapSanRfc822Name:
+		return sanRfc822Name(cert)
+	case MapSanDnsName:
+		return sanDnsName(cert)
+	case MapSanIpAddress:
+		return sanIpAddress(cert)
+	case MapSanAny:
+		if name := sanRfc822Name(cert); name != "" {
+			return name
+		}
+		if name := sanDnsName(cert); name != "" {
+			return name
+		}
+		return sanIpAddress(cert)
+	case MapCommonName:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+// identities may be given with module prefix e.g. x509c2n:specified
+func stripPrefix(ident string) string {
+	if colon := strings.IndexRune(ident, ':'); colon >= 0 {
+		return ident[colon+1:]
+	}
+	return ident
+}
+
+// host part is converted to lowercase, local part is left as is
+func sanRfc822Name(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) == 0 {
+		return ""
+	}
+	email := cert.EmailAddresses[0]
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		return email[:at] + strings.ToLower(email[at:])
+	}
+	return email
+}
+
+func sanDnsName(cert *x509.Certificate) string {
+	if len(cert.DNSNames) == 0 {
+		return ""
+	}
+	return strings.ToLower(cert.DNSNames[0])
+}
+
+// IPv4 is dotted quad, IPv6 is 32 lowercase hex characters w/o separators
+func sanIpAddress(cert *x509.Certificate) string {
+	if len(cert.IPAddresses) == 0 {
+		return ""
+	}
+	ip := cert.IPAddresses[0]
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return hex.EncodeToString(ip.To16())
+}
+
+// CertToNameMap searches cert-to-name entries to map a verified certificate chain
+// to a user name.
+type CertToNameMap []*CertToName
+
+// Name searches entries in id order for the first entry whose fingerprint matches the
+// peer certificate or one of the certificate authorities in the chain and that can
+// derive a name.
+//
+// chain[0] is the peer certificate followed by intermediate and root authorities.
+func (m CertToNameMap) Name(chain []*x509.Certificate) (*CertToName, string, error) {
+	if len(chain) == 0 {
+		return nil, "", nil
+	}
+	entries := make([]*CertToName, len(m))
+	copy(entries, m)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+	peer := chain[0]
+	for _, entry := range entries {
+		for _, cert := range chain {
+			matches, err := entry.matches(cert)
+			if err != nil {
+				return nil, "", err
+			}
+			if !matches {
+				continue
+			}
+			if name := entry.name(peer); name != "" {
+				return entry, name, nil
+			}
+			break
+		}
+	}
+	return nil, "", nil
+}
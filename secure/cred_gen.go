@@ -1,29 +1,150 @@
 package secure
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
 	"math/big"
+	"net"
 	"time"
 )
 
+type KeyType string
+
+const (
+	KeyRsa     KeyType = "rsa"
+	KeyEcdsa   KeyType = "ecdsa"
+	KeyEd25519 KeyType = "ed25519"
+)
+
+// DefaultValidity is used when generator has no validity set
+var DefaultValidity = 5 * 365 * 24 * time.Hour
+
+// Generator creates keys, certificates and revocation lists for a local PKI.
+// Zero value generates 2048 bit RSA keys valid for 5 years.
 type Generator struct {
 	Country      string
 	Organization string
+	CommonName   string
+
+	// Subject alternative names. Most TLS clients ignore common name and
+	// require a DNS or IP SAN that matches server address
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+
+	// Default is rsa
+	KeyType KeyType
+
+	// Default is 2048, only applicable to rsa keys
+	RsaBits int
+
+	// Default is P256, only applicable to ecdsa keys
+	Curve elliptic.Curve
+
+	// Default is DefaultValidity
+	Validity time.Duration
 }
 
 type Cert struct {
-	PrivateKey *rsa.PrivateKey
+	PrivateKey crypto.Signer
 	Cert       *x509.Certificate
 	Raw        []byte
 }
 
+// Decode reads PEM encoded private key and certificate. If certificate has no
+// private key, inKey can be nil.
 func Decode(inKey io.Reader, inCert io.Reader) (*Cert, error) {
-	return nil, nil
+	c := &Cert{}
+	data, err := io.ReadAll(inCert)
+	if err != nil {
+		return nil, err
+	}
+	if c.Cert, err = DecodeCert(data); err != nil {
+		return nil, err
+	}
+	c.Raw = c.Cert.Raw
+	if inKey != nil {
+		if data, err = io.ReadAll(inKey); err != nil {
+			return nil, err
+		}
+		if c.PrivateKey, err = DecodeKey(data); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// DecodeCert reads first certificate found in PEM data
+func DecodeCert(data []byte) (*x509.Certificate, error) {
+	block := findPemBlock(data, "CERTIFICATE")
+	if block == nil {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// DecodeCertRequest reads first certificate signing request found in PEM data
+func DecodeCertRequest(data []byte) (*x509.CertificateRequest, error) {
+	block := findPemBlock(data, "CERTIFICATE REQUEST")
+	if block == nil {
+		return nil, errors.New("no PEM encoded certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature. %w", err)
+	}
+	return csr, nil
+}
+
+// DecodeKey reads first private key found in PEM data. PKCS#1, PKCS#8 and
+// SEC 1 EC keys are supported.
+func DecodeKey(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return nil, errors.New("no PEM encoded private key found")
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, valid := key.(crypto.Signer)
+			if !valid {
+				return nil, fmt.Errorf("unsupported private key %T", key)
+			}
+			return signer, nil
+		}
+	}
+}
+
+func findPemBlock(data []byte, blockType string) *pem.Block {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil || block.Type == blockType {
+			return block
+		}
+	}
 }
 
 func (self *Cert) EncodeCert(out io.Writer) error {
@@ -31,69 +152,247 @@ func (self *Cert) EncodeCert(out io.Writer) error {
 }
 
 func (self *Cert) EncodeKey(out io.Writer) error {
-	raw := x509.MarshalPKCS1PrivateKey(self.PrivateKey)
-	return pem.Encode(out, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: raw})
+	if rsaKey, isRsa := self.PrivateKey.(*rsa.PrivateKey); isRsa {
+		raw := x509.MarshalPKCS1PrivateKey(rsaKey)
+		return pem.Encode(out, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: raw})
+	}
+	raw, err := x509.MarshalPKCS8PrivateKey(self.PrivateKey)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(out, &pem.Block{Type: "PRIVATE KEY", Bytes: raw})
+}
+
+func EncodeCRL(out io.Writer, raw []byte) error {
+	return pem.Encode(out, &pem.Block{Type: "X509 CRL", Bytes: raw})
+}
+
+func (self *Generator) key() (crypto.Signer, error) {
+	switch self.KeyType {
+	case "", KeyRsa:
+		bits := self.RsaBits
+		if bits == 0 {
+			bits = 2048
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case KeyEcdsa:
+		curve := self.Curve
+		if curve == nil {
+			curve = elliptic.P256()
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case KeyEd25519:
+		_, pvtKey, err := ed25519.GenerateKey(rand.Reader)
+		return pvtKey, err
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", self.KeyType)
 }
 
 func (self *Generator) CA() (*Cert, error) {
-	pvtKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	pvtKey, err := self.key()
+	if err != nil {
+		return nil, err
+	}
+	template, err := self.template(pvtKey.Public())
 	if err != nil {
 		return nil, err
 	}
-	pubKey := &pvtKey.PublicKey
-
-	template := self.template()
 	template.IsCA = true
-	template.KeyUsage |= x509.KeyUsageCertSign
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
 
-	// self-signed
-	parent := template
+	// CA can sign certificates for any purpose
+	template.ExtKeyUsage = nil
 
-	raw, err := x509.CreateCertificate(rand.Reader, template, parent, pubKey, pvtKey)
+	// self-signed
+	c, err := self.sign(template, &Cert{Cert: template, PrivateKey: pvtKey}, pvtKey.Public())
 	if err != nil {
 		return nil, err
 	}
-	return &Cert{
-		PrivateKey: pvtKey,
-		Cert:       template,
-		Raw:        raw,
-	}, nil
+	c.PrivateKey = pvtKey
+	return c, nil
 }
 
-func (self *Generator) template() *x509.Certificate {
+func (self *Generator) template(pubKey crypto.PublicKey) (*x509.Certificate, error) {
+	serial, err := SerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	keyId, err := subjectKeyId(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	validity := self.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	subject := pkix.Name{
+		CommonName: self.CommonName,
+	}
+	if self.Country != "" {
+		subject.Country = []string{self.Country}
+	}
+	if self.Organization != "" {
+		subject.Organization = []string{self.Organization}
+	}
+	usage := x509.KeyUsageDigitalSignature
+	if _, isRsa := pubKey.(*rsa.PublicKey); isRsa {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
+	now := time.Now()
 	return &x509.Certificate{
 		BasicConstraintsValid: true,
-		SubjectKeyId:          []byte{1, 2, 3},
-		SerialNumber:          big.NewInt(1234),
-		Subject: pkix.Name{
-			Country:      []string{self.Country},
-			Organization: []string{self.Organization},
-		},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().AddDate(5, 0, 0),
-		KeyUsage:  x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		SubjectKeyId:          keyId,
+		SerialNumber:          serial,
+		Subject:               subject,
+		DNSNames:              self.DNSNames,
+		IPAddresses:           self.IPAddresses,
+		EmailAddresses:        self.EmailAddresses,
+
+		// allow for some clock skew between machines
+		NotBefore: now.Add(-5 * time.Minute),
+		NotAfter:  now.Add(validity),
+		KeyUsage:  usage,
 		ExtKeyUsage: []x509.ExtKeyUsage{
 			x509.ExtKeyUsageServerAuth,
 		},
+	}, nil
+}
+
+// SerialNumber is random 128-bit number as recommended by CA/Browser forum
+func SerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, limit)
+}
+
+// RFC5280 Section 4.2.1.2 method (1)
+func subjectKeyId(pubKey crypto.PublicKey) ([]byte, error) {
+	raw, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(raw, &spki); err != nil {
+		return nil, err
 	}
+	id := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return id[:], nil
 }
 
+func (self *Generator) sign(template *x509.Certificate, parent *Cert, pubKey crypto.PublicKey) (*Cert, error) {
+	if parent.PrivateKey == nil {
+		return nil, errors.New("parent certificate has no private key to sign with")
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent.Cert, pubKey, parent.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &Cert{
+		Cert: cert,
+		Raw:  raw,
+	}, nil
+}
+
+// Cert generates a new key and a certificate for server and client authentication
+// signed by parent.
 func (self *Generator) Cert(parent *Cert) (*Cert, error) {
-	pvtKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	pvtKey, err := self.key()
+	if err != nil {
+		return nil, err
+	}
+	template, err := self.template(pvtKey.Public())
 	if err != nil {
 		return nil, err
 	}
-	pubKey := &pvtKey.PublicKey
-	template := self.template()
 	template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	c, err := self.sign(template, parent, pvtKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	c.PrivateKey = pvtKey
+	return c, nil
+}
 
-	raw, err := x509.CreateCertificate(rand.Reader, template, parent.Cert, pubKey, pvtKey)
+// SignRequest issues a certificate for a certificate signing request. Subject and
+// subject alternative names come from request unless set in generator.
+func (self *Generator) SignRequest(parent *Cert, csr *x509.CertificateRequest) (*Cert, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature. %w", err)
+	}
+	template, err := self.template(csr.PublicKey)
 	if err != nil {
 		return nil, err
 	}
-	return &Cert{
-		PrivateKey: pvtKey,
-		Cert:       template,
-		Raw:        raw,
-	}, nil
+	if self.CommonName == "" && self.Country == "" && self.Organization == "" {
+		template.Subject = csr.Subject
+	}
+	if len(template.DNSNames) == 0 {
+		template.DNSNames = csr.DNSNames
+	}
+	if len(template.IPAddresses) == 0 {
+		template.IPAddresses = csr.IPAddresses
+	}
+	if len(template.EmailAddresses) == 0 {
+		template.EmailAddresses = csr.EmailAddresses
+	}
+	template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	return self.sign(template, parent, csr.PublicKey)
+}
+
+// CertRequest creates a certificate signing request with new key from generator
+// settings. Useful for devices that keep their private key to themselves.
+func (self *Generator) CertRequest() (crypto.Signer, []byte, error) {
+	pvtKey, err := self.key()
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := self.template(pvtKey.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        template.Subject,
+		DNSNames:       template.DNSNames,
+		IPAddresses:    template.IPAddresses,
+		EmailAddresses: template.EmailAddresses,
+	}, pvtKey)
+	return pvtKey, raw, err
+}
+
+func EncodeCertRequest(out io.Writer, raw []byte) error {
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: raw})
+}
+
+// Revoked identifies a certificate that is no longer valid
+type Revoked struct {
+	SerialNumber *big.Int
+	RevokedAt    time.Time
+}
+
+// CRL generates a DER encoded certificate revocation list signed by parent that is
+// valid until nextUpdate.  Number should increase with each new list.
+func (self *Generator) CRL(parent *Cert, revoked []Revoked, number int64, nextUpdate time.Time) ([]byte, error) {
+	if parent.PrivateKey == nil {
+		return nil, errors.New("parent certificate has no private key to sign with")
+	}
+	entries := make([]pkix.RevokedCertificate, len(revoked))
+	for i, r := range revoked {
+		entries[i] = pkix.RevokedCertificate{
+			SerialNumber:   r.SerialNumber,
+			RevocationTime: r.RevokedAt,
+		}
+	}
+	template := &x509.RevocationList{
+		RevokedCertificates: entries,
+		Number:              big.NewInt(number),
+		ThisUpdate:          time.Now(),
+		NextUpdate:          nextUpdate,
+	}
+	return x509.CreateRevocationList(rand.Reader, template, parent.Cert, parent.PrivateKey)
 }
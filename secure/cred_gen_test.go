@@ -1,25 +1,88 @@
 package secure
 
-import "testing"
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+)
 
 func TestGenCa(t *testing.T) {
-	g := &Generator{
-		Country:      "US",
-		Organization: "Engineering",
+	for _, keyType := range []KeyType{KeyRsa, KeyEcdsa, KeyEd25519} {
+		t.Log(keyType)
+		g := &Generator{
+			Country:      "US",
+			Organization: "Engineering",
+			KeyType:      keyType,
+		}
+		ca, err := g.CA()
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, true, ca.Cert.IsCA)
+
+		g.CommonName = "device"
+		g.DNSNames = []string{"device.example.com"}
+		g.IPAddresses = []net.IP{net.ParseIP("10.0.0.1")}
+		g.Validity = time.Hour
+		c, err := g.Cert(ca)
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, "device.example.com", c.Cert.DNSNames[0])
+		fc.AssertEqual(t, true, c.Cert.NotAfter.Before(time.Now().Add(2*time.Hour)))
+		fc.AssertEqual(t, false, bytes.Equal(ca.Cert.SubjectKeyId, c.Cert.SubjectKeyId))
+		fc.AssertEqual(t, false, ca.Cert.SerialNumber.Cmp(c.Cert.SerialNumber) == 0)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Cert)
+		_, err = c.Cert.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			DNSName:   "device.example.com",
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		fc.AssertEqual(t, nil, err)
+
+		var keyPem, certPem bytes.Buffer
+		fc.RequireEqual(t, nil, c.EncodeKey(&keyPem))
+		fc.RequireEqual(t, nil, c.EncodeCert(&certPem))
+		decoded, err := Decode(&keyPem, &certPem)
+		fc.RequireEqual(t, nil, err)
+		fc.AssertEqual(t, true, decoded.Cert.Equal(c.Cert))
+		fc.AssertEqual(t, true, samePublicKey(decoded.PrivateKey.Public(), c.PrivateKey.Public()))
 	}
+}
+
+func TestSignRequest(t *testing.T) {
+	g := &Generator{KeyType: KeyEcdsa}
 	ca, err := g.CA()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if len(ca.Raw) == 0 {
-		t.Error(len(ca.Raw))
-	}
+	fc.RequireEqual(t, nil, err)
 
-	c, err := g.Cert(ca)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if len(c.Raw) == 0 {
-		t.Error(len(c.Raw))
-	}
+	device := &Generator{KeyType: KeyEcdsa, CommonName: "device", DNSNames: []string{"device"}}
+	key, raw, err := device.CertRequest()
+	fc.RequireEqual(t, nil, err)
+	var csrPem bytes.Buffer
+	fc.RequireEqual(t, nil, EncodeCertRequest(&csrPem, raw))
+	csr, err := DecodeCertRequest(csrPem.Bytes())
+	fc.RequireEqual(t, nil, err)
+
+	c, err := g.SignRequest(ca, csr)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, nil, c.PrivateKey)
+	fc.AssertEqual(t, "device", c.Cert.Subject.CommonName)
+	fc.AssertEqual(t, "device", c.Cert.DNSNames[0])
+	fc.AssertEqual(t, nil, c.Cert.CheckSignatureFrom(ca.Cert))
+	fc.AssertEqual(t, true, samePublicKey(key.Public(), c.Cert.PublicKey))
+
+	raw, err = g.CRL(ca, []Revoked{{SerialNumber: c.Cert.SerialNumber, RevokedAt: time.Now()}}, 1, time.Now().Add(time.Hour))
+	fc.RequireEqual(t, nil, err)
+	crl, err := x509.ParseRevocationList(raw)
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, nil, crl.CheckSignatureFrom(ca.Cert))
+	fc.AssertEqual(t, 1, len(crl.RevokedCertificates))
+	fc.AssertEqual(t, 0, crl.RevokedCertificates[0].SerialNumber.Cmp(c.Cert.SerialNumber))
+}
+
+func samePublicKey(a crypto.PublicKey, b crypto.PublicKey) bool {
+	return a.(interface{ Equal(crypto.PublicKey) bool }).Equal(b)
 }
@@ -1,6 +1,8 @@
 package secure
 
 import (
+	"time"
+
 	"github.com/freeconf/yang/val"
 
 	"github.com/freeconf/yang/node"
@@ -11,11 +13,26 @@ func Manage(rbac *Rbac) node.Node {
 	return &nodeutil.Node{
 		Object: rbac,
 		Options: nodeutil.NodeOptions{
-			TryPluralOnLists: true,
+			TryPluralOnLists:    true,
+			IdentitiesAsStrings: true,
 		},
 		OnChild: func(n *nodeutil.Node, r node.ChildRequest) (node.Node, error) {
 			switch r.Meta.Ident() {
 			case "authentication":
+				if r.New {
+					rbac.Authentication = &CertHandler{}
+				}
+				if rbac.Authentication != nil {
+					return n.New(r.Meta, rbac.Authentication)
+				}
+				return nil, nil
+			case "pki":
+				if r.New {
+					rbac.Pki = &Pki{}
+				}
+				if rbac.Pki != nil {
+					return n.New(r.Meta, rbac.Pki)
+				}
 				return nil, nil
 			case "authorization":
 				return n, nil
@@ -34,8 +51,81 @@ func Manage(rbac *Rbac) node.Node {
 					return err
 				}
 				return nil
+			case "country", "organization", "key-type", "validity-days":
+				return pkiField(n.Object.(*Pki), r, hnd)
 			}
 			return n.DoField(r, hnd)
 		},
+		OnAction: func(n *nodeutil.Node, r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "issue-certificate":
+				var req IssueRequest
+				if r.Input != nil {
+					in := &nodeutil.Node{
+						Object:  &req,
+						Options: nodeutil.NodeOptions{EnumAsStrings: true},
+					}
+					if err := r.Input.UpsertInto(in); err != nil {
+						return nil, err
+					}
+				}
+				resp, err := n.Object.(*Pki).Issue(req)
+				if err != nil {
+					return nil, err
+				}
+				return &nodeutil.Node{Object: resp}, nil
+			case "revoke-certificate":
+				serial, err := r.Input.GetValue("serial-number")
+				if err != nil {
+					return nil, err
+				}
+				crl, err := n.Object.(*Pki).Revoke(serial.String())
+				if err != nil {
+					return nil, err
+				}
+				return &nodeutil.Node{Object: &struct{ Crl string }{Crl: crl}}, nil
+			}
+			return n.DoAction(r)
+		},
+	}
+}
+
+func pkiField(pki *Pki, r node.FieldRequest, hnd *node.ValueHandle) error {
+	g := &pki.Generator
+	if r.Write {
+		switch r.Meta.Ident() {
+		case "country":
+			g.Country = hnd.Val.String()
+		case "organization":
+			g.Organization = hnd.Val.String()
+		case "key-type":
+			g.KeyType = KeyType(hnd.Val.(val.Enum).Label)
+		case "validity-days":
+			g.Validity = time.Duration(hnd.Val.Value().(uint)) * 24 * time.Hour
+		}
+		return nil
+	}
+	var v any
+	switch r.Meta.Ident() {
+	case "country":
+		v = g.Country
+	case "organization":
+		v = g.Organization
+	case "key-type":
+		if g.KeyType == "" {
+			return nil
+		}
+		v = string(g.KeyType)
+	case "validity-days":
+		if g.Validity == 0 {
+			return nil
+		}
+		v = int(g.Validity / (24 * time.Hour))
+	}
+	if v == "" {
+		return nil
 	}
+	var err error
+	hnd.Val, err = node.NewValue(r.Meta.Type(), v)
+	return err
 }
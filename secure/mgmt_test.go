@@ -1,7 +1,10 @@
 package secure
 
 import (
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/source"
@@ -13,10 +16,23 @@ import (
 
 func TestManage(t *testing.T) {
 	a := NewRbac()
-	ypath := source.Dir("../yang")
+	ypath := source.Any(source.Dir("../yang"), source.Dir("../yang/ietf-rfc"))
 	b := node.NewBrowser(parser.RequireModule(ypath, "fc-secure"), Manage(a))
 	err := b.Root().UpsertFrom(readJson(`{
+		"authentication" : {
+			"cert-to-name" : [{
+				"id" : 1,
+				"fingerprint" : "04:ab:cd",
+				"map-type" : "x509c2n:specified",
+				"name" : "admin"
+			},{
+				"id" : 2,
+				"fingerprint" : "04:ab:cd",
+				"map-type" : "x509c2n:san-dns-name"
+			}]
+		},
 		"authorization" : {
+			"anonymous" : "sales",
 			"role" : [{
 				"id" : "sales",
 				"access" : [{
@@ -36,6 +52,9 @@ func TestManage(t *testing.T) {
 		t.Fatal(err)
 	}
 	fc.AssertEqual(t, 1, len(a.Roles))
+	fc.AssertEqual(t, "sales", a.Anonymous)
+	fc.AssertEqual(t, 2, len(a.Authentication.CertToName))
+	fc.AssertEqual(t, "admin", a.Authentication.CertToName[0].Name)
 	//fc.AssertEqual(t, 3, len(a.Roles["sales"].Access))
 }
 
@@ -46,3 +65,54 @@ func readJson(s string) node.Node {
 	}
 	return n
 }
+
+func TestManagePki(t *testing.T) {
+	dir := t.TempDir()
+	a := NewRbac()
+	ypath := source.Any(source.Dir("../yang"), source.Dir("../yang/ietf-rfc"))
+	b := node.NewBrowser(parser.RequireModule(ypath, "fc-secure"), Manage(a))
+	err := b.Root().UpsertFrom(readJson(fmt.Sprintf(`{
+		"pki" : {
+			"cert-file" : "%[1]s/ca.crt",
+			"key-file" : "%[1]s/ca.key",
+			"crl-file" : "%[1]s/ca.crl",
+			"organization" : "Engineering",
+			"key-type" : "ecdsa",
+			"validity-days" : 30
+		}
+	}`, dir)))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, KeyEcdsa, a.Pki.Generator.KeyType)
+	fc.AssertEqual(t, 30*24*time.Hour, a.Pki.Generator.Validity)
+
+	sel, err := b.Root().Find("pki/issue-certificate")
+	fc.RequireEqual(t, nil, err)
+	out, err := sel.Action(readJson(`{
+		"common-name" : "device",
+		"dns-name" : ["device.example.com"],
+		"ip-address" : ["10.0.0.1"]
+	}`))
+	fc.RequireEqual(t, nil, err)
+	var issued Issued
+	fc.RequireEqual(t, nil, out.UpsertInto(&nodeutil.Node{Object: &issued}))
+	cert, err := DecodeCert([]byte(issued.Certificate))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, nil, cert.CheckSignatureFrom(a.Pki.CA.Cert))
+	fc.AssertEqual(t, "10.0.0.1", cert.IPAddresses[0].String())
+	_, err = DecodeKey([]byte(issued.PrivateKey))
+	fc.AssertEqual(t, nil, err)
+
+	_, err = os.Stat(dir + "/ca.key")
+	fc.AssertEqual(t, nil, err)
+
+	sel, err = b.Root().Find("pki/revoke-certificate")
+	fc.RequireEqual(t, nil, err)
+	_, err = sel.Action(readJson(fmt.Sprintf(`{"serial-number":"%s"}`, issued.SerialNumber)))
+	fc.RequireEqual(t, nil, err)
+
+	// restart keeps ca and revocations
+	reloaded := &Pki{CertFile: dir + "/ca.crt", KeyFile: dir + "/ca.key", CrlFile: dir + "/ca.crl"}
+	fc.RequireEqual(t, nil, reloaded.load())
+	fc.AssertEqual(t, true, reloaded.CA.Cert.Equal(a.Pki.CA.Cert))
+	fc.AssertEqual(t, 1, len(reloaded.revoked))
+}
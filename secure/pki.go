@@ -0,0 +1,247 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+)
+
+// Pki is a local certificate authority to issue and revoke device certificates
+// from a running server.
+type Pki struct {
+	// PEM encoded CA certificate and private key.  If files do not exist, a new
+	// CA is generated and written to these files
+	CertFile string
+	KeyFile  string
+
+	// Optional: PEM encoded revocation list is written here each time a
+	// certificate is revoked
+	CrlFile string
+
+	// Settings for generated CA and default settings for issued certificates
+	Generator Generator
+
+	// Set directly to skip loading from files
+	CA *Cert
+
+	// How long a revocation list is valid for. Default is 1 week
+	CrlValidity time.Duration
+
+	revoked   []Revoked
+	crlNumber int64
+	mu        sync.Mutex
+}
+
+// IssueRequest describes certificate to issue.  When Csr is given, device keeps
+// private key to itself, otherwise a new key is generated.
+type IssueRequest struct {
+	CommonName     string
+	DNSNames       []string `yang:"dns-name"`
+	IPAddresses    []string `yang:"ip-address"`
+	EmailAddresses []string `yang:"email-address"`
+	KeyType        string
+	ValidityDays   uint
+
+	// PEM encoded certificate signing request
+	Csr string
+}
+
+// Issued is PEM encoded certificate and, unless issued from CSR, its private key
+type Issued struct {
+	Certificate  string
+	PrivateKey   string
+	SerialNumber string
+}
+
+func (self *Pki) load() error {
+	if self.CA != nil {
+		return nil
+	}
+	if self.CertFile == "" || self.KeyFile == "" {
+		return errors.New("no certificate authority configured")
+	}
+	certData, certErr := os.ReadFile(self.CertFile)
+	keyData, keyErr := os.ReadFile(self.KeyFile)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		return self.create()
+	}
+	if certErr != nil {
+		return certErr
+	}
+	if keyErr != nil {
+		return keyErr
+	}
+	ca, err := Decode(bytes.NewReader(keyData), bytes.NewReader(certData))
+	if err != nil {
+		return fmt.Errorf("could not load certificate authority from %s. %w", self.CertFile, err)
+	}
+	self.CA = ca
+	return self.loadCrl()
+}
+
+// keep revocations across restarts
+func (self *Pki) loadCrl() error {
+	if self.CrlFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(self.CrlFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	block := findPemBlock(data, "X509 CRL")
+	if block == nil {
+		return fmt.Errorf("no PEM encoded revocation list in %s", self.CrlFile)
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return err
+	}
+	if err = crl.CheckSignatureFrom(self.CA.Cert); err != nil {
+		return fmt.Errorf("revocation list %s not signed by certificate authority. %w", self.CrlFile, err)
+	}
+	for _, r := range crl.RevokedCertificates {
+		self.revoked = append(self.revoked, Revoked{SerialNumber: r.SerialNumber, RevokedAt: r.RevocationTime})
+	}
+	if crl.Number != nil {
+		self.crlNumber = crl.Number.Int64()
+	}
+	return nil
+}
+
+func (self *Pki) create() error {
+	fc.Debug.Printf("generating certificate authority %s", self.CertFile)
+	ca, err := self.Generator.CA()
+	if err != nil {
+		return err
+	}
+	var certPem, keyPem bytes.Buffer
+	if err = ca.EncodeCert(&certPem); err != nil {
+		return err
+	}
+	if err = ca.EncodeKey(&keyPem); err != nil {
+		return err
+	}
+	if err = os.WriteFile(self.KeyFile, keyPem.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err = os.WriteFile(self.CertFile, certPem.Bytes(), 0644); err != nil {
+		return err
+	}
+	self.CA = ca
+	return nil
+}
+
+// Issue signs a new certificate with certificate authority
+func (self *Pki) Issue(req IssueRequest) (*Issued, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.load(); err != nil {
+		return nil, err
+	}
+	g := self.Generator
+	g.CommonName = req.CommonName
+	g.DNSNames = req.DNSNames
+	g.EmailAddresses = req.EmailAddresses
+	g.IPAddresses = nil
+	for _, s := range req.IPAddresses {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%w. invalid ip address '%s'", fc.BadRequestError, s)
+		}
+		g.IPAddresses = append(g.IPAddresses, ip)
+	}
+	if req.KeyType != "" {
+		g.KeyType = KeyType(req.KeyType)
+	}
+	if req.ValidityDays > 0 {
+		g.Validity = time.Duration(req.ValidityDays) * 24 * time.Hour
+	}
+	var c *Cert
+	var err error
+	if req.Csr != "" {
+		csr, csrErr := DecodeCertRequest([]byte(req.Csr))
+		if csrErr != nil {
+			return nil, fmt.Errorf("%w. %s", fc.BadRequestError, csrErr)
+		}
+		c, err = g.SignRequest(self.CA, csr)
+	} else {
+		c, err = g.Cert(self.CA)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &Issued{
+		SerialNumber: c.Cert.SerialNumber.Text(16),
+	}
+	var buf bytes.Buffer
+	if err = c.EncodeCert(&buf); err != nil {
+		return nil, err
+	}
+	resp.Certificate = buf.String()
+	if c.PrivateKey != nil {
+		buf.Reset()
+		if err = c.EncodeKey(&buf); err != nil {
+			return nil, err
+		}
+		resp.PrivateKey = buf.String()
+	}
+	return resp, nil
+}
+
+// Revoke adds certificate to revocation list and returns new PEM encoded list.
+// Serial number is in hex.
+func (self *Pki) Revoke(serialNumber string) (string, error) {
+	serial, valid := new(big.Int).SetString(serialNumber, 16)
+	if !valid {
+		return "", fmt.Errorf("%w. invalid serial number '%s'", fc.BadRequestError, serialNumber)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.load(); err != nil {
+		return "", err
+	}
+	self.revoked = append(self.revoked, Revoked{SerialNumber: serial, RevokedAt: time.Now()})
+	return self.crl()
+}
+
+// CRL is current PEM encoded revocation list
+func (self *Pki) CRL() (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.load(); err != nil {
+		return "", err
+	}
+	return self.crl()
+}
+
+func (self *Pki) crl() (string, error) {
+	validity := self.CrlValidity
+	if validity == 0 {
+		validity = 7 * 24 * time.Hour
+	}
+	self.crlNumber++
+	raw, err := self.Generator.CRL(self.CA, self.revoked, self.crlNumber, time.Now().Add(validity))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = EncodeCRL(&buf, raw); err != nil {
+		return "", err
+	}
+	if self.CrlFile != "" {
+		if err = os.WriteFile(self.CrlFile, buf.Bytes(), 0644); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
@@ -10,6 +10,16 @@ type Auth interface {
 // to be both useful and example of more complex implementations
 type Rbac struct {
 	Roles map[string]*Role
+
+	// Optional: role for requests without a user name like clients that did
+	// not present a certificate. Such requests have no access when empty.
+	Anonymous string
+
+	// Optional: map client certificates to user names
+	Authentication *CertHandler
+
+	// Optional: local certificate authority to issue device certificates
+	Pki *Pki
 }
 
 func NewRbac() *Rbac {
@@ -19,9 +29,18 @@ func NewRbac() *Rbac {
 }
 
 func (self *Rbac) ConstrainRoot(role string, c *node.Constraints) {
-	r, found := self.Roles[role]
+	r, found := self.role(role)
 	if !found {
 		r = noAccess
 	}
 	c.AddConstraint("auth", 0, 0, r)
 }
+
+// role finds role by name where unnamed role is anonymous role if one is set
+func (self *Rbac) role(name string) (*Role, bool) {
+	if name == "" && self.Anonymous != "" {
+		name = self.Anonymous
+	}
+	r, found := self.Roles[name]
+	return r, found
+}
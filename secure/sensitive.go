@@ -0,0 +1,87 @@
+package secure
+
+import (
+	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/val"
+)
+
+// Mask replaces values of sensitive leaves in logs and responses
+const Mask = "****"
+
+// Revealer is optionally implemented by Auth to let roles see values of
+// sensitive leaves.
+type Revealer interface {
+	Reveal(role string, m meta.Meta) bool
+}
+
+// Sensitive returns the definition marked as sensitive either by itself or by
+// one of its ancestors, nil otherwise.  Definitions are sensitive when marked
+// with nacm:default-deny-all from ietf-netconf-acm or sensitive extension from
+// fc-secure.
+func Sensitive(m meta.Meta) meta.Meta {
+	for p := m; p != nil; p = p.Parent() {
+		if _, isModule := p.(*meta.Module); isModule {
+			break
+		}
+		for _, x := range p.Extensions() {
+			if isSensitiveExtension(x) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func IsSensitive(m meta.Meta) bool {
+	return Sensitive(m) != nil
+}
+
+func isSensitiveExtension(x *meta.Extension) bool {
+	if x.Keyword() != "" {
+		// extension of a statement like description, not of the definition
+		return false
+	}
+	def := x.ExtDefinition()
+	if def == nil {
+		return false
+	}
+	mod, valid := def.Parent().(*meta.Module)
+	if !valid {
+		return false
+	}
+	switch mod.Ident() {
+	case "ietf-netconf-acm":
+		return def.Ident() == "default-deny-all"
+	case "fc-secure":
+		return def.Ident() == "sensitive"
+	}
+	return false
+}
+
+// MaskValue keeps value a list if value was a list so output is still
+// well-formed
+func MaskValue(v val.Value) val.Value {
+	if l, isList := v.(val.Listable); isList {
+		masked := make([]string, l.Len())
+		for i := range masked {
+			masked[i] = Mask
+		}
+		return val.StringList(masked)
+	}
+	return val.String(Mask)
+}
+
+// Reveal only when role has access control on the sensitive definition itself,
+// access inherited from parents is not enough.
+func (self *Rbac) Reveal(role string, m meta.Meta) bool {
+	r, found := self.role(role)
+	if !found {
+		return false
+	}
+	target := Sensitive(m)
+	if target == nil {
+		return true
+	}
+	acl, found := r.Access[meta.SchemaPath(target)]
+	return found && acl.Permissions >= Read
+}
@@ -15,11 +15,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/freeconf/restconf/audit"
 	"github.com/freeconf/restconf/device"
 	"github.com/freeconf/restconf/secure"
 	"github.com/freeconf/restconf/stock"
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/meta"
+	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
 	"github.com/freeconf/yang/parser"
 	"github.com/freeconf/yang/source"
@@ -28,7 +30,6 @@ import (
 type Server struct {
 	Web                      *stock.HttpServer
 	webApps                  []webApp
-	Auth                     secure.Auth
 	Ver                      string
 	NotifyKeepaliveTimeoutMs int
 	main                     device.Device
@@ -39,10 +40,30 @@ type Server struct {
 	// Optional: Anything not handled by RESTCONF protocol can call this handler otherwise
 	UnhandledRequestHandler http.HandlerFunc
 
+	// Optional: authorizes every request by user name. Clients that present no
+	// certificate have no user name and so no access unless Rbac.Anonymous is set
+	Auth secure.Auth
+
+	// Optional: record of every edit, rpc and subscription
+	Audit *audit.Log
+
+	// Optional: forward requests for devices in device map as is
+	Gateway *Gateway
+
+	// Optional: save running config of main device
+	Persist *device.Persist
+
 	// Give app change to read custom header data and stuff into context so info can get
 	// to app layer
 	Filters []RequestFilter
 
+	// Optional: called before every edit to any module and can veto it. Edits
+	// to candidate are seen when they are committed.
+	PreCommit []EditHook
+
+	// Optional: called after every successful edit to any module
+	PostCommit []EditHook
+
 	// allow rpc to serve under /restconf/data/{module:}/{rpc} which while intuative and
 	// original design, it is not in compliance w/RESTCONF spec
 	OnlyStrictCompliance bool
@@ -66,6 +87,8 @@ func NewHttpServe(d *device.Local) *Server {
 		ypath:     d.SchemaSource(),
 	}
 	m.ServeDevice(d)
+	d.OnPreReplace(m.preReplace)
+	d.OnPostReplace(m.postReplace)
 
 	// Required by all devices according to RFC
 	if err := d.Add("ietf-yang-library", device.LocalDeviceYangLibNode(m.ModuleAddress, d)); err != nil {
@@ -101,6 +124,22 @@ func (srv *Server) ServeDevice(d device.Device) error {
 	return nil
 }
 
+// certHandler is client certificate authentication of Auth, if any, using
+// certificate authorities of server unless it has its own
+func (srv *Server) certHandler() *secure.CertHandler {
+	rbac, valid := srv.Auth.(*secure.Rbac)
+	if !valid || rbac.Authentication == nil {
+		return nil
+	}
+	h := rbac.Authentication
+	if h.Authority == nil && srv.Web != nil && srv.Web.Options().Tls != nil {
+		copy := *h
+		copy.Authority = srv.Web.Options().Tls
+		return &copy
+	}
+	return h
+}
+
 func (srv *Server) determineCompliance(r *http.Request, contentType MimeType, acceptType MimeType) ComplianceOptions {
 	if srv.OnlyStrictCompliance {
 		return Strict
@@ -125,17 +164,12 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := context.WithValue(r.Context(), ComplianceContextKey, compliance)
 	if fc.DebugLogEnabled() {
 		fc.Debug.Printf("%s %s", r.Method, r.URL)
-		if r.Body != nil {
-			content, rerr := ioutil.ReadAll(r.Body)
-			defer r.Body.Close()
-			if rerr != nil {
-				fc.Err.Printf("error trying to log body content %s", rerr)
-			} else {
-				if len(content) > 0 {
-					fc.Debug.Print(string(content))
-					r.Body = ioutil.NopCloser(bytes.NewBuffer(content))
-				}
-			}
+	}
+	if h := srv.certHandler(); h != nil {
+		var err error
+		if ctx, err = h.Filter(ctx, w, r); err != nil {
+			handleErr(compliance, err, r, w, acceptType)
+			return
 		}
 	}
 	for _, f := range srv.Filters {
@@ -170,6 +204,24 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		handleErr(compliance, err, r, w, acceptType)
 		return
 	}
+	if fc.DebugLogEnabled() && r.Body != nil {
+		// body is logged once device is known so sensitive values can be masked
+		content, rerr := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if rerr != nil {
+			fc.Err.Printf("error trying to log body content %s", rerr)
+		} else {
+			if len(content) > 0 {
+				fc.Debug.Print(redactBody(device, contentType, content))
+				r.Body = ioutil.NopCloser(bytes.NewBuffer(content))
+			}
+		}
+	}
+	if op1 == "restconf" && deviceId != "" && srv.Gateway != nil && srv.canForward(device) {
+		if srv.Gateway.forward(w, r, deviceId, device, p) {
+			return
+		}
+	}
 	switch op1 {
 	case ".ver":
 		w.Write([]byte(srv.Ver))
@@ -182,11 +234,20 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL = p
 		switch op2 {
 		case "data":
-			srv.serve(compliance, ctx, device, w, r, endpointData, acceptType)
+			srv.serve(compliance, ctx, deviceId, device, w, r, endpointData, acceptType)
+		case "ds":
+			ds, p := shift(p, '/')
+			r.URL = p
+			dsDevice, err := srv.datastore(device, ds)
+			if err != nil {
+				handleErr(compliance, err, r, w, acceptType)
+				return
+			}
+			srv.serve(compliance, ctx, deviceId, dsDevice, w, r, endpointData, acceptType)
 		case "streams":
-			srv.serve(compliance, ctx, device, w, r, endpointStreams, acceptType)
+			srv.serve(compliance, ctx, deviceId, device, w, r, endpointStreams, acceptType)
 		case "operations":
-			srv.serve(compliance, ctx, device, w, r, endpointOperations, acceptType)
+			srv.serve(compliance, ctx, deviceId, device, w, r, endpointOperations, acceptType)
 		case "ui":
 			srv.serveStreamSource(compliance, r, w, device.UiSource(), r.URL.Path, acceptType)
 		case "schema":
@@ -237,8 +298,8 @@ func (srv *Server) serveSchema(compliance ComplianceOptions, ctx context.Context
 	hndlr.ServeHTTP(compliance, ctx, w, r, endpointSchema)
 }
 
-func (srv *Server) serve(compliance ComplianceOptions, ctx context.Context, d device.Device, w http.ResponseWriter, r *http.Request, endpointId int, accept MimeType) {
-	if hndlr, p := srv.shiftBrowserHandler(compliance, r, d, w, r.URL, accept); hndlr != nil {
+func (srv *Server) serve(compliance ComplianceOptions, ctx context.Context, deviceId string, d device.Device, w http.ResponseWriter, r *http.Request, endpointId int, accept MimeType) {
+	if hndlr, p := srv.shiftBrowserHandler(compliance, ctx, r, deviceId, d, d, "", w, r.URL, accept); hndlr != nil {
 		r.URL = p
 		hndlr.ServeHTTP(compliance, ctx, w, r, endpointId)
 	}
@@ -358,12 +419,49 @@ func (srv *Server) findDevice(deviceId string) (device.Device, error) {
 	return device, nil
 }
 
-func (srv *Server) shiftBrowserHandler(compliance ComplianceOptions, r *http.Request, d device.Device, w http.ResponseWriter, orig *url.URL, accept MimeType) (*browserHandler, *url.URL) {
+// shiftBrowserHandler finds handler for module in path following mount points
+// where root is device request is for and mount is path to mount point d is
+// mounted at, if any. Edits under mount points are edits to root.
+func (srv *Server) shiftBrowserHandler(compliance ComplianceOptions, ctx context.Context, r *http.Request, deviceId string, root device.Device, d device.Device, mount string, w http.ResponseWriter, orig *url.URL, accept MimeType) (*browserHandler, *url.URL) {
 	if module, p := shift(orig, ':'); module != "" {
-		if browser, err := d.Browser(module); browser != nil {
-			return &browserHandler{
-				browser: browser,
-			}, p
+		browser, err := d.Browser(module)
+		if browser == nil && err == nil && module == "ietf-yang-library" {
+			// Required by all devices according to RFC but not every device
+			// registers it
+			browser, err = srv.yangLibBrowser(d)
+		}
+		if browser != nil {
+			mounted, at, rest, err := srv.findMount(ctx, d, browser, p)
+			if err != nil {
+				handleErr(compliance, err, r, w, accept)
+				return nil, orig
+			}
+			if mounted != nil {
+				at = mount + "/" + module + ":" + at
+				return srv.shiftBrowserHandler(compliance, ctx, r, deviceId, root, mounted, at, w, rest, accept)
+			}
+			hndlr := &browserHandler{
+				browser:    browser,
+				auth:       srv.Auth,
+				audit:      srv.Audit,
+				deviceId:   deviceId,
+				mount:      mount,
+				preCommit:  srv.PreCommit,
+				postCommit: srv.PostCommit,
+			}
+			if root == srv.main {
+				hndlr.onEdit = func(ctx context.Context) {
+					srv.configChanged(secure.User(ctx), "")
+				}
+				hndlr.locks = srv.locks()
+			} else if srv.isCandidate(root) {
+				// candidate is committed to running so same locks apply and
+				// hooks see edits when they are committed
+				hndlr.locks = srv.locks()
+				hndlr.preCommit = nil
+				hndlr.postCommit = nil
+			}
+			return hndlr, p
 		} else if err != nil {
 			handleErr(compliance, err, r, w, accept)
 			return nil, orig
@@ -374,6 +472,123 @@ func (srv *Server) shiftBrowserHandler(compliance ComplianceOptions, r *http.Req
 	return nil, orig
 }
 
+// findMount follows path to first mount point and returns device mounted
+// there with rest of path under mount point. Path to mount point itself is
+// served by given device. Path is resolved with same access as request itself.
+// Also returns path to mount point relative to module.
+func (srv *Server) findMount(ctx context.Context, d device.Device, b *node.Browser, p *url.URL) (device.Device, string, *url.URL, error) {
+	mounter, valid := d.(device.Mounter)
+	if !valid {
+		return nil, "", nil, nil
+	}
+	segs := strings.Split(p.EscapedPath(), "/")
+	var parent meta.Meta = b.Meta
+	for i, seg := range segs {
+		ident, _, _ := strings.Cut(seg, "=")
+		def := meta.Find(parent, ident)
+		if def == nil {
+			return nil, "", nil, nil
+		}
+		if device.MountPoint(def) != "" {
+			if i == len(segs)-1 || segs[i+1] == "" {
+				return nil, "", nil, nil
+			}
+			root := b.RootWithContext(ctx)
+			if srv.Auth != nil {
+				srv.Auth.ConstrainRoot(secure.User(ctx), root.Constraints)
+				root.Context = root.Constraints.ContextConstraint(root)
+			}
+			at := strings.Join(segs[:i+1], "/")
+			sel, err := root.Find(at)
+			if err != nil || sel == nil {
+				return nil, "", nil, err
+			}
+			defer sel.Release()
+			mounted, err := mounter.Mounted(sel)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			if mounted == nil {
+				return nil, "", nil, fmt.Errorf("%w. nothing mounted at %s", fc.NotFoundError, sel.Path)
+			}
+			rest := p
+			for j := 0; j <= i; j++ {
+				_, rest = shift(rest, '/')
+			}
+			return mounted, at, rest, nil
+		}
+		parent = def
+	}
+	return nil, "", nil, nil
+}
+
+// configChanged is called after running config of main device changed
+func (srv *Server) configChanged(user string, comment string) {
+	if srv.Persist != nil {
+		srv.Persist.Changed()
+	}
+	srv.runningChanged(user, comment)
+}
+
+// runningChanged records history and publishes config change
+func (srv *Server) runningChanged(user string, comment string) {
+	if h := srv.history(); h != nil {
+		if _, err := h.Record(user, comment); err != nil {
+			fc.Err.Printf("could not record config history. %s", err)
+		}
+	}
+	if c := srv.configChanges(); c != nil {
+		if err := c.Changed(user); err != nil {
+			fc.Err.Printf("could not publish config change. %s", err)
+		}
+	}
+}
+
+// history of main device or nil if not enabled
+func (srv *Server) history() *device.History {
+	if local, valid := srv.main.(*device.Local); valid {
+		return local.History()
+	}
+	return nil
+}
+
+// config changes of main device or nil if not enabled
+func (srv *Server) configChanges() *device.ConfigChanges {
+	if local, valid := srv.main.(*device.Local); valid {
+		return local.ConfigChanges()
+	}
+	return nil
+}
+
+// candidate datastore of main device or nil if not enabled
+func (srv *Server) candidate() *device.Candidate {
+	if local, valid := srv.main.(*device.Local); valid {
+		return local.Candidate()
+	}
+	return nil
+}
+
+// datastore is device serving NMDA datastore of RFC8527
+func (srv *Server) datastore(d device.Device, ds string) (device.Device, error) {
+	switch ds {
+	case "ietf-datastores:running", "ietf-datastores:operational":
+		return d, nil
+	case "ietf-datastores:candidate":
+		if local, valid := d.(*device.Local); valid && local.Candidate() != nil {
+			return local.Candidate(), nil
+		}
+	}
+	return nil, fmt.Errorf("%w. datastore not found: %s", fc.NotFoundError, ds)
+}
+
+func (srv *Server) yangLibBrowser(d device.Device) (*node.Browser, error) {
+	m, err := parser.LoadModule(srv.ypath, "ietf-yang-library")
+	if err != nil {
+		return nil, err
+	}
+	return node.NewBrowser(m, device.LocalDeviceYangLibNode(srv.ModuleAddress, d)), nil
+}
+
 func (srv *Server) serveStaticRoute(w http.ResponseWriter, r *http.Request) bool {
 	_, p := shift(r.URL, '/')
 	op, _ := shift(p, '/')
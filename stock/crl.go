@@ -0,0 +1,164 @@
+package stock
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+)
+
+var ErrRevoked = errors.New("certificate revoked")
+
+type TlsMetrics struct {
+	// Count of peer certificates rejected because they were revoked
+	Revoked int64
+}
+
+// crl is a certificate revocation list loaded from local file.  No network access
+// is ever made to fetch or verify lists.
+type crl struct {
+	file    string
+	list    *x509.RevocationList
+	serials map[string]time.Time
+
+	mu       sync.Mutex
+	verified map[string]error
+}
+
+func (t *Tls) crlFiles() []string {
+	files := append([]string{}, t.CrlFiles...)
+	if t.CrlDir != "" {
+		entries, err := os.ReadDir(t.CrlDir)
+		if err != nil {
+			fc.Err.Printf("could not read crl directory %s. %s", t.CrlDir, err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(t.CrlDir, e.Name()))
+			}
+		}
+	}
+	return files
+}
+
+func loadCrls(files []string) ([]*crl, error) {
+	var crls []*crl
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		found, err := parseCrls(f, data)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, found...)
+	}
+	return crls, nil
+}
+
+// PEM files may contain several lists, otherwise file is expected to be DER
+func parseCrls(fname string, data []byte) ([]*crl, error) {
+	var ders [][]byte
+	rest := data
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = append(ders, data)
+	}
+	crls := make([]*crl, len(ders))
+	for i, der := range ders {
+		list, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, fmt.Errorf("could not read crl %s. %w", fname, err)
+		}
+		c := &crl{
+			file:     fname,
+			list:     list,
+			serials:  make(map[string]time.Time, len(list.RevokedCertificates)),
+			verified: make(map[string]error),
+		}
+		for _, r := range list.RevokedCertificates {
+			c.serials[r.SerialNumber.String()] = r.RevocationTime
+		}
+		if !list.NextUpdate.IsZero() && time.Now().After(list.NextUpdate) {
+			fc.Err.Printf("crl %s expired on %s but is still enforced, replace with newer list", fname, list.NextUpdate)
+		}
+		crls[i] = c
+	}
+	return crls, nil
+}
+
+// verify signature once for each issuer.  List that cannot be verified is
+// ignored so it cannot be used to revoke certificates it has no authority over
+func (c *crl) verify(issuer *x509.Certificate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := string(issuer.Raw)
+	err, found := c.verified[key]
+	if !found {
+		err = c.list.CheckSignatureFrom(issuer)
+		if err != nil {
+			fc.Err.Printf("ignoring crl %s, not signed by %s. %s", c.file, issuer.Subject, err)
+		}
+		c.verified[key] = err
+	}
+	return err
+}
+
+func checkRevoked(crls []*crl, chain []*x509.Certificate) error {
+	for i := 0; i < len(chain)-1; i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, c := range crls {
+			if !bytes.Equal(c.list.RawIssuer, issuer.RawSubject) {
+				continue
+			}
+			revokedAt, revoked := c.serials[cert.SerialNumber.String()]
+			if !revoked || c.verify(issuer) != nil {
+				continue
+			}
+			return fmt.Errorf("%w. %s serial %s revoked on %s", ErrRevoked, cert.Subject, cert.SerialNumber.Text(16), revokedAt)
+		}
+	}
+	return nil
+}
+
+// CheckRevoked returns ErrRevoked if any certificate in any of the verified
+// chains is found in a certificate revocation list
+func (t *Tls) CheckRevoked(chains [][]*x509.Certificate) error {
+	t.mu.RLock()
+	crls := t.crls
+	t.mu.RUnlock()
+	for _, chain := range chains {
+		if err := checkRevoked(crls, chain); err != nil {
+			atomic.AddInt64(&t.Metrics.Revoked, 1)
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tls) verifyPeerCertificate(_ [][]byte, chains [][]*x509.Certificate) error {
+	t.checkReload()
+	err := t.CheckRevoked(chains)
+	if err != nil {
+		fc.Debug.Printf("rejecting peer. %s", err)
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package stock
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freeconf/yang/fc"
+)
+
+func TestCrl(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := testIssue(t, nil, nil, "ca", 1)
+	server, serverKey := testIssue(t, ca, caKey, "server", 2)
+	good, goodKey := testIssue(t, ca, caKey, "good", 3)
+	bad, badKey := testIssue(t, ca, caKey, "bad", 4)
+	caFile := filepath.Join(dir, "ca.crt")
+	fc.RequireEqual(t, nil, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600))
+	crlDir := filepath.Join(dir, "crl")
+	fc.RequireEqual(t, nil, os.Mkdir(crlDir, 0700))
+
+	cfg := &Tls{
+		CaCertFile:          caFile,
+		CrlDir:              crlDir,
+		ClientAuth:          "require-and-verify",
+		ReloadCheckInterval: time.Nanosecond,
+	}
+	cfg.Config.Certificates = []tls.Certificate{{Certificate: [][]byte{server.Raw}, PrivateKey: serverKey}}
+	fc.RequireEqual(t, nil, cfg.Load())
+
+	handshake := func(client *x509.Certificate, clientKey crypto.Signer) error {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		fc.RequireEqual(t, nil, err)
+		defer l.Close()
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		go func() {
+			c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{
+				ServerName:   "server",
+				RootCAs:      roots,
+				Certificates: []tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}},
+			})
+			if err == nil {
+				// wait for server to accept or reject client certificate
+				c.Read(make([]byte, 1))
+				c.Close()
+			}
+		}()
+		s, err := l.Accept()
+		fc.RequireEqual(t, nil, err)
+		defer s.Close()
+		s.SetDeadline(time.Now().Add(10 * time.Second))
+		return tls.Server(s, cfg.NewConfig()).Handshake()
+	}
+	fc.AssertEqual(t, nil, handshake(bad, badKey))
+
+	// lists are picked up w/o restart
+	raw, err := x509.CreateRevocationList(crand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{
+			{SerialNumber: bad.SerialNumber, RevocationTime: time.Now()},
+		},
+	}, ca, caKey)
+	fc.RequireEqual(t, nil, err)
+	crlFile := filepath.Join(crlDir, "ca.crl")
+	fc.RequireEqual(t, nil, os.WriteFile(crlFile, raw, 0600))
+	touch(t, crlDir, 1)
+
+	err = handshake(bad, badKey)
+	fc.AssertEqual(t, true, errors.Is(err, ErrRevoked))
+	fc.AssertEqual(t, int64(1), cfg.Metrics.Revoked)
+	fc.AssertEqual(t, nil, handshake(good, goodKey))
+
+	t.Run("untrusted crl ignored", func(t *testing.T) {
+		other, otherKey := testIssue(t, nil, nil, "ca", 5)
+		forged, err := x509.CreateRevocationList(crand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now(),
+			NextUpdate: time.Now().Add(time.Hour),
+			RevokedCertificates: []pkix.RevokedCertificate{
+				{SerialNumber: good.SerialNumber, RevocationTime: time.Now()},
+			},
+		}, other, otherKey)
+		fc.RequireEqual(t, nil, err)
+		fc.RequireEqual(t, nil, os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: forged}), 0600))
+		touch(t, crlFile, 2)
+		fc.AssertEqual(t, nil, handshake(good, goodKey))
+	})
+	t.Run("unverified client auth", func(t *testing.T) {
+		for _, auth := range []string{"none", "request", "require-any"} {
+			c := &Tls{CaCertFile: caFile, CrlDir: crlDir, ClientAuth: auth}
+			fc.AssertEqual(t, true, c.Load() != nil, auth)
+		}
+		c := &Tls{CaCertFile: caFile, CrlDir: crlDir}
+		c.Config.ClientAuth = tls.RequireAnyClientCert
+		fc.AssertEqual(t, true, c.Load() != nil)
+
+		// no client auth as there are no certificate authorities
+		c = &Tls{CrlDir: crlDir}
+		fc.AssertEqual(t, true, c.Load() != nil)
+	})
+}
+
+func testIssue(t *testing.T, parent *x509.Certificate, parentKey crypto.Signer, name string, serial int64) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	fc.RequireEqual(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		parent, parentKey = template, key
+	}
+	raw, err := x509.CreateCertificate(crand.Reader, template, parent, &key.PublicKey, parentKey)
+	fc.RequireEqual(t, nil, err)
+	cert, err := x509.ParseCertificate(raw)
+	fc.RequireEqual(t, nil, err)
+	return cert, key
+}
@@ -3,47 +3,570 @@ package stock
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
 	"github.com/freeconf/yang/val"
 )
 
+// DefaultReloadCheckInterval is how often certificate files are checked for
+// changes when there is no interval set
+var DefaultReloadCheckInterval = 10 * time.Second
+
 type Tls struct {
-	Config     tls.Config
+	// Base settings. Load never changes them, use NewConfig for settings
+	// that include loaded certificates.
+	Config tls.Config
+
+	// Default certificate from files or inline PEM
+	CertFile string
+	KeyFile  string
+	CertPem  string
+	KeyPem   string
+
+	// Certificate authorities used to verify peers.  All sources are combined.
+	CaCertFile  string
+	CaCertFiles []string
+	CaCertDir   string
+	CaCertPem   string
+
+	// Certificate revocation lists used to reject revoked peer certificates.
+	// Files may be PEM or DER encoded. Client auth must verify certificates.
+	CrlFiles []string
+	CrlDir   string
+
+	// Certificates selected by server name clients send in TLS handshake
+	Sni []*SniCert
+
+	// none, request, require-any, verify-if-given or require-and-verify.  Default
+	// is verify-if-given when there are certificate authorities
+	ClientAuth string
+
+	// How often to check files for changes. Default is DefaultReloadCheckInterval
+	ReloadCheckInterval time.Duration
+
+	Metrics TlsMetrics
+
+	mu        sync.RWMutex
+	current   *tls.Config
+	defCert   *tls.Certificate
+	sniCerts  []sniCert
+	crls      []*crl
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+type SniCert struct {
+	// Exact name or wildcard like *.example.com
+	ServerName string
 	CertFile   string
 	KeyFile    string
-	CaCertFile string
+	CertPem    string
+	KeyPem     string
+}
+
+type sniCert struct {
+	serverName string
+	cert       *tls.Certificate
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require-any":        tls.RequireAnyClientCert,
+	"verify-if-given":    tls.VerifyClientCertIfGiven,
+	"require-and-verify": tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"tls1.0": tls.VersionTLS10,
+	"tls1.1": tls.VersionTLS11,
+	"tls1.2": tls.VersionTLS12,
+	"tls1.3": tls.VersionTLS13,
+}
+
+// Load reads certificates and certificate authorities into settings given
+// out by NewConfig so certificates are reloaded when files change w/o
+// restarting servers.  Safe to call again to force a reload.
+func (t *Tls) Load() error {
+	settings, current := t.settings()
+	defCert, err := loadKeyPair(settings.CertFile, settings.KeyFile, settings.CertPem, settings.KeyPem)
+	if err != nil {
+		return err
+	}
+	sniCerts := make([]sniCert, 0, len(settings.Sni))
+	for _, s := range settings.Sni {
+		c, err := loadKeyPair(s.CertFile, s.KeyFile, s.CertPem, s.KeyPem)
+		if err != nil {
+			return fmt.Errorf("sni %s. %w", s.ServerName, err)
+		}
+		if c == nil {
+			return fmt.Errorf("sni %s has no certificate", s.ServerName)
+		}
+		sniCerts = append(sniCerts, sniCert{serverName: strings.ToLower(s.ServerName), cert: c})
+	}
+	pool, err := settings.loadCertAuthorities()
+	if err != nil {
+		return err
+	}
+	crls, err := loadCrls(settings.crlFiles())
+	if err != nil {
+		return err
+	}
+	clientAuth := current.ClientAuth
+	if settings.ClientAuth != "" {
+		var valid bool
+		if clientAuth, valid = clientAuthTypes[settings.ClientAuth]; !valid {
+			return fmt.Errorf("invalid client auth '%s'", settings.ClientAuth)
+		}
+	} else if pool != nil && clientAuth == tls.NoClientCert {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	if len(settings.CrlFiles) > 0 || settings.CrlDir != "" {
+		switch clientAuth {
+		case tls.VerifyClientCertIfGiven, tls.RequireAndVerifyClientCert:
+		default:
+			// there would be no verified chains to check
+			return errors.New("crl requires client auth verify-if-given or require-and-verify")
+		}
+		current.VerifyPeerCertificate = t.verifyPeerCertificate
+	}
+	if pool != nil {
+		current.RootCAs = pool
+		current.ClientCAs = pool
+	}
+	current.ClientAuth = clientAuth
+	current.GetCertificate = t.getCertificate
+	current.GetClientCertificate = t.getClientCertificate
+	current.GetConfigForClient = nil
+	modTimes := settings.modifiedTimes()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current = current
+	t.defCert = defCert
+	t.sniCerts = sniCerts
+	t.crls = crls
+	t.modTimes = modTimes
+	t.lastCheck = time.Now()
+	return nil
+}
+
+// settings is a copy of what Load reads as management can edit settings
+// while handshakes reload certificates
+func (t *Tls) settings() (*Tls, *tls.Config) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s := &Tls{
+		CertFile:            t.CertFile,
+		KeyFile:             t.KeyFile,
+		CertPem:             t.CertPem,
+		KeyPem:              t.KeyPem,
+		CaCertFile:          t.CaCertFile,
+		CaCertFiles:         append([]string{}, t.CaCertFiles...),
+		CaCertDir:           t.CaCertDir,
+		CaCertPem:           t.CaCertPem,
+		CrlFiles:            append([]string{}, t.CrlFiles...),
+		CrlDir:              t.CrlDir,
+		ClientAuth:          t.ClientAuth,
+		ReloadCheckInterval: t.ReloadCheckInterval,
+	}
+	for _, sni := range t.Sni {
+		copy := *sni
+		s.Sni = append(s.Sni, &copy)
+	}
+	return s, t.Config.Clone()
 }
 
+// NewConfig is a copy of settings from last Load. Servers using it get most
+// recent settings on each handshake.
+func (t *Tls) NewConfig() *tls.Config {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var c *tls.Config
+	if t.current != nil {
+		c = t.current.Clone()
+	} else {
+		c = t.Config.Clone()
+	}
+	c.GetConfigForClient = t.getConfigForClient
+	return c
+}
+
+func loadKeyPair(certFile string, keyFile string, certPem string, keyPem string) (*tls.Certificate, error) {
+	var c tls.Certificate
+	var err error
+	if certPem != "" {
+		c, err = tls.X509KeyPair([]byte(certPem), []byte(keyPem))
+	} else if certFile != "" {
+		c, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Leaf == nil {
+		if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// returns nil if there are no certificate authorities configured
+func (t *Tls) loadCertAuthorities() (*x509.CertPool, error) {
+	files := t.caFiles()
+	if len(files) == 0 && t.CaCertPem == "" && t.CaCertDir == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if t.CaCertPem != "" && !pool.AppendCertsFromPEM([]byte(t.CaCertPem)) {
+		return nil, errors.New("no certificates found in inline ca PEM")
+	}
+	for _, f := range files {
+		pemData, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in %s", f)
+		}
+	}
+	return pool, nil
+}
+
+func (t *Tls) caFiles() []string {
+	var files []string
+	if t.CaCertFile != "" {
+		files = append(files, t.CaCertFile)
+	}
+	files = append(files, t.CaCertFiles...)
+	if t.CaCertDir != "" {
+		// directory is rescanned on reload so new files are picked up
+		entries, err := os.ReadDir(t.CaCertDir)
+		if err != nil {
+			fc.Err.Printf("could not read ca directory %s. %s", t.CaCertDir, err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(t.CaCertDir, e.Name()))
+			}
+		}
+	}
+	return files
+}
+
+func (t *Tls) watchedFiles() []string {
+	files := []string{t.CertFile, t.KeyFile}
+	for _, s := range t.Sni {
+		files = append(files, s.CertFile, s.KeyFile)
+	}
+	files = append(files, t.caFiles()...)
+	files = append(files, t.crlFiles()...)
+
+	// catches files added or removed
+	if t.CaCertDir != "" {
+		files = append(files, t.CaCertDir)
+	}
+	if t.CrlDir != "" {
+		files = append(files, t.CrlDir)
+	}
+	return files
+}
+
+func (t *Tls) modifiedTimes() map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, f := range t.watchedFiles() {
+		if f == "" {
+			continue
+		}
+		if info, err := os.Stat(f); err == nil {
+			times[f] = info.ModTime()
+		} else {
+			times[f] = time.Time{}
+		}
+	}
+	return times
+}
+
+// Changed is true if any certificate files were modified, added or removed since
+// last load
+func (t *Tls) Changed() bool {
+	settings, _ := t.settings()
+	current := settings.modifiedTimes()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(current) != len(t.modTimes) {
+		return true
+	}
+	for f, modTime := range current {
+		if prev, found := t.modTimes[f]; !found || !prev.Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReload is called on each handshake but only checks files periodically.
+// If new files cannot be loaded, last good certificates continue to be used.
+func (t *Tls) checkReload() {
+	t.mu.Lock()
+	interval := t.ReloadCheckInterval
+	if interval == 0 {
+		interval = DefaultReloadCheckInterval
+	}
+	due := time.Since(t.lastCheck) >= interval
+	if due {
+		t.lastCheck = time.Now()
+	}
+	t.mu.Unlock()
+	if !due || !t.Changed() {
+		return
+	}
+	fc.Debug.Printf("certificate files changed, reloading")
+	if err := t.Load(); err != nil {
+		fc.Err.Printf("could not reload certificates, using previous ones. %s", err)
+	}
+}
+
+func (t *Tls) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	t.checkReload()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	name := strings.ToLower(hello.ServerName)
+	if name != "" {
+		for _, s := range t.sniCerts {
+			if s.serverName == name {
+				return s.cert, nil
+			}
+		}
+		if dot := strings.IndexRune(name, '.'); dot > 0 {
+			wildcard := "*" + name[dot:]
+			for _, s := range t.sniCerts {
+				if s.serverName == wildcard {
+					return s.cert, nil
+				}
+			}
+		}
+	}
+	if t.defCert != nil {
+		return t.defCert, nil
+	}
+	for _, s := range t.sniCerts {
+		if hello.SupportsCertificate(s.cert) == nil {
+			return s.cert, nil
+		}
+	}
+	// fall back to any certificates in config
+	return nil, nil
+}
+
+func (t *Tls) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	t.checkReload()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.defCert != nil {
+		return t.defCert, nil
+	}
+	if len(t.current.Certificates) > 0 {
+		return &t.current.Certificates[0], nil
+	}
+	// sending no certificate lets server decide
+	return &tls.Certificate{}, nil
+}
+
+// certificate authorities can change after server has started so give each
+// handshake most recent settings
+func (t *Tls) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	t.checkReload()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.current.Clone(), nil
+}
+
+// Loaded is true once certificates are managed by Load
+func (t *Tls) Loaded() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.current != nil
+}
+
+// RootCAs is current pool of certificate authorities
+func (t *Tls) RootCAs() *x509.CertPool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.current != nil {
+		return t.current.RootCAs
+	}
+	return t.Config.RootCAs
+}
+
+// TlsNode manages settings. Edits are guarded from handshakes that reload
+// certificates with them.
 func TlsNode(config *Tls) node.Node {
-	return &nodeutil.Extend{
+	return lockedNode(&config.mu, &nodeutil.Extend{
 		Base: nodeutil.ReflectChild(&config.Config),
 		OnChild: func(p node.Node, r node.ChildRequest) (node.Node, error) {
 			switch r.Meta.Ident() {
 			case "ca":
-				if r.New {
-					config.Config.RootCAs = x509.NewCertPool()
-
-					// assertion - harmless if not used, but useful if is used.
-					config.Config.ClientCAs = config.Config.RootCAs
-					config.Config.ClientAuth = tls.VerifyClientCertIfGiven
-				}
-				if config.Config.RootCAs != nil {
+				if r.New || config.CaCertFile != "" || len(config.CaCertFiles) > 0 ||
+					config.CaCertDir != "" || config.CaCertPem != "" {
 					return CertificateAuthorityNode(config), nil
 				}
+				return nil, nil
 			case "cert":
-				if r.New {
-					config.Config.Certificates = make([]tls.Certificate, 1)
-				}
-				if len(config.Config.Certificates) > 0 {
+				if r.New || config.CertFile != "" || config.CertPem != "" {
 					return CertificateNode(config), nil
 				}
+				return nil, nil
+			case "crl":
+				if r.New || len(config.CrlFiles) > 0 || config.CrlDir != "" {
+					return CrlNode(config), nil
+				}
+				return nil, nil
+			case "sni":
+				if r.New || len(config.Sni) > 0 {
+					return nodeutil.Reflect{}.ReflectList(reflect.ValueOf(config.Sni), func(v reflect.Value) {
+						config.Sni = v.Interface().([]*SniCert)
+					}), nil
+				}
+				return nil, nil
 			}
 			return p.Child(r)
 		},
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			switch r.Meta.Ident() {
+			case "minVersion":
+				return tlsVersionField(&config.Config.MinVersion, r, hnd)
+			case "maxVersion":
+				return tlsVersionField(&config.Config.MaxVersion, r, hnd)
+			case "cipherSuites":
+				return cipherSuitesField(config, r, hnd)
+			case "clientAuth":
+				if r.Write {
+					config.ClientAuth = hnd.Val.(val.Enum).Label
+				} else if config.ClientAuth != "" {
+					var err error
+					hnd.Val, err = node.NewValue(r.Meta.Type(), config.ClientAuth)
+					return err
+				}
+				return nil
+			case "reloadCheckIntervalMs":
+				if r.Write {
+					config.ReloadCheckInterval = time.Duration(hnd.Val.Value().(int)) * time.Millisecond
+				} else if config.ReloadCheckInterval != 0 {
+					hnd.Val = val.Int32(config.ReloadCheckInterval / time.Millisecond)
+				}
+				return nil
+			}
+			return p.Field(r, hnd)
+		},
+		OnAction: func(p node.Node, r node.ActionRequest) (node.Node, error) {
+			switch r.Meta.Ident() {
+			case "reload":
+				return nil, config.Load()
+			}
+			return p.Action(r)
+		},
+		OnEndEdit: func(p node.Node, r node.NodeRequest) error {
+			if err := p.EndEdit(r); err != nil {
+				return err
+			}
+			return config.Load()
+		},
+	})
+}
+
+// lockedNode reads and writes settings of n and all its descendants under mu
+func lockedNode(mu *sync.RWMutex, n node.Node) node.Node {
+	return &nodeutil.Extend{
+		Base: n,
+		OnChild: func(p node.Node, r node.ChildRequest) (node.Node, error) {
+			unlock := lock(mu, r.New || r.Delete)
+			child, err := p.Child(r)
+			unlock()
+			if child == nil || err != nil {
+				return child, err
+			}
+			return lockedNode(mu, child), nil
+		},
+		OnNext: func(p node.Node, r node.ListRequest) (node.Node, []val.Value, error) {
+			unlock := lock(mu, r.New || r.Delete)
+			item, key, err := p.Next(r)
+			unlock()
+			if item == nil || err != nil {
+				return item, key, err
+			}
+			return lockedNode(mu, item), key, nil
+		},
+		OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+			unlock := lock(mu, r.Write || r.Clear)
+			defer unlock()
+			return p.Field(r, hnd)
+		},
+	}
+}
+
+func lock(mu *sync.RWMutex, write bool) func() {
+	if write {
+		mu.Lock()
+		return mu.Unlock
+	}
+	mu.RLock()
+	return mu.RUnlock
+}
+
+func tlsVersionField(v *uint16, r node.FieldRequest, hnd *node.ValueHandle) error {
+	if r.Write {
+		*v = tlsVersions[hnd.Val.(val.Enum).Label]
+		return nil
+	}
+	for label, id := range tlsVersions {
+		if id == *v {
+			var err error
+			hnd.Val, err = node.NewValue(r.Meta.Type(), label)
+			return err
+		}
+	}
+	return nil
+}
+
+func cipherSuitesField(config *Tls, r node.FieldRequest, hnd *node.ValueHandle) error {
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	if r.Write {
+		var ids []uint16
+	nextName:
+		for _, name := range hnd.Val.Value().([]string) {
+			for _, s := range suites {
+				if s.Name == name {
+					ids = append(ids, s.ID)
+					continue nextName
+				}
+			}
+			return fmt.Errorf("%w. unsupported cipher suite '%s'", fc.BadRequestError, name)
+		}
+		config.Config.CipherSuites = ids
+		return nil
 	}
+	if len(config.Config.CipherSuites) == 0 {
+		return nil
+	}
+	names := make([]string, len(config.Config.CipherSuites))
+	for i, id := range config.Config.CipherSuites {
+		names[i] = tls.CipherSuiteName(id)
+	}
+	hnd.Val = val.StringList(names)
+	return nil
 }
 
 func CertificateAuthorityNode(config *Tls) node.Node {
@@ -51,47 +574,63 @@ func CertificateAuthorityNode(config *Tls) node.Node {
 	n.OnField = func(r node.FieldRequest, hnd *node.ValueHandle) error {
 		switch r.Meta.Ident() {
 		case "certFile":
+			stringField(&config.CaCertFile, r, hnd)
+		case "certFiles":
 			if r.Write {
-				config.CaCertFile = hnd.Val.String()
-				pemData, err := os.ReadFile(hnd.Val.String())
-				if err != nil {
-					return err
-				}
-				config.Config.RootCAs.AppendCertsFromPEM(pemData)
-			} else {
-				hnd.Val = val.String(config.CaCertFile)
+				config.CaCertFiles = hnd.Val.Value().([]string)
+			} else if len(config.CaCertFiles) > 0 {
+				hnd.Val = val.StringList(config.CaCertFiles)
 			}
+		case "certDir":
+			stringField(&config.CaCertDir, r, hnd)
+		case "certPem":
+			stringField(&config.CaCertPem, r, hnd)
 		}
 		return nil
 	}
 	return n
 }
 
-func CertificateNode(config *Tls) node.Node {
+func CrlNode(config *Tls) node.Node {
 	n := &nodeutil.Basic{}
-	n.OnField = func(r node.FieldRequest, hnd *node.ValueHandle) (err error) {
+	n.OnField = func(r node.FieldRequest, hnd *node.ValueHandle) error {
 		switch r.Meta.Ident() {
-		case "certFile":
+		case "crlFiles":
 			if r.Write {
-				config.CertFile = hnd.Val.String()
-			} else {
-				hnd.Val = val.String(config.CertFile)
-			}
-		case "keyFile":
-			if r.Write {
-				config.KeyFile = hnd.Val.String()
-			} else {
-				hnd.Val = val.String(config.KeyFile)
+				config.CrlFiles = hnd.Val.Value().([]string)
+			} else if len(config.CrlFiles) > 0 {
+				hnd.Val = val.StringList(config.CrlFiles)
 			}
+		case "crlDir":
+			stringField(&config.CrlDir, r, hnd)
 		}
 		return nil
 	}
-	n.OnEndEdit = func(r node.NodeRequest) error {
-		var err error
-		if r.New {
-			config.Config.Certificates[0], err = tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	return n
+}
+
+func CertificateNode(config *Tls) node.Node {
+	n := &nodeutil.Basic{}
+	n.OnField = func(r node.FieldRequest, hnd *node.ValueHandle) (err error) {
+		switch r.Meta.Ident() {
+		case "certFile":
+			stringField(&config.CertFile, r, hnd)
+		case "keyFile":
+			stringField(&config.KeyFile, r, hnd)
+		case "certPem":
+			stringField(&config.CertPem, r, hnd)
+		case "keyPem":
+			stringField(&config.KeyPem, r, hnd)
 		}
-		return err
+		return nil
 	}
 	return n
 }
+
+func stringField(s *string, r node.FieldRequest, hnd *node.ValueHandle) {
+	if r.Write {
+		*s = hnd.Val.String()
+	} else if *s != "" {
+		hnd.Val = val.String(*s)
+	}
+}
@@ -1,7 +1,20 @@
 package stock
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/node"
@@ -40,6 +53,174 @@ func TestTlsNode(t *testing.T) {
 	fc.RequireEqual(t, `{"cert":{"certFile":"testdata/test.crt","keyFile":"testdata/test.key"}}`, actual)
 }
 
+func TestTlsOptions(t *testing.T) {
+	m, err := parser.LoadModuleFromString(source.Dir("../yang"), `
+		module x {
+			import fc-stocklib {
+				prefix "x";
+			}
+			uses x:tls;
+		}
+	`)
+	fc.RequireEqual(t, nil, err)
+	a := writeTestCert(t, t.TempDir(), "a.example.com")
+	cfg := &Tls{}
+	b := node.NewBrowser(m, TlsNode(cfg))
+	err = b.Root().UpsertFrom(readJson(fmt.Sprintf(`{
+		"minVersion": "tls1.2",
+		"cipherSuites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"],
+		"clientAuth": "require-and-verify",
+		"reloadCheckIntervalMs": 10,
+		"cert":{
+			"certFile": "testdata/test.crt",
+			"keyFile": "testdata/test.key"
+		},
+		"ca":{
+			"certFiles": ["testdata/test.crt", %q]
+		},
+		"sni":[{
+			"serverName": "*.example.com",
+			"certFile": %q,
+			"keyFile": %q
+		}]
+	}`, a.certFile, a.certFile, a.keyFile)))
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, uint16(tls.VersionTLS12), cfg.Config.MinVersion)
+	fc.AssertEqual(t, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, cfg.Config.CipherSuites[0])
+	fc.AssertEqual(t, tls.RequireAndVerifyClientCert, cfg.NewConfig().ClientAuth)
+	fc.AssertEqual(t, tls.NoClientCert, cfg.Config.ClientAuth)
+	fc.AssertEqual(t, 10*time.Millisecond, cfg.ReloadCheckInterval)
+	fc.AssertEqual(t, true, cfg.Loaded())
+
+	actual, err := nodeutil.WriteJSON(b.Root())
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, true, strings.Contains(actual, `"minVersion":"tls1.2"`))
+	fc.AssertEqual(t, true, strings.Contains(actual, `"serverName":"*.example.com"`))
+
+	c, err := cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "a.example.com", c.Leaf.Subject.CommonName)
+	c, err = cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{})
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "localhost", c.Leaf.Subject.CommonName)
+}
+
+func TestTlsReload(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeTestCert(t, dir, "orig")
+	cfg := &Tls{
+		CertFile:            orig.certFile,
+		KeyFile:             orig.keyFile,
+		ReloadCheckInterval: time.Nanosecond,
+	}
+	fc.RequireEqual(t, nil, cfg.Load())
+	c, err := cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{})
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "orig", c.Leaf.Subject.CommonName)
+
+	// bogus files keep last good certificate
+	fc.RequireEqual(t, nil, os.WriteFile(orig.certFile, []byte("bogus"), 0600))
+	touch(t, orig.certFile, 1)
+	c, _ = cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{})
+	fc.AssertEqual(t, "orig", c.Leaf.Subject.CommonName)
+
+	writeTestCert(t, dir, "rotated")
+	fc.RequireEqual(t, nil, os.Rename(dir+"/rotated.crt", orig.certFile))
+	fc.RequireEqual(t, nil, os.Rename(dir+"/rotated.key", orig.keyFile))
+	touch(t, orig.certFile, 2)
+	c, err = cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{})
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "rotated", c.Leaf.Subject.CommonName)
+}
+
+func TestTlsEditWhileReloading(t *testing.T) {
+	m, err := parser.LoadModuleFromString(source.Dir("../yang"), `
+		module x {
+			import fc-stocklib {
+				prefix "x";
+			}
+			uses x:tls;
+		}
+	`)
+	fc.RequireEqual(t, nil, err)
+	dir := t.TempDir()
+	certs := []testCertFiles{writeTestCert(t, dir, "a"), writeTestCert(t, dir, "b")}
+	cfg := &Tls{
+		CertFile:            certs[0].certFile,
+		KeyFile:             certs[0].keyFile,
+		ReloadCheckInterval: time.Nanosecond,
+	}
+	fc.RequireEqual(t, nil, cfg.Load())
+	b := node.NewBrowser(m, TlsNode(cfg))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				// handshakes reload when files change
+				cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{})
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		c := certs[i%2]
+		err := b.Root().UpsertFrom(readJson(fmt.Sprintf(`{"cert":{"certFile":%q,"keyFile":%q}}`, c.certFile, c.keyFile)))
+		fc.RequireEqual(t, nil, err)
+	}
+	close(stop)
+	<-done
+	c, err := cfg.NewConfig().GetCertificate(&tls.ClientHelloInfo{})
+	fc.RequireEqual(t, nil, err)
+	fc.AssertEqual(t, "b", c.Leaf.Subject.CommonName)
+}
+
+// file systems can have coarse modification times
+func touch(t *testing.T, fname string, minutes int) {
+	t.Helper()
+	future := time.Now().Add(time.Duration(minutes) * time.Minute)
+	fc.RequireEqual(t, nil, os.Chtimes(fname, future, future))
+}
+
+type testCertFiles struct {
+	certFile string
+	keyFile  string
+}
+
+func writeTestCert(t *testing.T, dir string, name string) testCertFiles {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	fc.RequireEqual(t, nil, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	raw, err := x509.CreateCertificate(crand.Reader, template, template, &key.PublicKey, key)
+	fc.RequireEqual(t, nil, err)
+	keyRaw, err := x509.MarshalPKCS8PrivateKey(key)
+	fc.RequireEqual(t, nil, err)
+	f := testCertFiles{
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyRaw})
+	fc.RequireEqual(t, nil, os.WriteFile(f.certFile, certPem, 0600))
+	fc.RequireEqual(t, nil, os.WriteFile(f.keyFile, keyPem, 0600))
+	return f
+}
+
 func readJson(s string) node.Node {
 	n, err := nodeutil.ReadJSON(s)
 	if err != nil {
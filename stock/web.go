@@ -8,12 +8,14 @@ import (
 	"net"
 	"net/http"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/freeconf/yang/fc"
 	"github.com/freeconf/yang/node"
 	"github.com/freeconf/yang/nodeutil"
 	"github.com/freeconf/yang/source"
+	"github.com/freeconf/yang/val"
 )
 
 type HttpServerOptions struct {
@@ -32,6 +34,9 @@ type HttpServer struct {
 	Server  *http.Server
 	handler http.Handler
 	Metrics WebMetrics
+
+	// Optional: called when a client connection closes
+	OnConnClosed func(conn net.Conn)
 }
 
 func (service *HttpServer) Options() HttpServerOptions {
@@ -57,11 +62,15 @@ func (service *HttpServer) ApplyOptions(options HttpServerOptions) {
 		}
 	}
 	if options.Tls != nil {
-		service.Server.TLSConfig = &options.Tls.Config
+		if !options.Tls.Loaded() {
+			chkStartErr(options.Tls.Load())
+		}
+		service.Server.TLSConfig = options.Tls.NewConfig()
 		go func() {
 			// Using "tcp" listener allowed for greater config flexibility for cert
-			// data but disabled HTTP/2
-			chkStartErr(service.Server.ListenAndServeTLS(options.Tls.CertFile, options.Tls.KeyFile))
+			// data but disabled HTTP/2. Certificates come from config so they can
+			// be reloaded w/o restarting server
+			chkStartErr(service.Server.ListenAndServeTLS("", ""))
 		}()
 	} else {
 		go func() {
@@ -90,6 +99,9 @@ func (service *HttpServer) connectionUpdate(conn net.Conn, state http.ConnState)
 		service.Metrics.Hijacked++
 	case http.StateClosed:
 		service.Metrics.Closed++
+		if service.OnConnClosed != nil {
+			service.OnConnClosed(conn)
+		}
 	}
 }
 
@@ -106,11 +118,12 @@ func NewHttpServer(handler http.Handler) *HttpServer {
 func (service *HttpServer) GetHttpClient() *http.Client {
 	var client *http.Client
 	if service.options.Tls != nil {
-		tlsConfig := &tls.Config{
-			Certificates: service.options.Tls.Config.Certificates,
-			RootCAs:      service.options.Tls.Config.RootCAs,
-		}
-		transport := &http.Transport{TLSClientConfig: tlsConfig}
+		tlsConfig := service.options.Tls.NewConfig()
+		transport := &http.Transport{TLSClientConfig: &tls.Config{
+			Certificates:         tlsConfig.Certificates,
+			GetClientCertificate: tlsConfig.GetClientCertificate,
+			RootCAs:              tlsConfig.RootCAs,
+		}}
 		client = &http.Client{Transport: transport}
 	} else {
 		client = http.DefaultClient
@@ -158,7 +171,19 @@ func WebServerNode(service *HttpServer) node.Node {
 					return TlsNode(options.Tls), nil
 				}
 			case "metrics":
-				return nodeutil.ReflectChild(&service.Metrics), nil
+				return &nodeutil.Extend{
+					Base: nodeutil.ReflectChild(&service.Metrics),
+					OnField: func(p node.Node, r node.FieldRequest, hnd *node.ValueHandle) error {
+						switch r.Meta.Ident() {
+						case "revoked":
+							if options.Tls != nil {
+								hnd.Val = val.Int64(atomic.LoadInt64(&options.Tls.Metrics.Revoked))
+							}
+							return nil
+						}
+						return p.Field(r, hnd)
+					},
+				}, nil
 			}
 			return nil, nil
 		},
@@ -3,12 +3,14 @@ package restconf
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 
 	"strings"
 
+	"github.com/freeconf/restconf/device"
 	"github.com/freeconf/yang/patch/xml"
 
 	"github.com/freeconf/yang/fc"
@@ -75,6 +77,9 @@ func handleErr(compliance ComplianceOptions, err error, r *http.Request, w http.
 		return false
 	}
 	fc.Debug.Printf("web request error [%s] %s %s", r.Method, r.URL, err.Error())
+	if aud, isAudited := w.(*auditResponse); isAudited {
+		aud.err = err
+	}
 	msg := err.Error()
 	code := fc.HttpStatusCode(err)
 	if !compliance.SimpleErrorResponse {
@@ -84,6 +89,26 @@ func handleErr(compliance ComplianceOptions, err error, r *http.Request, w http.
 			Path:    decodeErrorPath(r.RequestURI),
 			Message: msg,
 		}
+		var veto *EditVetoError
+		if errors.As(err, &veto) {
+			errResp.AppTag = veto.AppTag
+			if veto.Path != "" {
+				errResp.Path = veto.Path
+			}
+		}
+		var exists *dataExistsError
+		if errors.As(err, &exists) {
+			errResp.Tag = "data-exists"
+		}
+		var denied *device.LockDeniedError
+		if errors.As(err, &denied) {
+			errResp.Tag = "lock-denied"
+			errResp.Info = &errInfo{
+				SessionId: denied.Lock.Owner.Session,
+				User:      denied.Lock.Owner.User,
+				LockId:    denied.Lock.Id,
+			}
+		}
 		var buff bytes.Buffer
 		if mime.IsXml() {
 			emsg := struct {
@@ -141,10 +166,19 @@ func decodeErrorPath(fullPath string) string {
 }
 
 type errResponse struct {
-	Type    string `json:"error-type" xml:"error-type"`
-	Tag     string `json:"error-tag"  xml:"error-tag"`
-	Path    string `json:"error-path"  xml:"error-path"`
-	Message string `json:"error-message"  xml:"error-message"`
+	Type    string   `json:"error-type" xml:"error-type"`
+	Tag     string   `json:"error-tag"  xml:"error-tag"`
+	AppTag  string   `json:"error-app-tag,omitempty"  xml:"error-app-tag,omitempty"`
+	Path    string   `json:"error-path"  xml:"error-path"`
+	Message string   `json:"error-message"  xml:"error-message"`
+	Info    *errInfo `json:"error-info,omitempty"  xml:"error-info,omitempty"`
+}
+
+// errInfo identifies holder of a lock
+type errInfo struct {
+	SessionId string `json:"session-id,omitempty"  xml:"session-id,omitempty"`
+	User      string `json:"user,omitempty"  xml:"user,omitempty"`
+	LockId    uint32 `json:"lock-id"  xml:"lock-id"`
 }
 
 func ipAddrSplitHostPort(addr string) (host string, port string) {